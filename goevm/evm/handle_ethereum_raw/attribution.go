@@ -0,0 +1,68 @@
+package handle_ethereum_raw
+
+import (
+	"goevm/evm_proxy/client"
+	"goevm/evm_proxy/usage"
+	"strconv"
+	"time"
+)
+
+// Response headers which tell which node served the request, there's no
+// response cache or request coalescing so every request is a cache miss
+const (
+	HEADER_NODE        = "X-Proxy-Node"
+	HEADER_ATTEMPTS    = "X-Proxy-Attempts"
+	HEADER_CACHE       = "X-Proxy-Cache"
+	HEADER_UPSTREAM_MS = "X-Proxy-Upstream-Ms"
+)
+
+type attribution struct {
+	request_id string
+	node       uint64
+	attempts   int
+	took_ns    int64
+
+	// for usage accounting, response is the last one received from a node,
+	// or the one written to the client
+	methods        []string
+	request_bytes  int
+	response_bytes int
+	result         client.ResponseType
+}
+
+// Run the request on the node and remember it as the one which served
+// the response
+func (this *attribution) try(cl *client.EVMClient, call func() (client.ResponseType, []byte)) (client.ResponseType, []byte) {
+	ts := time.Now().UnixNano()
+	r_type, ret := call()
+	this.node = cl.GetID()
+	this.attempts++
+	this.took_ns = time.Now().UnixNano() - ts
+	this.result = r_type
+	this.response_bytes = len(ret)
+
+	// throttled requests are never sent to the node
+	if r_type != client.R_THROTTLED {
+		usage.Node(cl.GetEndpoint(), cl.GetProvider(), this.methods, this.request_bytes, len(ret), r_type != client.R_OK)
+	}
+
+	log.Debug("Node response", "req", this.request_id, "node", this.node, "attempt", this.attempts,
+		"result", int(r_type), "took_ms", float64(this.took_ns)/1e6)
+	return r_type, ret
+}
+
+func (this *attribution) headers(set func(key, value string)) {
+	set(HEADER_ATTEMPTS, strconv.Itoa(this.attempts))
+	set(HEADER_CACHE, "MISS")
+	if this.attempts == 0 {
+		return
+	}
+	set(HEADER_NODE, strconv.FormatUint(this.node, 10))
+	set(HEADER_UPSTREAM_MS, strconv.FormatFloat(float64(this.took_ns)/1e6, 'f', 2, 64))
+}
+
+// usage records the request as made by the client, name is the API key or
+// IP the request came from
+func (this *attribution) usage(name string) {
+	usage.Client(name, this.methods, this.request_bytes, this.response_bytes, this.attempts == 0 || this.result != client.R_OK)
+}
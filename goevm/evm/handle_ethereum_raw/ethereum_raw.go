@@ -3,10 +3,16 @@ package handle_ethereum_raw
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"goevm/evm_proxy"
+	"goevm/evm_proxy/alert"
+	"goevm/evm_proxy/apikey"
 	"goevm/evm_proxy/client"
+	"goevm/evm_proxy/method_filter"
+	"net/http"
 
 	"github.com/slawomir-pryczek/HSServer/handler_socket2"
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/stats"
 )
 
 type Handle_ethereum_raw struct {
@@ -25,8 +31,53 @@ func (this *Handle_ethereum_raw) GetActions() []string {
 
 func (this *Handle_ethereum_raw) HandleAction(action string, data *handler_socket2.HSParams) string {
 
+	method := data.GetParam("method", "")
+	params := data.GetParam("params", "")
+	if len(method) == 0 {
+		return `{"error":"provide transaction &method=eth_blockNumber or &method=eth_getBalance and optionally &params=[\"0x...\"] add &public=1 if you want to force the request to be run on public node"}`
+	}
+	if !method_filter.IsAllowed(data.GetParam("__listener", ""), method) {
+		data.FastReturnBNocopy(_rpc_error_response(nil, false, RPC_ERR_METHOD_NOT_FOUND, "Method not found or not allowed: "+method, nil))
+		return ""
+	}
+
+	// API keys, the same checks as for JSON-RPC passthrough
+	key := (*apikey.Key)(nil)
+	if apikey.IsEnabled() {
+		header := http.Header{}
+		header.Set("X-Api-Key", data.GetParam("__api_key", ""))
+		key = apikey.Get(apikey.FromRequest(header, map[string]string{"api_key": data.GetParam("api_key", ""),
+			"__path": data.GetParam("__path", "")}))
+		if key == nil {
+			data.FastReturnBNocopy(_rpc_error_response(nil, false, RPC_ERR_UNAUTHORIZED, "Unauthorized, valid API key required", nil))
+			return ""
+		}
+		if !key.IsMethodAllowed(method) {
+			data.FastReturnBNocopy(_rpc_error_response(nil, false, RPC_ERR_METHOD_NOT_FOUND, "Method not allowed for this API key: "+method, nil))
+			return ""
+		}
+	}
+
+	if method == "eth_sendRawTransaction" {
+		if tx_err := _inspect_raw_tx(nil, json.RawMessage(params), data.GetParam("__client_ip", "")); tx_err != nil {
+			tmp, _ := json.Marshal(tx_err)
+			data.FastReturnBNocopy(tmp)
+			return ""
+		}
+	}
+
+	if key != nil {
+		if ok, limits := key.OnRequest([]string{method}); !ok {
+			data.FastReturnBNocopy(_rpc_error_response(nil, false, RPC_ERR_LIMIT_EXCEEDED, "API key quota exceeded", limits))
+			return ""
+		}
+	}
+
 	// get first client!
 	sch := evm_proxy.MakeScheduler()
+	if key != nil {
+		sch.SetTags(key.GetTags())
+	}
 	if data.GetParamI("public", 0) == 1 {
 		sch.ForcePublic(true)
 	}
@@ -35,6 +86,7 @@ func (this *Handle_ethereum_raw) HandleAction(action string, data *handler_socke
 	}
 	cl := sch.GetAnyClient()
 	if cl == nil {
+		alert.NoClient()
 		return `{"error":"can't find appropriate client"}`
 	}
 
@@ -52,14 +104,33 @@ func (this *Handle_ethereum_raw) HandleAction(action string, data *handler_socke
 		return true
 	}
 
-	method := data.GetParam("method", "")
-	params := data.GetParam("params", "")
-	if len(method) == 0 {
-		return `{"error":"provide transaction &method=eth_blockNumber or &method=eth_getBalance and optionally &params=[\"0x...\"] add &public=1 if you want to force the request to be run on public node"}`
+	at := attribution{request_id: data.GetParam("__request_id", ""), methods: []string{method}, request_bytes: len(params)}
+	defer at.headers(data.SetRespHeader)
+	usage_name := "ip:" + data.GetParam("__client_ip", "")
+	if key != nil {
+		usage_name = "key:" + key.GetName()
+	}
+	defer at.usage(usage_name)
+	_request := func(cl *client.EVMClient) ([]byte, client.ResponseType) {
+		r_type, ret := at.try(cl, func() (client.ResponseType, []byte) {
+			ret, r_type := cl.RequestBasicID(at.request_id, method, params)
+			return r_type, ret
+		})
+		if key != nil && r_type == client.R_OK {
+			key.OnReceive(len(ret))
+		}
+		return ret, r_type
 	}
 
 	// Try first client (private by default)
-	ret, result := cl.RequestBasic(method, params)
+	ret, result := _request(cl)
+	if result == client.R_TOO_LARGE {
+		_max := handler_socket2.GetSizeLimits().MaxResponseBytes(method)
+		stats.LimitHit(handler_socket2.LIMIT_RESPONSE_BYTES, data.GetParam("__client_ip", ""))
+		data.FastReturnBNocopy(_rpc_error_response(nil, false, RPC_ERR_RESPONSE_TOO_LARGE,
+			fmt.Sprintf("Response too large, limit is %d bytes", _max), _limit_data(handler_socket2.LIMIT_RESPONSE_BYTES, _max)))
+		return ""
+	}
 	if ret != nil && result == client.R_OK && is_req_ok(ret) {
 		data.FastReturnBNocopy(ret)
 		return ""
@@ -68,7 +139,7 @@ func (this *Handle_ethereum_raw) HandleAction(action string, data *handler_socke
 	// Try public client, if private failed
 	cl = sch.GetPublicClient()
 	if cl != nil {
-		ret, result = cl.RequestBasic(method, params)
+		ret, result = _request(cl)
 	}
 	if ret != nil && result == client.R_OK && is_req_ok(ret) {
 		data.FastReturnBNocopy(ret)
@@ -81,7 +152,7 @@ func (this *Handle_ethereum_raw) HandleAction(action string, data *handler_socke
 		if cl == nil {
 			break
 		}
-		ret, result = cl.RequestBasic(method, params)
+		ret, result = _request(cl)
 	}
 	if ret != nil && result == client.R_OK && is_req_ok(ret) {
 		data.FastReturnBNocopy(ret)
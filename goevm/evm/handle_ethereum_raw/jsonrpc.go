@@ -0,0 +1,196 @@
+package handle_ethereum_raw
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+const (
+	RPC_ERR_PARSE              = -32700
+	RPC_ERR_INVALID_REQUEST    = -32600
+	RPC_ERR_METHOD_NOT_FOUND   = -32601
+	RPC_ERR_UNAUTHORIZED       = -32001
+	RPC_ERR_RESPONSE_TOO_LARGE = -32003
+	RPC_ERR_LIMIT_EXCEEDED     = -32005
+)
+
+type rpc_call struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+
+	raw     json.RawMessage
+	invalid bool
+}
+
+// Calls without id are notifications, the server must not reply to them,
+// also when they're rejected
+func (this *rpc_call) is_notification() bool {
+	return !this.invalid && len(this.ID) == 0
+}
+
+// Decode calls from JSON-RPC request, returns nil if the payload can't be
+// decoded. Batch items which are not valid objects are marked as invalid
+func _parse_calls(post []byte) ([]rpc_call, bool) {
+	post = bytes.TrimLeft(post, " \r\n\t")
+	if len(post) == 0 {
+		return nil, false
+	}
+
+	if post[0] == '[' {
+		items := make([]json.RawMessage, 0)
+		if err := json.Unmarshal(post, &items); err != nil {
+			return nil, true
+		}
+
+		ret := make([]rpc_call, len(items))
+		for num, item := range items {
+			if err := json.Unmarshal(item, &ret[num]); err != nil || len(ret[num].Method) == 0 {
+				ret[num] = rpc_call{invalid: true}
+			}
+			ret[num].raw = item
+		}
+		return ret, true
+	}
+
+	ret := rpc_call{}
+	if err := json.Unmarshal(post, &ret); err != nil {
+		return nil, false
+	}
+	ret.raw = post
+	return []rpc_call{ret}, false
+}
+
+// Build batch from calls which were not rejected at the proxy
+func _build_batch(calls []rpc_call, rejected []interface{}) []byte {
+	items := make([]json.RawMessage, 0, len(calls))
+	for num, c := range calls {
+		if rejected[num] != nil {
+			continue
+		}
+		items = append(items, c.raw)
+	}
+
+	b, _ := json.Marshal(items)
+	return b
+}
+
+// Merge node's batch response with errors for rejected calls, keeping the
+// order of the original request. Responses are matched by id, calls with
+// the same id get responses in the order the node returned them
+func _merge_batch(calls []rpc_call, rejected []interface{}, resp []byte) []byte {
+	items := make([]json.RawMessage, 0)
+	if len(bytes.TrimSpace(resp)) > 0 {
+		if err := json.Unmarshal(resp, &items); err != nil {
+			return resp
+		}
+	}
+
+	by_id := make(map[string][]json.RawMessage, len(items))
+	for _, item := range items {
+		tmp := rpc_call{}
+		if json.Unmarshal(item, &tmp) != nil {
+			continue
+		}
+		id := string(bytes.TrimSpace(tmp.ID))
+		by_id[id] = append(by_id[id], item)
+	}
+
+	out := make([]interface{}, 0, len(calls))
+	for num, c := range calls {
+		if c.is_notification() {
+			continue
+		}
+		if rejected[num] != nil {
+			out = append(out, rejected[num])
+			continue
+		}
+		id := string(bytes.TrimSpace(c.ID))
+		if queue := by_id[id]; len(queue) > 0 {
+			out = append(out, queue[0])
+			by_id[id] = queue[1:]
+			continue
+		}
+		out = append(out, _rpc_error(c.ID, RPC_ERR_INVALID_REQUEST, "No response from node", nil))
+	}
+
+	if len(out) == 0 {
+		return []byte{}
+	}
+	b, err := json.Marshal(out)
+	if err != nil {
+		return resp
+	}
+	return b
+}
+
+// Errors for calls which were all rejected, notifications get no response
+func _rpc_rejected_response(calls []rpc_call, is_batch bool, rejected []interface{}) []byte {
+	out := make([]interface{}, 0, len(rejected))
+	for num, r := range rejected {
+		if !calls[num].is_notification() {
+			out = append(out, r)
+		}
+	}
+	if len(out) == 0 {
+		return []byte{}
+	}
+
+	ret := interface{}(out)
+	if !is_batch {
+		ret = out[0]
+	}
+	b, err := json.Marshal(ret)
+	if err != nil {
+		return _passthrough_err("Unknown error")
+	}
+	return b
+}
+
+func _limit_data(limit string, max int) map[string]interface{} {
+	return map[string]interface{}{"limit": limit, "max": max}
+}
+
+func _rpc_error(id json.RawMessage, code int, message string, data interface{}) map[string]interface{} {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+
+	e := make(map[string]interface{})
+	e["code"] = code
+	e["message"] = message
+	if data != nil {
+		e["data"] = data
+	}
+
+	ret := make(map[string]interface{})
+	ret["jsonrpc"] = "2.0"
+	ret["id"] = id
+	ret["error"] = e
+	return ret
+}
+
+// Build error response for the whole request, for batches every call
+// gets its own error object
+func _rpc_error_response(calls []rpc_call, is_batch bool, code int, message string, data interface{}) []byte {
+	out := interface{}(nil)
+	if is_batch {
+		tmp := make([]interface{}, 0, len(calls))
+		for _, c := range calls {
+			tmp = append(tmp, _rpc_error(c.ID, code, message, data))
+		}
+		out = tmp
+	} else {
+		id := json.RawMessage(nil)
+		if len(calls) > 0 {
+			id = calls[0].ID
+		}
+		out = _rpc_error(id, code, message, data)
+	}
+
+	b, err := json.Marshal(out)
+	if err != nil {
+		return _passthrough_err("Unknown error")
+	}
+	return b
+}
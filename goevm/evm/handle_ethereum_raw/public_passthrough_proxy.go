@@ -4,13 +4,20 @@ import (
 	"encoding/json"
 	"fmt"
 	"goevm/evm_proxy"
+	"goevm/evm_proxy/alert"
+	"goevm/evm_proxy/apikey"
 	"goevm/evm_proxy/client"
+	"goevm/evm_proxy/method_filter"
 	"net/http"
 	"strings"
 
 	"github.com/slawomir-pryczek/HSServer/handler_socket2"
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/hslog"
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/stats"
 )
 
+var log = hslog.Get("proxy")
+
 func _passthrough_err(err string) []byte {
 	out := make(map[string]interface{}, 0)
 	out["message"] = err
@@ -46,40 +53,139 @@ func init() {
 			return false
 		}
 
+		calls, is_batch := _parse_calls(post)
+		if len(calls) == 0 {
+			w.Write(_rpc_error_response(nil, false, RPC_ERR_PARSE, "Parse error", nil))
+			return true
+		}
+		limits := handler_socket2.GetSizeLimits()
+		if limits.MaxBatchItems > 0 && len(calls) > limits.MaxBatchItems {
+			stats.LimitHit(handler_socket2.LIMIT_BATCH_ITEMS, get["__client_ip"])
+			w.Write(_rpc_error_response(nil, false, RPC_ERR_INVALID_REQUEST,
+				fmt.Sprintf("Batch too large, limit is %d items", limits.MaxBatchItems), _limit_data(handler_socket2.LIMIT_BATCH_ITEMS, limits.MaxBatchItems)))
+			return true
+		}
+
+		// API keys, if defined every request needs to have a valid key
+		key := (*apikey.Key)(nil)
+		if apikey.IsEnabled() {
+			key = apikey.Get(apikey.FromRequest(header, get))
+			if key == nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write(_rpc_error_response(calls, is_batch, RPC_ERR_UNAUTHORIZED, "Unauthorized, valid API key required", nil))
+				return true
+			}
+		}
+
+		// reject calls to methods which are not allowed, every call of a batch
+		// is checked separately and only allowed calls are forwarded
+		listener := get["__listener"]
+		rejected := make([]interface{}, len(calls))
+		rejected_count := 0
+		methods := make([]string, 0, len(calls))
+		for num, c := range calls {
+			tx_err := map[string]interface{}(nil)
+			if c.Method == "eth_sendRawTransaction" {
+				tx_err = _inspect_raw_tx(c.ID, c.Params, get["__client_ip"])
+			}
+
+			switch {
+			case c.invalid:
+				rejected[num] = _rpc_error(nil, RPC_ERR_INVALID_REQUEST, "Invalid request", nil)
+			case !method_filter.IsAllowed(listener, c.Method):
+				rejected[num] = _rpc_error(c.ID, RPC_ERR_METHOD_NOT_FOUND, "Method not found or not allowed: "+c.Method, nil)
+			case key != nil && !key.IsMethodAllowed(c.Method):
+				rejected[num] = _rpc_error(c.ID, RPC_ERR_METHOD_NOT_FOUND, "Method not allowed for this API key: "+c.Method, nil)
+			case tx_err != nil:
+				rejected[num] = tx_err
+			default:
+				methods = append(methods, c.Method)
+				continue
+			}
+			rejected_count++
+		}
+		if rejected_count == len(calls) {
+			w.Write(_rpc_rejected_response(calls, is_batch, rejected))
+			return true
+		}
+
+		forward := post
+		if rejected_count > 0 {
+			forward = _build_batch(calls, rejected)
+		}
+
+		if key != nil {
+			if ok, limits := key.OnRequest(methods); !ok {
+				w.WriteHeader(http.StatusTooManyRequests)
+				w.Write(_rpc_error_response(calls, is_batch, RPC_ERR_LIMIT_EXCEEDED, "API key quota exceeded", limits))
+				return true
+			}
+		}
+
 		sch := evm_proxy.MakeScheduler()
+		if key != nil {
+			sch.SetTags(key.GetTags())
+		}
+		at := attribution{request_id: get["__request_id"], methods: methods, request_bytes: len(forward)}
+		_write := func(data []byte) {
+			at.headers(w.Header().Set)
+			at.response_bytes = len(data)
+			w.Write(data)
+		}
+		usage_name := "ip:" + get["__client_ip"]
+		if key != nil {
+			usage_name = "key:" + key.GetName()
+		}
+		defer at.usage(usage_name)
+
 		clients := sch.GetAllSorted(false, false)
 		if len(clients) == 0 {
-			fmt.Println("Debug - No clients found")
-			w.Write(_passthrough_err("Can't find any client"))
+			log.Warn("No clients found", "req", at.request_id, "ip", get["__client_ip"])
+			alert.NoClient()
+			_write(_passthrough_err("Can't find any client"))
 			return true
 		}
 
 		// loop over workers, if we have "throttled" returned it'll try other workers
 		errors := 0
 		for _, cl := range clients {
-			fmt.Printf("Trying client : %s\n", cl.GetEndpoint())
-			resp_type, resp_data := cl.RequestForward(post)
+			resp_type, resp_data := at.try(cl, func() (client.ResponseType, []byte) {
+				return cl.RequestForward(forward, at.request_id)
+			})
 			if resp_type == client.R_OK {
-				fmt.Printf("Success with client: %s\n", cl.GetEndpoint())
-				w.Write(resp_data)
+				if key != nil {
+					key.OnReceive(len(resp_data))
+				}
+				if rejected_count > 0 {
+					resp_data = _merge_batch(calls, rejected, resp_data)
+				}
+				_write(resp_data)
+				return true
+			}
+
+			if resp_type == client.R_TOO_LARGE {
+				_max := limits.MaxResponseBytes(methods...)
+				stats.LimitHit(handler_socket2.LIMIT_RESPONSE_BYTES, get["__client_ip"])
+				_write(_rpc_error_response(calls, is_batch, RPC_ERR_RESPONSE_TOO_LARGE,
+					fmt.Sprintf("Response too large, limit is %d bytes", _max), _limit_data(handler_socket2.LIMIT_RESPONSE_BYTES, _max)))
 				return true
 			}
 
 			if resp_type == client.R_ERROR {
-				fmt.Printf("Error with client: %s\n", cl.GetEndpoint())
+				log.Info("Error with client", "req", at.request_id, "node", cl.GetEndpoint())
 				errors++
 				if errors >= 2 {
-					w.Write(_passthrough_err("Request failed (e)"))
+					_write(_passthrough_err("Request failed (e)"))
 					return true
 				}
 			}
 
 			if resp_type == client.R_THROTTLED {
-				fmt.Printf("Client throttled: %s\n", cl.GetEndpoint())
+				log.Debug("Client throttled", "req", at.request_id, "node", cl.GetEndpoint())
 			}
 		}
 
-		w.Write(_passthrough_err("Request failed"))
+		_write(_passthrough_err("Request failed"))
 		return true
 	})
 }
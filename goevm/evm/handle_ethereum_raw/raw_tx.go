@@ -0,0 +1,37 @@
+package handle_ethereum_raw
+
+import (
+	"encoding/json"
+	"goevm/evm_proxy/tx_policy"
+
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/hslog"
+)
+
+var log_tx = hslog.Get("tx")
+
+const (
+	RPC_ERR_INVALID_PARAMS = -32602
+	RPC_ERR_TX_REJECTED    = -32000
+)
+
+// Decode and check transaction passed to eth_sendRawTransaction, returns
+// JSON-RPC error if the transaction should not be forwarded
+func _inspect_raw_tx(id, params json.RawMessage, client_ip string) map[string]interface{} {
+	_params := make([]string, 0)
+	if err := json.Unmarshal(params, &_params); err != nil || len(_params) != 1 {
+		return _rpc_error(id, RPC_ERR_INVALID_PARAMS, "Invalid params, expected signed transaction data", nil)
+	}
+
+	tx, err := tx_policy.Check(_params[0])
+	if tx == nil {
+		log_tx.Info("Raw transaction invalid", "ip", client_ip, "err", err)
+		return _rpc_error(id, RPC_ERR_INVALID_PARAMS, "Invalid transaction: "+err.Error(), nil)
+	}
+	if err != nil {
+		log_tx.Info("Raw transaction rejected", "ip", client_ip, "err", err, "tx", tx.String())
+		return _rpc_error(id, RPC_ERR_TX_REJECTED, "Transaction rejected by proxy policy: "+err.Error(), nil)
+	}
+
+	log_tx.Info("Raw transaction", "ip", client_ip, "tx", tx.String())
+	return nil
+}
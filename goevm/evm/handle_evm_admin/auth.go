@@ -0,0 +1,330 @@
+package handle_evm_admin
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slawomir-pryczek/HSServer/handler_socket2"
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/config"
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/hslog"
+)
+
+var log = hslog.Get("admin")
+
+const (
+	ROLE_READ  = 1
+	ROLE_WRITE = 2
+)
+
+// Role required to run admin actions, actions which are not listed here
+// are not protected
+var admin_actions = map[string]int{
+	"server-status":          ROLE_READ,
+	"metrics":                ROLE_READ,
+	"evm_admin":              ROLE_READ,
+	"evm_admin_add":          ROLE_WRITE,
+	"evm_admin_remove":       ROLE_WRITE,
+	"evm_admin_audit":        ROLE_READ,
+	"evm_admin_capture":      ROLE_WRITE,
+	"evm_admin_clear_errors": ROLE_WRITE,
+	"evm_admin_alert_test":   ROLE_WRITE,
+	"evm_admin_usage":        ROLE_READ,
+	"evm_admin_pause":        ROLE_WRITE,
+	"evm_admin_resume":       ROLE_WRITE,
+	"evm_admin_drain":        ROLE_WRITE,
+	"evm_admin_score":        ROLE_WRITE,
+	"evm_admin_throttle":     ROLE_WRITE,
+	"evm_admin_probe_time":   ROLE_WRITE,
+	"evm_admin_public":       ROLE_WRITE,
+}
+
+type credential struct {
+	name        string
+	token       string
+	hmac_secret string
+	role        int
+	allow_ips   []*net.IPNet
+}
+
+type admin_auth struct {
+	mu sync.Mutex
+
+	is_configured bool
+	credentials   []credential
+	allow_ips     []*net.IPNet
+	max_skew      int64
+
+	used_signatures map[string]int64
+}
+
+var auth = admin_auth{}
+
+func init() {
+	auth.used_signatures = make(map[string]int64)
+	auth.max_skew = 300
+
+	raw, ok := config.Config().GetRawData("ADMIN_AUTH", "").(map[string]interface{})
+	if !ok {
+		// config is empty when it's only checked
+		if !config.HasArg(config.ARG_CHECK_CONFIG) {
+			log.Warn("ADMIN_AUTH is not configured, admin actions are allowed only from loopback interface")
+		}
+		auth.allow_ips = _parse_ip_ranges("127.0.0.1/8,::1")
+		handler_socket2.ActionGuardRegister(authGuard)
+		return
+	}
+
+	var errs config.PathErrors
+	auth.is_configured = true
+	auth.credentials, auth.allow_ips, auth.max_skew, errs = _read_auth_config(raw, "ADMIN_AUTH")
+	for _, err := range errs {
+		log.Warn("Invalid ADMIN_AUTH config", "err", err)
+	}
+	log.Info("Admin auth configured", "credentials", len(auth.credentials), "allowed_ip_ranges", len(auth.allow_ips))
+
+	handler_socket2.ActionGuardRegister(authGuard)
+}
+
+// Credentials without token or hmac_secret are skipped, IP ranges which
+// can't be parsed are left out
+func _read_auth_config(raw map[string]interface{}, path string) ([]credential, []*net.IPNet, int64, config.PathErrors) {
+	errs := config.PathErrors{}
+	creds := make([]credential, 0)
+	max_skew := int64(300)
+
+	_ranges := func(item map[string]interface{}, path string) []*net.IPNet {
+		v, ok := item["allow_ips"].(string)
+		if _, exists := item["allow_ips"]; exists && !ok {
+			errs.Add(config.PathKey(path, "allow_ips"), "expected comma separated list of IPs or CIDR ranges")
+		}
+		if !ok {
+			return nil
+		}
+		ret, _errs := handler_socket2.ParseIPRanges(v)
+		for _, err := range _errs {
+			errs.Add(config.PathKey(path, "allow_ips"), "%s", err.Error())
+		}
+		return ret
+	}
+
+	for attr := range raw {
+		switch attr {
+		case "allow_ips", "max_skew", "credentials":
+		default:
+			errs.Add(config.PathKey(path, attr), "unknown ADMIN_AUTH attribute")
+		}
+	}
+	allow_ips := _ranges(raw, path)
+	if v, ok := raw["max_skew"]; ok {
+		n, _ := v.(json.Number)
+		if _v, err := n.Int64(); err == nil && _v > 0 {
+			max_skew = _v
+		} else {
+			errs.Add(config.PathKey(path, "max_skew"), "expected integer > 0")
+		}
+	}
+
+	items, ok := raw["credentials"].([]interface{})
+	if _, exists := raw["credentials"]; exists && !ok {
+		errs.Add(config.PathKey(path, "credentials"), "expected array of credentials")
+	}
+	for num, v := range items {
+		_path := config.PathIndex(config.PathKey(path, "credentials"), num)
+		item, ok := v.(map[string]interface{})
+		if !ok {
+			errs.Add(_path, "expected object")
+			continue
+		}
+		for attr, v := range item {
+			switch attr {
+			case "name", "token", "hmac_secret", "role", "allow_ips":
+				if _, ok := v.(string); !ok {
+					errs.Add(config.PathKey(_path, attr), "expected string")
+				}
+			default:
+				errs.Add(config.PathKey(_path, attr), "unknown credential attribute")
+			}
+		}
+
+		c := credential{}
+		c.name, _ = item["name"].(string)
+		c.token, _ = item["token"].(string)
+		c.hmac_secret, _ = item["hmac_secret"].(string)
+		c.role = ROLE_READ
+		switch _role, _ := item["role"].(string); _role {
+		case "write":
+			c.role = ROLE_WRITE
+		case "read", "":
+		default:
+			errs.Add(config.PathKey(_path, "role"), "unknown role %s, expected read or write", _role)
+		}
+		c.allow_ips = _ranges(item, _path)
+		if len(c.name) == 0 {
+			c.name = fmt.Sprintf("credential #%d", num)
+		}
+		if len(c.token) == 0 && len(c.hmac_secret) == 0 {
+			errs.Add(_path, "admin %s has no token or hmac_secret defined", c.name)
+			continue
+		}
+		creds = append(creds, c)
+	}
+	return creds, allow_ips, max_skew, errs
+}
+
+func _auth_config_check(raw interface{}, path string) []config.PathError {
+	_raw, ok := raw.(map[string]interface{})
+	if !ok {
+		return []config.PathError{{Path: path, Message: "expected object"}}
+	}
+	_, _, _, errs := _read_auth_config(_raw, path)
+	return errs
+}
+
+func _parse_ip_ranges(s string) []*net.IPNet {
+	ret, errs := handler_socket2.ParseIPRanges(s)
+	for _, err := range errs {
+		log.Warn("Cannot parse IP range", "err", err)
+	}
+	return ret
+}
+
+func _ip_allowed(ranges []*net.IPNet, ip net.IP) bool {
+	if len(ranges) == 0 {
+		return true
+	}
+	return handler_socket2.IPInRanges(ranges, ip)
+}
+
+// Client IP is resolved by the server, X-Forwarded-For is used only when
+// the request comes from one of TRUSTED_PROXIES
+func _remote_ip(data *handler_socket2.HSParams) net.IP {
+	addr := data.GetParam("__client_ip", data.GetParam("__remote_addr", ""))
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	return net.ParseIP(addr)
+}
+
+// Signature is HMAC-SHA256 of "timestamp\naction\nparams", where params are
+// sorted k=v pairs joined with &, without auth and internal parameters
+func _signature_payload(ts, action string, data *handler_socket2.HSParams) string {
+	params := make([]string, 0)
+	for k, v := range data.GetParamsS() {
+		if k == "action" || strings.HasPrefix(k, "__") || strings.HasPrefix(k, "auth_") {
+			continue
+		}
+		params = append(params, k+"="+v)
+	}
+	sort.Strings(params)
+	return ts + "\n" + action + "\n" + strings.Join(params, "&")
+}
+
+func (this *admin_auth) authenticate(action string, data *handler_socket2.HSParams) (*credential, string) {
+
+	// bearer token, from header or auth_token parameter
+	token := data.GetParam("auth_token", "")
+	if _h := data.GetParam("__authorization", ""); len(_h) > 7 && strings.EqualFold(_h[0:7], "bearer ") {
+		token = strings.TrimSpace(_h[7:])
+	}
+	if len(token) > 0 {
+		for num, c := range this.credentials {
+			if len(c.token) > 0 && subtle.ConstantTimeCompare([]byte(c.token), []byte(token)) == 1 {
+				return &this.credentials[num], ""
+			}
+		}
+		return nil, "invalid token"
+	}
+
+	// HMAC signed request
+	key := data.GetParam("__auth_key", data.GetParam("auth_key", ""))
+	ts := data.GetParam("__auth_ts", data.GetParam("auth_ts", ""))
+	sig := data.GetParam("__auth_sig", data.GetParam("auth_sig", ""))
+	if len(key) == 0 || len(ts) == 0 || len(sig) == 0 {
+		return nil, "credentials required"
+	}
+
+	_ts, err := strconv.ParseInt(ts, 10, 64)
+	now := time.Now().Unix()
+	if err != nil || _ts < now-this.max_skew || _ts > now+this.max_skew {
+		return nil, "timestamp expired or invalid"
+	}
+
+	for num, c := range this.credentials {
+		if c.name != key || len(c.hmac_secret) == 0 {
+			continue
+		}
+
+		mac := hmac.New(sha256.New, []byte(c.hmac_secret))
+		mac.Write([]byte(_signature_payload(ts, action, data)))
+		expected := hex.EncodeToString(mac.Sum(nil))
+		if !hmac.Equal([]byte(expected), []byte(strings.ToLower(sig))) {
+			return nil, "invalid signature"
+		}
+
+		// signatures can be used only once
+		this.mu.Lock()
+		defer this.mu.Unlock()
+		for k, expires := range this.used_signatures {
+			if expires < now {
+				delete(this.used_signatures, k)
+			}
+		}
+		if _, used := this.used_signatures[expected]; used {
+			return nil, "signature already used"
+		}
+		this.used_signatures[expected] = now + this.max_skew*2
+		return &this.credentials[num], ""
+	}
+
+	return nil, "invalid signature"
+}
+
+func authGuard(action string, data *handler_socket2.HSParams) (bool, string) {
+	role, ok := admin_actions[action]
+	if !ok && strings.HasPrefix(action, "evm_admin") {
+		role, ok = ROLE_WRITE, true
+	}
+	if !ok {
+		return true, ""
+	}
+
+	_err := func(s string) (bool, string) {
+		ret := make(map[string]interface{})
+		ret["error"] = "Admin access denied, " + s
+		tmp, _ := json.Marshal(ret)
+		return false, string(tmp)
+	}
+
+	ip := _remote_ip(data)
+	if !_ip_allowed(auth.allow_ips, ip) {
+		return _err("IP not allowed")
+	}
+	if !auth.is_configured {
+		data.SetParam("__admin", "local")
+		return true, ""
+	}
+
+	c, err := auth.authenticate(action, data)
+	if c == nil {
+		return _err(err)
+	}
+	if !_ip_allowed(c.allow_ips, ip) {
+		return _err("IP not allowed for " + c.name)
+	}
+	if c.role < role {
+		return _err("read-only access")
+	}
+
+	data.SetParam("__admin", c.name)
+	return true, ""
+}
@@ -0,0 +1,486 @@
+package handle_evm_admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"goevm/evm_proxy/alert"
+	"goevm/evm_proxy/apikey"
+	"goevm/evm_proxy/capture"
+	"goevm/evm_proxy/client/throttle"
+	"goevm/evm_proxy/iplimit"
+	"goevm/evm_proxy/method_filter"
+	"goevm/evm_proxy/tx_policy"
+	"goevm/evm_proxy/usage"
+	"io"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/slawomir-pryczek/HSServer/handler_socket2"
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/config"
+)
+
+// ConfigError is a problem found in the config, path is JSON path of the
+// value, like $.EVM_NODES[0].throttle
+type ConfigError = config.PathError
+
+// top level keys and their types, flags are bool, 0/1 or "0"/"1", keys of string
+// type can have conditional variants, like BIND_TO_10.0.0.1
+var config_keys = map[string]string{
+	"BIND_TO":               "string",
+	"LOCAL_IP":              "string",
+	"RUN_SERVICES":          "string",
+	"PASSTHROUGH_URL":       "string",
+	"TRUSTED_PROXIES":       "string",
+	"COMPRESSION":           "string",
+	"SLAVE":                 "string",
+	"REPLICATION_MODE":      "string",
+	"FORCE_START":           "flag",
+	"DEBUG":                 "flag",
+	"VERBOSE":               "flag",
+	"COMPRESSION_THRESHOLD": "int",
+	"compression_threshold": "int",
+	"chainId":               "chain_id",
+	"EVM_NODES":             "array",
+	"API_KEYS":              "array",
+	"CLIENTS":               "array",
+	"CUSTOM_HEALTH_CHECKER": "object",
+	"LOG":                   "object",
+	"HISTORY":               "object",
+	"ALERTS":                "object",
+	"TX_POLICY":             "object",
+	"IP_LIMITS":             "object",
+	"AUDIT_LOG":             "object",
+	"ADMIN_AUTH":            "object",
+	"USAGE":                 "object",
+	"CAPTURE":               "object",
+	"LIMITS":                "object",
+	"LISTENERS":             "object",
+	"METHOD_FILTER":         "object",
+	"CORS":                  "object",
+}
+
+// deprecated keys are accepted, but reported as warnings
+var config_deprecated = map[string]string{
+	"DEBUG":   "deprecated, set levels in LOG section instead",
+	"VERBOSE": "deprecated and has no effect, set levels in LOG section instead",
+}
+
+var health_checker_attrs = []string{"run_every", "max_block_lag", "max_data_age_ms"}
+
+// sections are validated by the same readers which are used when the
+// server starts, so the check can't pass a config the server won't accept
+var config_sections = map[string]func(interface{}, string) []config.PathError{
+	"ALERTS":        alert.ConfigCheck,
+	"USAGE":         usage.ConfigCheck,
+	"CAPTURE":       capture.ConfigCheck,
+	"API_KEYS":      apikey.ConfigCheck,
+	"CLIENTS":       apikey.ConfigCheck,
+	"TX_POLICY":     tx_policy.ConfigCheck,
+	"IP_LIMITS":     iplimit.ConfigCheck,
+	"ADMIN_AUTH":    _auth_config_check,
+	"LIMITS":        handler_socket2.SizeLimitsConfigCheck,
+	"METHOD_FILTER": method_filter.ConfigCheck,
+	"CORS":          handler_socket2.CORSConfigCheck,
+}
+
+// sections which can be overridden per listener, in LISTENERS
+var listener_sections = []string{"CORS", "METHOD_FILTER"}
+
+// ConfigCheck validates the whole config, every problem is returned, not
+// only the first one
+func ConfigCheck(raw map[string]interface{}) []ConfigError {
+	ret := make([]ConfigError, 0)
+	_err := func(path string, format string, a ...interface{}) {
+		ret = append(ret, ConfigError{Path: path, Message: fmt.Sprintf(format, a...)})
+	}
+	_section := func(check func(interface{}, string) []config.PathError, raw interface{}, path string) {
+		errs := check(raw, path)
+		sort.SliceStable(errs, func(i, j int) bool { return errs[i].Path < errs[j].Path })
+		ret = append(ret, errs...)
+	}
+
+	for _, key := range _sorted_keys(raw) {
+		kind, ok := config_keys[key]
+		for k, v := range config_keys {
+			if !ok && v == "string" && strings.HasPrefix(key, k+"_") {
+				kind, ok = v, true
+			}
+		}
+		if !ok {
+			_err(config.PathKey("$", key), "unknown key")
+			continue
+		}
+
+		val := raw[key]
+		_, is_int := val.(json.Number)
+		if is_int {
+			_, err := val.(json.Number).Int64()
+			is_int = err == nil
+		}
+		switch kind {
+		case "string":
+			_, ok = val.(string)
+		case "flag":
+			_, ok = val.(bool)
+			ok = ok || is_int || val == "0" || val == "1"
+		case "int":
+			ok = is_int
+		case "chain_id":
+			_, ok = val.(string)
+			ok = ok || is_int
+		case "array":
+			_, ok = val.([]interface{})
+		case "object":
+			_, ok = val.(map[string]interface{})
+		}
+		if !ok {
+			_err(config.PathKey("$", key), "expected %s, got %s", kind, _config_type(val))
+			delete(raw, key)
+			continue
+		}
+		if msg, ok := config_deprecated[key]; ok {
+			ret = append(ret, ConfigError{Path: config.PathKey("$", key), Message: msg, Warning: true})
+		}
+		if check, ok := config_sections[key]; ok {
+			_section(check, val, config.PathKey("$", key))
+		}
+	}
+
+	// listeners are h, u (udp) or no prefix (tcp) followed by ip:port
+	listeners := make(map[string]bool)
+	for _, key := range _sorted_keys(raw) {
+		if key != "BIND_TO" && !strings.HasPrefix(key, "BIND_TO_") {
+			continue
+		}
+		for _, bt := range strings.Split(raw[key].(string), ",") {
+			bt = strings.Trim(bt, "\r\n\t ")
+			if len(bt) == 0 {
+				continue
+			}
+			listeners[bt] = true
+			addr := bt
+			if addr[0] == 'h' || addr[0] == 'u' {
+				addr = addr[1:]
+			}
+			host, port, err := net.SplitHostPort(addr)
+			if err != nil {
+				_err(config.PathKey("$", key), "invalid address %s, expected [h|u]ip:port", bt)
+				continue
+			}
+			if p, err := strconv.Atoi(port); err != nil || p <= 0 || p > 65535 {
+				_err(config.PathKey("$", key), "invalid port in %s", bt)
+			}
+			if len(host) > 0 && net.ParseIP(host) == nil {
+				_err(config.PathKey("$", key), "invalid ip in %s", bt)
+			}
+		}
+	}
+	if _, ok := raw["BIND_TO"]; !ok {
+		_err("$.BIND_TO", "BIND_TO is required")
+	}
+	if l, ok := raw["LISTENERS"].(map[string]interface{}); ok {
+		for _, key := range _sorted_keys(l) {
+			path := config.PathKey("$.LISTENERS", key)
+			if !listeners[key] {
+				_err(path, "listener is not in BIND_TO")
+			}
+			attrs, ok := l[key].(map[string]interface{})
+			if !ok {
+				_err(path, "expected object, got %s", _config_type(l[key]))
+				continue
+			}
+			for _, attr := range _sorted_keys(attrs) {
+				known := false
+				for _, v := range listener_sections {
+					known = known || v == attr
+				}
+				if !known {
+					_err(config.PathKey(path, attr), "unknown listener attribute, expected one of %s", strings.Join(listener_sections, ", "))
+					continue
+				}
+				_section(config_sections[attr], attrs[attr], config.PathKey(path, attr))
+			}
+		}
+	}
+
+	if hc, ok := raw["CUSTOM_HEALTH_CHECKER"].(map[string]interface{}); ok {
+		for _, attr := range health_checker_attrs {
+			v, ok := hc[attr]
+			if !ok {
+				_err("$.CUSTOM_HEALTH_CHECKER."+attr, "attribute is required")
+				continue
+			}
+			n := int64(-1)
+			switch v := v.(type) {
+			case json.Number:
+				n, _ = v.Int64()
+			case string:
+				n, _ = strconv.ParseInt(v, 10, 64)
+			}
+			if n < 0 || (attr == "run_every" && n == 0) {
+				_err("$.CUSTOM_HEALTH_CHECKER."+attr, "expected positive integer, got %v", v)
+			}
+		}
+		for _, attr := range _sorted_keys(hc) {
+			known := false
+			for _, v := range health_checker_attrs {
+				known = known || v == attr
+			}
+			if !known {
+				_err("$.CUSTOM_HEALTH_CHECKER."+attr, "unknown attribute")
+			}
+		}
+	}
+
+	// nodes can only use providers which are defined, weights are checked
+	// with USAGE section
+	providers := map[string]bool(nil)
+	if u, ok := raw["USAGE"].(map[string]interface{}); ok {
+		providers = make(map[string]bool)
+		p, _ := u["providers"].(map[string]interface{})
+		for name := range p {
+			providers[name] = true
+		}
+	}
+
+	nodes, ok := raw["EVM_NODES"].([]interface{})
+	if !ok || len(nodes) == 0 {
+		_err("$.EVM_NODES", "define at least one node")
+	}
+	seen := make(map[string]int)
+	for num, v := range nodes {
+		path := fmt.Sprintf("$.EVM_NODES[%d]", num)
+		node, ok := v.(map[string]interface{})
+		if !ok {
+			_err(path, "expected object, got %s", _config_type(v))
+			continue
+		}
+		ret = append(ret, NodeConfigCheck(path, node, providers)...)
+		key := _config_node_key(node)
+		if prev, ok := seen[key]; ok {
+			_err(path, "duplicate of node $.EVM_NODES[%d], nodes need different url or header", prev)
+			continue
+		}
+		seen[key] = num
+	}
+	return ret
+}
+
+// node attributes and their types, numbers need to be integers
+var node_attrs = map[string]string{
+	"url":            "string",
+	"public":         "bool",
+	"score_modifier": "int",
+	"probe_time":     "int",
+	"header":         "string",
+	"tags":           "string",
+	"provider":       "string",
+	"throttle":       "string",
+	"auth":           "object",
+}
+
+// NodeConfigCheck validates node from EVM_NODES, every problem is returned,
+// not only the first one. Providers are names defined in USAGE section,
+// nil if usage accounting is not configured
+func NodeConfigCheck(path string, node map[string]interface{}, providers map[string]bool) []ConfigError {
+	ret := make([]ConfigError, 0)
+	_err := func(attr string, format string, a ...interface{}) {
+		ret = append(ret, ConfigError{Path: config.PathKey(path, attr), Message: fmt.Sprintf(format, a...)})
+	}
+
+	// attributes with invalid type are skipped in further checks
+	_node := node
+	node = make(map[string]interface{}, len(_node))
+	for _, attr := range _sorted_keys(_node) {
+		node[attr] = _node[attr]
+		kind, ok := node_attrs[attr]
+		if !ok {
+			_err(attr, "unknown node attribute")
+			continue
+		}
+		val := node[attr]
+		switch kind {
+		case "string":
+			_, ok = val.(string)
+		case "bool":
+			_, ok = val.(bool)
+		case "int":
+			n, _ok := val.(json.Number)
+			_, err := n.Int64()
+			ok = _ok && err == nil
+		case "object":
+			_, ok = val.(map[string]interface{})
+		}
+		if !ok {
+			_err(attr, "expected %s, got %s", kind, _config_type(val))
+			delete(node, attr)
+		}
+	}
+
+	url, _ := node["url"].(string)
+	header_raw, _ := node["header"].(string)
+	if len(strings.TrimSpace(url)) == 0 {
+		_err("url", "node url is required")
+	} else if endpoint, _, err := _resolve_node_secrets(url, header_raw); err != nil {
+		_err("url", "can't resolve secrets, %s", err)
+	} else if u, err := neturl.Parse(strings.TrimSpace(endpoint)); err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		_err("url", "invalid url, expected http:// or https:// address")
+	}
+
+	for num, line := range strings.Split(header_raw, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		if tmp := strings.SplitN(line, ":", 2); len(tmp) < 2 || len(strings.TrimSpace(tmp[0])) == 0 || len(strings.TrimSpace(tmp[1])) == 0 {
+			_err("header", "line %d: expected \"Name: value\"", num+1)
+		}
+	}
+
+	if n, ok := node["probe_time"].(json.Number); ok {
+		if v, _ := n.Int64(); v < -1 {
+			_err("probe_time", "expected -1 (default), 0 (no probing) or seconds")
+		}
+	}
+
+	if thr, ok := node["throttle"].(string); ok {
+		for num, line := range strings.Split(thr, "\n") {
+			line = strings.TrimSpace(line)
+			if len(line) == 0 || line[0] == '#' {
+				continue
+			}
+			if thr, logs := throttle.MakeFromConfig(line); thr == nil && len(logs) > 0 {
+				msg := logs[len(logs)-1]
+				if strings.Contains(line, ",") && !strings.Contains(line, ";") {
+					msg += ", throttle lines are type;max;time_seconds;score_modifier, eg. requests;100;60;0"
+				}
+				_err("throttle", "line %d: %s", num+1, msg)
+			}
+		}
+	}
+
+	if provider, ok := node["provider"].(string); ok && providers != nil && !providers[provider] {
+		_err("provider", "provider %s is not defined in USAGE.providers", provider)
+	}
+
+	if auth_raw, ok := node["auth"].(map[string]interface{}); ok {
+		if _, err := _resolve_node_auth(auth_raw); err != nil {
+			_err("auth", "%s", err)
+		}
+	}
+	return ret
+}
+
+// NodeProbe runs eth_chainId and eth_blockNumber on the node, the node
+// config needs to be valid
+func NodeProbe(node map[string]interface{}, timeout time.Duration) (string, int64, time.Duration, error) {
+	url, _ := node["url"].(string)
+	header_raw, _ := node["header"].(string)
+	endpoint, header, err := _resolve_node_secrets(url, header_raw)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	auth_raw, _ := node["auth"].(map[string]interface{})
+	auth, err := _resolve_node_auth(auth_raw)
+	if err != nil {
+		return "", 0, 0, err
+	}
+
+	hc := &http.Client{Timeout: timeout}
+	_call := func(method string) (string, error) {
+		body := fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"%s","params":[]}`, method)
+		req, err := http.NewRequest("POST", strings.TrimSpace(endpoint), bytes.NewReader([]byte(body)))
+		if err != nil {
+			return "", err
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if auth != nil {
+			auth.Apply(req)
+		}
+
+		resp, err := hc.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		data, err := io.ReadAll(io.LimitReader(resp.Body, 1024*64))
+		if err != nil {
+			return "", err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("%s: HTTP status %d", method, resp.StatusCode)
+		}
+
+		out := struct {
+			Result string
+			Error  *struct {
+				Code    int
+				Message string
+			}
+		}{}
+		if err := json.Unmarshal(data, &out); err != nil {
+			return "", fmt.Errorf("%s: invalid response, %s", method, err)
+		}
+		if out.Error != nil {
+			return "", fmt.Errorf("%s: error %d %s", method, out.Error.Code, out.Error.Message)
+		}
+		if len(out.Result) == 0 {
+			return "", fmt.Errorf("%s: empty result", method)
+		}
+		return out.Result, nil
+	}
+
+	started := time.Now()
+	chain_id, err := _call("eth_chainId")
+	if err != nil {
+		return "", 0, 0, err
+	}
+	block_hex, err := _call("eth_blockNumber")
+	if err != nil {
+		return chain_id, 0, 0, err
+	}
+	block, err := strconv.ParseInt(strings.TrimPrefix(block_hex, "0x"), 16, 64)
+	if err != nil {
+		return chain_id, 0, 0, fmt.Errorf("eth_blockNumber: invalid block number %s", block_hex)
+	}
+	return chain_id, block, time.Since(started), nil
+}
+
+func _sorted_keys(m map[string]interface{}) []string {
+	ret := make([]string, 0, len(m))
+	for k := range m {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func _config_type(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "int"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", val)
+}
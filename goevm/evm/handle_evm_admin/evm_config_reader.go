@@ -2,7 +2,6 @@ package handle_evm_admin
 
 import (
 	"encoding/json"
-	"fmt"
 	"goevm/evm_proxy"
 	"goevm/evm_proxy/client"
 	"goevm/evm_proxy/client/throttle"
@@ -10,9 +9,13 @@ import (
 	"net/http"
 	"reflect"
 	"strings"
+
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/hslog"
 )
 
-func NodeRegister(endpoint string, header http.Header, public bool, probe_time int, throttle []*throttle.Throttle) *client.EVMClient {
+var log_config = hslog.Get("config")
+
+func NodeRegister(endpoint string, header http.Header, auth *client.Auth, public bool, probe_time int, throttle []*throttle.Throttle, tags []string) *client.EVMClient {
 	if len(endpoint) == 0 {
 		return nil
 	}
@@ -22,54 +25,45 @@ func NodeRegister(endpoint string, header http.Header, public bool, probe_time i
 	}
 	endpoint = strings.Trim(endpoint, "\r\n\t ")
 
-	if probe_time == -1 {
-		if public {
-			probe_time = 10
-		} else {
-			probe_time = 1
-		}
-	}
-
-	cl := client.MakeClient(endpoint, header, public, probe_time, max_conn, throttle)
+	probe_time = _probe_time_default(probe_time, public)
+	cl := client.MakeClient(endpoint, header, auth, public, probe_time, max_conn, throttle)
+	cl.SetTags(tags)
 	evm_proxy.ClientManage(cl, math.MaxUint64)
 	return cl
 }
 
+func _probe_time_default(probe_time int, public bool) int {
+	if probe_time != -1 {
+		return probe_time
+	}
+	if public {
+		return 10
+	}
+	return 1
+}
+
 func _get_cfg_data[T any](node map[string]interface{}, attr string, def T) T {
 	if val, ok := node[attr]; ok {
 		switch val.(type) {
 		case T:
 			return val.(T)
 		default:
-			fmt.Println("Warning: type mismatch for", attr, "attribute is", reflect.TypeOf(val).Name(), ", needs to be ", reflect.TypeOf(new(T)).Name())
+			log.Warn("Type mismatch in node config", "attr", attr, "type", reflect.TypeOf(val).Name(), "expected", reflect.TypeOf(new(T)).Name())
 		}
 	}
 	return def
 }
 
-func NodeRegisterFromConfig(node map[string]interface{}) *client.EVMClient {
-
-	url := _get_cfg_data(node, "url", "")
-	public := _get_cfg_data(node, "public", false)
-	score_modifier, _ := _get_cfg_data(node, "score_modifier", json.Number("0")).Int64()
-	probe_time, _ := _get_cfg_data(node, "probe_time", json.Number("-1")).Int64()
-	header := parseHeader(_get_cfg_data(node, "header", ""))
-
-	if url == "" {
-		fmt.Println("Cannot read node config (no url) ... skipping")
-		return nil
-	}
-
+// Throttle limits from node config, public nodes are throttled by default
+func _node_throttle(node map[string]interface{}, url string, public bool, score_modifier int) ([]*throttle.Throttle, []string) {
 	thr := ([]*throttle.Throttle)(nil)
 	logs := []string{}
-	fmt.Printf("## Node: %s Public: %v, score modifier: %d\n", url, public, score_modifier)
-
 	if val, ok := node["throttle"]; ok {
 		switch val.(type) {
 		case string:
 			thr, logs = throttle.MakeFromConfig(val.(string))
 		default:
-			fmt.Println("Warning: Cannot read throttle settings, skipping throttling")
+			log.Warn("Cannot read throttle settings, skipping throttling", "url", url)
 		}
 	} else {
 		if public {
@@ -82,11 +76,55 @@ func NodeRegisterFromConfig(node map[string]interface{}) *client.EVMClient {
 		thr = append(thr, throttle.Make())
 		logs = append(logs, "Throttling disabled")
 	}
-	throttle.ThrottleGoup(thr).SetScoreModifier(int(score_modifier))
+	throttle.ThrottleGoup(thr).SetScoreModifier(score_modifier)
+	return thr, logs
+}
+
+func NodeRegisterFromConfig(node map[string]interface{}) *client.EVMClient {
 
-	for _, log := range logs {
-		fmt.Println(" ", log)
+	url := _get_cfg_data(node, "url", "")
+	public := _get_cfg_data(node, "public", false)
+	score_modifier, _ := _get_cfg_data(node, "score_modifier", json.Number("0")).Int64()
+	probe_time, _ := _get_cfg_data(node, "probe_time", json.Number("-1")).Int64()
+	header_raw := _get_cfg_data(node, "header", "")
+	tags := parseTags(_get_cfg_data(node, "tags", ""))
+	provider := _get_cfg_data(node, "provider", "")
+
+	if url == "" {
+		log.Warn("Cannot read node config (no url), skipping")
+		return nil
 	}
 
-	return NodeRegister(url, header, public, int(probe_time), thr)
+	thr, logs := _node_throttle(node, url, public, int(score_modifier))
+
+	// url, header and auth can reference secrets, like ${env:NAME} or ${file:/path}
+	endpoint, header, err := _resolve_node_secrets(url, header_raw)
+	if err != nil {
+		log.Warn("Cannot resolve node secrets, skipping", "url", url, "err", err)
+		return nil
+	}
+	auth_raw, _ := node["auth"].(map[string]interface{})
+	auth, err := _resolve_node_auth(auth_raw)
+	if err != nil {
+		log.Warn("Cannot read node auth, skipping", "url", url, "err", err)
+		return nil
+	}
+	_auth_mode := "none"
+	if auth != nil {
+		_auth_mode, _ = auth.Describe()
+	}
+	log_config.Info("Node", "url", url, "public", public, "score_modifier", score_modifier, "auth", _auth_mode,
+		"provider", provider)
+	for _, l := range logs {
+		log_config.Info("Node throttle", "url", url, "throttle", l)
+	}
+
+	cl := NodeRegister(endpoint, header, auth, public, int(probe_time), thr, tags)
+	if cl != nil {
+		cl.SetEndpoint(endpoint, _endpoint_ref(url), header)
+		cl.SetProvider(provider)
+		cl.SetScoreModifier(int(score_modifier))
+		_secret_refs_add(cl, url, header_raw, auth_raw)
+	}
+	return cl
 }
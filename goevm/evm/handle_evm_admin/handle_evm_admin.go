@@ -5,7 +5,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"goevm/evm_proxy"
+	"goevm/evm_proxy/alert"
+	"goevm/evm_proxy/audit"
+	"goevm/evm_proxy/capture"
+	"goevm/evm_proxy/client"
+	"goevm/evm_proxy/usage"
 	"math"
+	"time"
 
 	"github.com/slawomir-pryczek/HSServer/handler_socket2"
 )
@@ -21,7 +27,9 @@ func (this *Handle_evm_admin) Info() string {
 }
 
 func (this *Handle_evm_admin) GetActions() []string {
-	return []string{"evm_admin", "evm_admin_remove", "evm_admin_add"}
+	return []string{"evm_admin", "evm_admin_remove", "evm_admin_add", "evm_admin_audit", "evm_admin_capture", "evm_admin_clear_errors",
+		"evm_admin_alert_test", "evm_admin_usage", "evm_admin_pause", "evm_admin_resume", "evm_admin_drain", "evm_admin_score",
+		"evm_admin_throttle", "evm_admin_probe_time", "evm_admin_public"}
 }
 
 func (this *Handle_evm_admin) HandleAction(action string, data *handler_socket2.HSParams) string {
@@ -46,9 +54,15 @@ func (this *Handle_evm_admin) HandleAction(action string, data *handler_socket2.
 		clients = append(clients, sch.GetAll(false, true)...)
 
 		out := make(map[string]interface{}, 0)
-		for _, client := range clients {
-			_tmp := client.GetInfo()
-			out[fmt.Sprintf("client_#%d", _tmp.ID)] = _tmp
+		for _, cl := range clients {
+			_tmp := cl.GetInfo()
+			_timeline, _availability := cl.GetTimeline()
+			out[fmt.Sprintf("client_#%d", _tmp.ID)] = struct {
+				*client.EVMClientinfo
+				Methods      map[string]client.MethodStats
+				Timeline     []client.TimelineEvent
+				Availability map[string]client.Availability
+			}{_tmp, cl.GetMethodStats(), _timeline, _availability}
 		}
 
 		_tmp, _ := json.Marshal(out)
@@ -62,13 +76,26 @@ func (this *Handle_evm_admin) HandleAction(action string, data *handler_socket2.
 			return "Please provide client's &id="
 		}
 
+		removed := _find_client(uint64(id))
 		if evm_proxy.ClientRemove(uint64(id)) {
+			_audit_node(removed, _admin_actor(data), "node_remove", "removed", data.GetParam("reason", ""))
+			if removed != nil {
+				go _node_drain(removed)
+			}
 			return ok(fmt.Sprintf("Removed client id: %d", id))
 		} else {
 			return err("Can't find client, nothing done")
 		}
 	}
 
+	if node_actions[action] {
+		res, _err := _node_action(action, data)
+		if _err != nil {
+			return err(_err.Error())
+		}
+		return ok(res)
+	}
+
 	if action == "evm_admin_add" {
 
 		id := data.GetParamI("remove_id", -1)
@@ -94,9 +121,145 @@ func (this *Handle_evm_admin) HandleAction(action string, data *handler_socket2.
 		if new_node == nil {
 			return err("Error creating new node, something went wrong. Please check URL and config")
 		}
-		evm_proxy.ClientRemove(node_id)
+		_audit_node(new_node, _admin_actor(data), "node_add", "added", data.GetParam("reason", ""))
+		removed := _find_client(node_id)
+		if evm_proxy.ClientRemove(node_id) {
+			_audit_node(removed, _admin_actor(data), "node_remove", "removed",
+				fmt.Sprintf("Replaced by node #%d", new_node.GetInfo().ID))
+			if removed != nil {
+				go _node_drain(removed)
+			}
+		}
 		return ok(new_node.GetInfo())
 	}
 
+	if action == "evm_admin_audit" {
+		f := audit.Filter{}
+		f.NodeID = uint64(data.GetParamI("node_id", 0))
+		f.Actor = data.GetParam("actor", "")
+		f.Action = data.GetParam("audit_action", "")
+		f.Since = int64(data.GetParamI("since", 0))
+		f.Limit = data.GetParamI("limit", 100)
+		return ok(audit.Query(f))
+	}
+
+	// clear error history of the node, or of all nodes if id is not provided
+	if action == "evm_admin_clear_errors" {
+		id := data.GetParamI("id", -1)
+		sch := evm_proxy.MakeScheduler()
+		cleared := make(map[string]int)
+		for _, cl := range append(sch.GetAll(true, true), sch.GetAll(false, true)...) {
+			if id >= 0 && cl.GetID() != uint64(id) {
+				continue
+			}
+			cleared[fmt.Sprintf("client_#%d", cl.GetID())] = cl.ClearErrors()
+		}
+		if len(cleared) == 0 {
+			return err("Can't find client, nothing done")
+		}
+		log.Info("Error history cleared", "admin", _admin_actor(data), "nodes", len(cleared))
+		return ok(cleared)
+	}
+
+	// send test alert to one target or to all of them, skipping debounce
+	if action == "evm_admin_alert_test" {
+		msg := data.GetParam("message", "Test alert sent by "+_admin_actor(data))
+		res, _err := alert.Test(data.GetParam("target", ""), msg)
+		if _err != nil {
+			return err(_err.Error())
+		}
+		return ok(res)
+	}
+
+	// captures are returned as JSON lines, newest first
+	if action == "evm_admin_capture" {
+		if !capture.IsEnabled() {
+			return err("Capture is disabled, add CAPTURE section to the config")
+		}
+		f := capture.Filter{}
+		f.NodeID = uint64(data.GetParamI("node_id", 0))
+		f.Method = data.GetParam("method", "")
+		f.Kind = data.GetParam("kind", "")
+		f.Since = int64(data.GetParamI("since", 0))
+		f.Limit = data.GetParamI("limit", 100)
+
+		out := bytes.Buffer{}
+		enc := json.NewEncoder(&out)
+		enc.SetEscapeHTML(false)
+		for _, e := range capture.Query(f) {
+			enc.Encode(e)
+		}
+		data.SetRespHeader("Content-Type", "application/x-ndjson")
+		if data.GetParamI("download", 0) == 1 {
+			data.SetRespHeader("Content-Disposition", "attachment; filename=\"capture.jsonl\"")
+		}
+		data.FastReturnBNocopy(out.Bytes())
+		return ""
+	}
+
+	// usage from first day of the month until today (UTC) by default, as
+	// daily rows or totals over the range (group=total)
+	if action == "evm_admin_usage" {
+		if !usage.IsEnabled() {
+			return err("Usage accounting is disabled, add USAGE section to the config")
+		}
+		now := time.Now().UTC()
+		from := data.GetParam("from", now.AddDate(0, 0, 1-now.Day()).Format(usage.DATE_FORMAT))
+		to := data.GetParam("to", now.Format(usage.DATE_FORMAT))
+		group := data.GetParam("group", "day")
+		if group != "day" && group != "total" {
+			return err("Unknown group " + group + ", use day or total")
+		}
+		rows, _err := usage.Query(from, to, data.GetParam("kind", ""), group == "total")
+		if _err != nil {
+			return err(_err.Error())
+		}
+
+		format := data.GetParam("format", "json")
+		if format != "json" && format != "csv" {
+			return err("Unknown format " + format + ", use json or csv")
+		}
+		if format == "json" {
+			return ok(rows)
+		}
+		data.SetRespHeader("Content-Type", "text/csv")
+		if data.GetParamI("download", 0) == 1 {
+			data.SetRespHeader("Content-Disposition", fmt.Sprintf("attachment; filename=\"usage-%s-%s.csv\"", from, to))
+		}
+		data.FastReturnBNocopy(usage.CSV(rows))
+		return ""
+	}
+
 	return err("Something went wrong in admin module")
 }
+
+func _find_client(id uint64) *client.EVMClient {
+	sch := evm_proxy.MakeScheduler()
+	for _, cl := range append(sch.GetAll(true, true), sch.GetAll(false, true)...) {
+		if cl.GetInfo().ID == id {
+			return cl
+		}
+	}
+	return nil
+}
+
+// Admin's name and IP, as set by the auth guard
+func _admin_actor(data *handler_socket2.HSParams) string {
+	return "admin:" + data.GetParam("__admin", "-") + "@" + data.GetParam("__client_ip", data.GetParam("__remote_addr", ""))
+}
+
+func _audit_node(cl *client.EVMClient, actor, action, after, reason string) {
+	if cl == nil {
+		return
+	}
+	info := cl.GetInfo()
+	before := "-"
+	if action == "node_remove" {
+		before = "active"
+		if info.Is_paused {
+			before = "paused"
+		}
+	}
+	audit.Log(audit.Entry{Actor: actor, Action: action, NodeID: info.ID, Endpoint: info.Endpoint,
+		Before: before, After: after, Reason: reason})
+}
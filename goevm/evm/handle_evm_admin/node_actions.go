@@ -0,0 +1,132 @@
+package handle_evm_admin
+
+import (
+	"errors"
+	"fmt"
+	"goevm/evm_proxy/audit"
+	"goevm/evm_proxy/client"
+	"goevm/evm_proxy/client/throttle"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/slawomir-pryczek/HSServer/handler_socket2"
+)
+
+// Actions which change the node in place, so its stats and ID are kept.
+// Changes are lost when the node is updated after a change of the config
+// file, except of the manual pause
+var node_actions = map[string]bool{
+	"evm_admin_pause":      true,
+	"evm_admin_resume":     true,
+	"evm_admin_drain":      true,
+	"evm_admin_score":      true,
+	"evm_admin_throttle":   true,
+	"evm_admin_probe_time": true,
+	"evm_admin_public":     true,
+}
+
+const drain_timeout_max = 300
+
+func _node_action(action string, data *handler_socket2.HSParams) (interface{}, error) {
+	id := data.GetParamI("id", -1)
+	if id < 0 {
+		return nil, errors.New("Please provide client's &id=")
+	}
+	cl := _find_client(uint64(id))
+	if cl == nil {
+		return nil, fmt.Errorf("Can't find client #%d", id)
+	}
+
+	actor := _admin_actor(data)
+	reason := data.GetParam("reason", "")
+	info := cl.GetInfo()
+	_int := func(param string) (int, error) {
+		v, err := strconv.Atoi(data.GetParam(param, ""))
+		if err != nil {
+			return 0, fmt.Errorf("Please provide &%s= as integer", param)
+		}
+		return v, nil
+	}
+
+	switch action {
+	case "evm_admin_pause":
+		if len(reason) == 0 {
+			reason = "Paused by " + actor
+		}
+		cl.SetPausedManual(actor, true, reason)
+
+	case "evm_admin_resume":
+		cl.SetPausedManual(actor, false, reason)
+
+	// pause the node, so it gets no new requests, and wait for requests in
+	// progress to finish. The node stays paused until it's resumed
+	case "evm_admin_drain":
+		timeout := data.GetParamI("timeout", int(drain_timeout/time.Second))
+		if timeout < 0 || timeout > drain_timeout_max {
+			return nil, fmt.Errorf("Timeout needs to be between 0 and %d seconds", drain_timeout_max)
+		}
+		_reason := "Draining, requested by " + actor
+		if len(reason) > 0 {
+			_reason += ", " + reason
+		}
+		cl.SetPausedManual(actor, true, _reason)
+
+		started := time.Now()
+		drained := _node_wait_idle(cl, time.Duration(timeout)*time.Second)
+		log.Info("Node drain", "node", info.ID, "admin", actor, "drained", drained, "running", cl.GetRunning())
+		return map[string]interface{}{"id": info.ID, "drained": drained, "running": cl.GetRunning(),
+			"waited_ms": time.Since(started).Milliseconds()}, nil
+
+	case "evm_admin_score":
+		score_modifier, err := _int("score_modifier")
+		if err != nil {
+			return nil, err
+		}
+		cl.SetScoreModifier(score_modifier)
+		_audit_node_change(cl, actor, "node_score", info.Score_modifier, score_modifier, reason)
+
+	// lines are separated with new line, empty throttle restores defaults
+	case "evm_admin_throttle":
+		cfg := data.GetParam("throttle", "")
+		node := map[string]interface{}{}
+		if len(strings.TrimSpace(cfg)) > 0 {
+			if thr, logs := throttle.MakeFromConfig(cfg); thr == nil {
+				return nil, errors.New(strings.Join(logs, "; "))
+			}
+			node["throttle"] = cfg
+		}
+		thr, logs := _node_throttle(node, info.Endpoint, info.Is_public_node, info.Score_modifier)
+		cl.SetThrottle(thr)
+		_audit_node_change(cl, actor, "node_throttle", "-", strings.Join(logs, "; "), reason)
+
+	case "evm_admin_probe_time":
+		probe_time, err := _int("probe_time")
+		if err != nil {
+			return nil, err
+		}
+		if probe_time < -1 {
+			return nil, errors.New("Probe time needs to be -1 (default), 0 (no probing) or seconds")
+		}
+		probe_time = _probe_time_default(probe_time, info.Is_public_node)
+		cl.SetProbeTime(probe_time)
+		_audit_node_change(cl, actor, "node_probe_time", info.Probe_time, probe_time, reason)
+
+	case "evm_admin_public":
+		public := data.GetParamI("public", -1)
+		if public != 0 && public != 1 {
+			return nil, errors.New("Please provide &public=1 or &public=0")
+		}
+		cl.SetPublic(public == 1)
+		_audit_node_change(cl, actor, "node_public", info.Is_public_node, public == 1, reason)
+	}
+
+	return cl.GetInfo(), nil
+}
+
+func _audit_node_change(cl *client.EVMClient, actor, action string, before, after interface{}, reason string) {
+	info := cl.GetInfo()
+	log.Info("Node changed", "node", info.ID, "admin", actor, "action", action, "before", before, "after", after)
+	audit.Log(audit.Entry{Actor: actor, Action: action, NodeID: info.ID, Endpoint: info.Endpoint,
+		Before: fmt.Sprint(before), After: fmt.Sprint(after), Reason: reason})
+}
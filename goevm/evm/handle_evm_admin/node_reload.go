@@ -0,0 +1,196 @@
+package handle_evm_admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"goevm/evm_proxy"
+	"goevm/evm_proxy/audit"
+	"goevm/evm_proxy/client"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/config"
+)
+
+// Nodes defined in EVM_NODES, by URL and header as written in the config
+// (before secrets are resolved). When the config file changes, new nodes
+// are registered, removed ones are drained and other changes are applied
+// to the running clients, so stats are kept
+type config_node struct {
+	cl   *client.EVMClient
+	node map[string]interface{}
+	raw  string
+}
+
+var config_nodes_mu sync.Mutex
+var config_nodes = make(map[string]*config_node)
+var config_nodes_once sync.Once
+
+// removed nodes get no new requests, they're closed after requests in
+// progress finish or after the timeout
+const drain_timeout = 30 * time.Second
+
+// NodesFromConfig registers nodes from EVM_NODES and keeps them in sync
+// with the config file, returns the number of nodes registered
+func NodesFromConfig() int {
+	config_nodes_mu.Lock()
+	n := _config_nodes_sync(false)
+	config_nodes_mu.Unlock()
+
+	config_nodes_once.Do(func() {
+		config.AttachOnChange(_config_nodes_reload)
+	})
+	return n
+}
+
+func _config_nodes_reload() {
+	config_nodes_mu.Lock()
+	defer config_nodes_mu.Unlock()
+	_config_nodes_sync(true)
+}
+
+func _config_node_key(node map[string]interface{}) string {
+	url, _ := node["url"].(string)
+	header, _ := node["header"].(string)
+	return strings.Trim(url, "\r\n\t ") + "\n" + header
+}
+
+// config_nodes_mu needs to be locked
+func _config_nodes_sync(reload bool) int {
+	nodes, _ := config.Config().GetRawData("EVM_NODES", "").([]interface{})
+	if len(nodes) == 0 {
+		if reload {
+			log.Warn("No nodes defined in the config, keeping current nodes")
+		}
+		return len(config_nodes)
+	}
+
+	// nodes removed or replaced by admin stay removed until their config
+	// entry changes, update scripts rewrite the file even if nothing changed
+	managed := make(map[*client.EVMClient]bool)
+	sch := evm_proxy.MakeScheduler()
+	for _, cl := range append(sch.GetAll(true, true), sch.GetAll(false, true)...) {
+		managed[cl] = true
+	}
+
+	added, updated, removed := 0, 0, 0
+	seen := make(map[string]bool)
+	for _, v := range nodes {
+		node, ok := v.(map[string]interface{})
+		if !ok {
+			log.Warn("Cannot read node config (not an object), skipping")
+			continue
+		}
+		key := _config_node_key(node)
+		if seen[key] {
+			log.Warn("Duplicate node in config, skipping", "url", strings.Split(key, "\n")[0])
+			continue
+		}
+		seen[key] = true
+		raw, _ := json.Marshal(node)
+
+		cn, ok := config_nodes[key]
+		if ok && !managed[cn.cl] {
+			if cn.raw == string(raw) {
+				continue
+			}
+			delete(config_nodes, key)
+			ok = false
+		}
+		if !ok {
+			cl := NodeRegisterFromConfig(node)
+			if cl == nil {
+				continue
+			}
+			config_nodes[key] = &config_node{cl: cl, node: node, raw: string(raw)}
+			if reload {
+				_audit_node(cl, audit.ACTOR_CONFIG, "node_add", "added", "Added to config")
+				added++
+			}
+			continue
+		}
+
+		if cn.raw == string(raw) {
+			continue
+		}
+		if _node_update_from_config(cn, node) {
+			cn.node = node
+			cn.raw = string(raw)
+			updated++
+		}
+	}
+
+	for key, cn := range config_nodes {
+		if seen[key] {
+			continue
+		}
+		delete(config_nodes, key)
+		if managed[cn.cl] && evm_proxy.ClientRemove(cn.cl.GetID()) {
+			_audit_node(cn.cl, audit.ACTOR_CONFIG, "node_remove", "removed", "Removed from config")
+			go _node_drain(cn.cl)
+			removed++
+		}
+	}
+
+	if added+updated+removed > 0 {
+		log.Info("Nodes reloaded from config", "added", added, "updated", updated, "removed", removed, "nodes", len(config_nodes))
+	}
+	return len(config_nodes)
+}
+
+// Apply changed settings to the running client, throttle limits are only
+// replaced if they changed, as their usage is lost
+func _node_update_from_config(cn *config_node, node map[string]interface{}) bool {
+	url := _get_cfg_data(node, "url", "")
+	public := _get_cfg_data(node, "public", false)
+	score_modifier, _ := _get_cfg_data(node, "score_modifier", json.Number("0")).Int64()
+	probe_time, _ := _get_cfg_data(node, "probe_time", json.Number("-1")).Int64()
+	header_raw := _get_cfg_data(node, "header", "")
+	tags := parseTags(_get_cfg_data(node, "tags", ""))
+	provider := _get_cfg_data(node, "provider", "")
+
+	auth_raw, _ := node["auth"].(map[string]interface{})
+	auth, err := _resolve_node_auth(auth_raw)
+	if err != nil {
+		log.Warn("Cannot read node auth, keeping old settings", "url", url, "err", err)
+		return false
+	}
+
+	cl := cn.cl
+	if fmt.Sprint(cn.node["throttle"]) != fmt.Sprint(node["throttle"]) || cl.GetInfo().Is_public_node != public {
+		thr, logs := _node_throttle(node, url, public, int(score_modifier))
+		cl.SetThrottle(thr)
+		log.Info("Node throttle changed", "node", cl.GetID(), "settings", strings.Join(logs, "; "))
+	}
+	cl.SetScoreModifier(int(score_modifier))
+	cl.SetPublic(public)
+	cl.SetProbeTime(_probe_time_default(int(probe_time), public))
+	cl.SetTags(tags)
+	cl.SetProvider(provider)
+	cl.SetAuth(auth)
+
+	_secret_refs_remove(cl)
+	_secret_refs_add(cl, url, header_raw, auth_raw)
+	log.Info("Node config updated", "node", cl.GetID(), "url", cl.GetEndpoint())
+	return true
+}
+
+// _node_wait_idle waits until requests in progress finish, returns false
+// on timeout
+func _node_wait_idle(cl *client.EVMClient, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for cl.GetRunning() > 0 {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return true
+}
+
+func _node_drain(cl *client.EVMClient) {
+	_node_wait_idle(cl, drain_timeout)
+	cl.Close()
+	log.Info("Node drained", "node", cl.GetID(), "url", cl.GetEndpoint(), "running", cl.GetRunning())
+}
@@ -17,7 +17,7 @@ func parseHeader(s string) http.Header {
 		}
 		v = rxNewline.ReplaceAllString(v, "")
 
-		tmp := strings.Split(v, ":")
+		tmp := strings.SplitN(v, ":", 2)
 		if len(tmp) < 2 {
 			continue
 		}
@@ -33,3 +33,15 @@ func parseHeader(s string) http.Header {
 	}
 	return http.Header(h)
 }
+
+func parseTags(s string) []string {
+	ret := make([]string, 0)
+	for _, v := range strings.Split(s, ",") {
+		v = strings.Trim(v, "\r\n\t ")
+		if len(v) == 0 {
+			continue
+		}
+		ret = append(ret, v)
+	}
+	return ret
+}
@@ -0,0 +1,128 @@
+package handle_evm_admin
+
+import (
+	"encoding/json"
+	"goevm/evm_proxy"
+	"goevm/evm_proxy/client"
+	"net/http"
+	"sync"
+
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/config"
+)
+
+// Nodes which have secret references in URL or headers, references are
+// resolved again after the config is re-read, so rotated secrets are used
+type secret_ref struct {
+	url    string
+	header string
+	auth   map[string]interface{}
+}
+
+var secret_refs_mu sync.Mutex
+var secret_refs = make(map[*client.EVMClient]secret_ref)
+var secret_refs_once sync.Once
+
+func _resolve_node_secrets(url, header string) (string, http.Header, error) {
+	_url, err := config.ResolveSecrets(url)
+	if err != nil {
+		return "", nil, err
+	}
+
+	h := parseHeader(header)
+	for k, v := range h {
+		for num, vv := range v {
+			if h[k][num], err = config.ResolveSecrets(vv); err != nil {
+				return "", nil, err
+			}
+		}
+	}
+	return _url, h, nil
+}
+
+// URL with references is displayed instead of the real one
+func _endpoint_ref(url string) string {
+	if config.HasSecretRefs(url) {
+		return url
+	}
+	return ""
+}
+
+// Read node's auth block, values can reference secrets
+func _resolve_node_auth(raw map[string]interface{}) (*client.Auth, error) {
+	if raw == nil {
+		return nil, nil
+	}
+
+	cfg := make(map[string]string)
+	for k, v := range raw {
+		switch v := v.(type) {
+		case string:
+			_v, err := config.ResolveSecrets(v)
+			if err != nil {
+				return nil, err
+			}
+			cfg[k] = _v
+		case json.Number:
+			cfg[k] = v.String()
+		}
+	}
+	return client.MakeAuth(cfg)
+}
+
+func _auth_has_secret_refs(raw map[string]interface{}) bool {
+	for _, v := range raw {
+		if _v, ok := v.(string); ok && config.HasSecretRefs(_v) {
+			return true
+		}
+	}
+	return false
+}
+
+func _secret_refs_add(cl *client.EVMClient, url, header string, auth map[string]interface{}) {
+	if !config.HasSecretRefs(url) && !config.HasSecretRefs(header) && !_auth_has_secret_refs(auth) {
+		return
+	}
+
+	secret_refs_mu.Lock()
+	secret_refs[cl] = secret_ref{url: url, header: header, auth: auth}
+	secret_refs_mu.Unlock()
+
+	secret_refs_once.Do(func() {
+		config.AttachOnChange(_secret_refs_reload)
+	})
+}
+
+func _secret_refs_remove(cl *client.EVMClient) {
+	secret_refs_mu.Lock()
+	delete(secret_refs, cl)
+	secret_refs_mu.Unlock()
+}
+
+func _secret_refs_reload() {
+	managed := make(map[*client.EVMClient]bool)
+	sch := evm_proxy.MakeScheduler()
+	for _, cl := range append(sch.GetAll(true, true), sch.GetAll(false, true)...) {
+		managed[cl] = true
+	}
+
+	secret_refs_mu.Lock()
+	defer secret_refs_mu.Unlock()
+	for cl, ref := range secret_refs {
+		if !managed[cl] {
+			delete(secret_refs, cl)
+			continue
+		}
+
+		url, header, err := _resolve_node_secrets(ref.url, ref.header)
+		auth := (*client.Auth)(nil)
+		if err == nil {
+			auth, err = _resolve_node_auth(ref.auth)
+		}
+		if err != nil {
+			log.Warn("Can't re-resolve secrets for node", "url", ref.url, "err", err)
+			continue
+		}
+		cl.SetEndpoint(url, _endpoint_ref(ref.url), header)
+		cl.SetAuth(auth)
+	}
+}
@@ -0,0 +1,138 @@
+package rawtx
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"goevm/evm/rlp"
+	"math/big"
+)
+
+const (
+	TX_LEGACY      = 0
+	TX_ACCESS_LIST = 1
+	TX_DYNAMIC_FEE = 2
+	TX_BLOB        = 3
+	TX_SET_CODE    = 4
+)
+
+// Tx is the part of signed transaction which is inspected by the proxy
+type Tx struct {
+	Type    int
+	ChainID *big.Int // nil for legacy transactions without replay protection
+	Nonce   uint64
+	To      string // empty for contract creation
+	Value   *big.Int
+	Gas     uint64
+	Blobs   int
+}
+
+// Positions of the fields in transaction's RLP list, and number of fields
+type tx_layout struct {
+	fields, chain_id, nonce, gas, to, value int
+}
+
+var tx_layouts = map[int]tx_layout{
+	TX_LEGACY:      {fields: 9, chain_id: -1, nonce: 0, gas: 2, to: 3, value: 4},
+	TX_ACCESS_LIST: {fields: 11, chain_id: 0, nonce: 1, gas: 3, to: 4, value: 5},
+	TX_DYNAMIC_FEE: {fields: 12, chain_id: 0, nonce: 1, gas: 4, to: 5, value: 6},
+	TX_BLOB:        {fields: 14, chain_id: 0, nonce: 1, gas: 4, to: 5, value: 6},
+	TX_SET_CODE:    {fields: 13, chain_id: 0, nonce: 1, gas: 4, to: 5, value: 6},
+}
+
+// Decode decodes signed transaction as passed to eth_sendRawTransaction,
+// legacy and typed (EIP-2718) envelopes are supported. Blob transactions
+// can be in network form, with blobs, commitments and proofs
+func Decode(raw []byte) (*Tx, error) {
+	if len(raw) == 0 {
+		return nil, errors.New("empty transaction")
+	}
+
+	ret := &Tx{Type: TX_LEGACY}
+	if raw[0] <= 0x7f {
+		ret.Type = int(raw[0])
+		raw = raw[1:]
+	}
+	layout, ok := tx_layouts[ret.Type]
+	if !ok {
+		return nil, fmt.Errorf("unsupported transaction type %d", ret.Type)
+	}
+
+	item, err := rlp.Decode(raw)
+	if err != nil {
+		return nil, err
+	}
+	if !item.IsList {
+		return nil, errors.New("transaction is not a list")
+	}
+
+	// network form of blob transaction: [tx, blobs, commitments, proofs]
+	// or [tx, wrapper_version, blobs, commitments, cell_proofs]
+	if ret.Type == TX_BLOB && len(item.List) > 1 && item.List[0].IsList {
+		blobs := item.List[1]
+		if !blobs.IsList && len(item.List) > 2 {
+			blobs = item.List[2]
+		}
+		ret.Blobs = len(blobs.List)
+		item = &item.List[0]
+	}
+
+	fields := item.List
+	if len(fields) != layout.fields {
+		return nil, fmt.Errorf("transaction type %d needs %d fields, got %d", ret.Type, layout.fields, len(fields))
+	}
+
+	if ret.Nonce, err = fields[layout.nonce].Uint64(); err != nil {
+		return nil, fmt.Errorf("nonce: %s", err.Error())
+	}
+	if ret.Gas, err = fields[layout.gas].Uint64(); err != nil {
+		return nil, fmt.Errorf("gas: %s", err.Error())
+	}
+	if ret.Value, err = fields[layout.value].BigInt(); err != nil {
+		return nil, fmt.Errorf("value: %s", err.Error())
+	}
+
+	to := fields[layout.to]
+	switch {
+	case to.IsList || (len(to.Bytes) != 0 && len(to.Bytes) != 20):
+		return nil, errors.New("to: invalid address")
+	case len(to.Bytes) == 20:
+		ret.To = "0x" + hex.EncodeToString(to.Bytes)
+	case ret.Type == TX_BLOB || ret.Type == TX_SET_CODE:
+		return nil, fmt.Errorf("to: transaction type %d can't create contracts", ret.Type)
+	}
+
+	if layout.chain_id >= 0 {
+		if ret.ChainID, err = fields[layout.chain_id].BigInt(); err != nil {
+			return nil, fmt.Errorf("chainId: %s", err.Error())
+		}
+		return ret, nil
+	}
+
+	// legacy, EIP-155 v = chainId * 2 + 35 + {0, 1}
+	v, err := fields[6].BigInt()
+	if err != nil {
+		return nil, fmt.Errorf("v: %s", err.Error())
+	}
+	if v.Cmp(big.NewInt(35)) >= 0 {
+		ret.ChainID = new(big.Int).Rsh(new(big.Int).Sub(v, big.NewInt(35)), 1)
+	}
+	return ret, nil
+}
+
+func (this *Tx) String() string {
+	_chain_id, _to := "-", this.To
+	if this.ChainID != nil {
+		_chain_id = this.ChainID.String()
+	}
+	if len(_to) == 0 {
+		_to = "(contract creation)"
+	}
+
+	ret := fmt.Sprintf("type: %d, chainId: %s, nonce: %d, to: %s, value: %s, gas: %d",
+		this.Type, _chain_id, this.Nonce, _to, this.Value.String(), this.Gas)
+	if this.Blobs > 0 {
+		ret += fmt.Sprintf(", blobs: %d", this.Blobs)
+	}
+	return ret
+}
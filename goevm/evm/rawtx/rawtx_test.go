@@ -0,0 +1,156 @@
+package rawtx
+
+import (
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// Legacy vectors are the EIP-155 example transaction and the keyless
+// deployment transaction of the deterministic deployment proxy (pre EIP-155).
+// Typed transactions are encoded field by field as defined in EIP-2930,
+// EIP-1559, EIP-4844 and EIP-7702, with placeholder signatures (signatures
+// are not verified by the proxy) and blobs shortened to 64 bytes
+const (
+	tx_eip155 = "f86c098504a817c800825208943535353535353535353535353535353535353535880de0b6b3a76400008025a028ef61340b" +
+		"d939bc2195fe537567866003e1a15d3c71ff63e1590620aa636276a067cbe9d8997f761aecb703304b3800ccf555c9f3dc64" +
+		"214b297fb1966a3b6d83"
+	tx_pre_eip155 = "f8a58085174876e800830186a08080b853604580600e600039806000f350fe7fffffffffffffffffffffffffffffffffffff" +
+		"ffffffffffffffffffffffffffe03601600081602082378035828234f58015156039578182fd5b8082525050506014600cf3" +
+		"1ba02222222222222222222222222222222222222222222222222222222222222222a0222222222222222222222222222222" +
+		"2222222222222222222222222222222222"
+	tx_2930 = "01f8ca01078504a817c80082c35094d8da6bf26964af9d7eed9e03e53415d37aa9604588016345785d8a000080f85bf85994" +
+		"de0b295669a9fd93d5f28d9ec85e40f4cb697baef842a0000000000000000000000000000000000000000000000000000000" +
+		"0000000003a0000000000000000000000000000000000000000000000000000000000000000701a011111111111111111111" +
+		"11111111111111111111111111111111111111111111a0222222222222222222222222222222222222222222222222222222" +
+		"2222222222"
+	tx_1559 = "02f87481890c847735940085174876e80082520894d8da6bf26964af9d7eed9e03e53415d37aa96045880de0b6b3a7640000" +
+		"80c080a01111111111111111111111111111111111111111111111111111111111111111a022222222222222222222222222" +
+		"22222222222222222222222222222222222222"
+	tx_1559_create = "02f85101800102830f42408080826000c001a011111111111111111111111111111111111111111111111111111111111111" +
+		"11a02222222222222222222222222222222222222222222222222222222222222222"
+	tx_4844 = "03f8b40103843b9aca008506fc23ac0082520894d8da6bf26964af9d7eed9e03e53415d37aa960458080c0843b9aca00f842" +
+		"a001aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa001bbbbbbbbbbbbbbbbbbbbbbbbbbbbbb" +
+		"bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb80a01111111111111111111111111111111111111111111111111111111111111111" +
+		"a02222222222222222222222222222222222222222222222222222222222222222"
+	tx_4844_network = "03f90204f8b40103843b9aca008506fc23ac0082520894d8da6bf26964af9d7eed9e03e53415d37aa960458080c0843b9aca" +
+		"00f842a001aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa001bbbbbbbbbbbbbbbbbbbbbbbb" +
+		"bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb80a01111111111111111111111111111111111111111111111111111111111" +
+		"111111a02222222222222222222222222222222222222222222222222222222222222222f884b840abababababababababab" +
+		"abababababababababababababababababababababababababababababababababababababababababababababababababab" +
+		"ababababb840cdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcd" +
+		"cdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdf862b0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0" +
+		"c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0b0c1c1c1c1c1c1c1c1c1c1c1c1c1c1c1c1c1c1c1c1c1c1c1c1c1c1c1c1" +
+		"c1c1c1c1c1c1c1c1c1c1c1c1c1c1c1c1c1c1c1c1f862b0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0" +
+		"e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0b0e1e1e1e1e1e1e1e1e1e1e1e1e1e1e1e1e1e1e1e1e1e1e1e1e1e1e1e1" +
+		"e1e1e1e1e1e1e1e1e1e1e1e1e1e1e1e1e1e1e1e1"
+	tx_4844_network_cell_proofs = "03f90267f8b40103843b9aca008506fc23ac0082520894d8da6bf26964af9d7eed9e03e53415d37aa960458080c0843b9aca" +
+		"00f842a001aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa001bbbbbbbbbbbbbbbbbbbbbbbb" +
+		"bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb80a01111111111111111111111111111111111111111111111111111111111" +
+		"111111a0222222222222222222222222222222222222222222222222222222222222222201f884b840ababababababababab" +
+		"abababababababababababababababababababababababababababababababababababababababababababababababababab" +
+		"abababababb840cdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcd" +
+		"cdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdf862b0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0" +
+		"c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0b0c1c1c1c1c1c1c1c1c1c1c1c1c1c1c1c1c1c1c1c1c1c1c1c1c1c1c1" +
+		"c1c1c1c1c1c1c1c1c1c1c1c1c1c1c1c1c1c1c1c1c1f8c4b0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0" +
+		"e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0b0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0" +
+		"e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0b0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0" +
+		"e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0b0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0" +
+		"e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0e0"
+	tx_7702 = "04f8ca0104843b9aca008504a817c8008301388094d8da6bf26964af9d7eed9e03e53415d37aa960458080c0f85cf85a0194" +
+		"63c0c19a282a1b52b07dd5a65b58948a07dae32b0501a0111111111111111111111111111111111111111111111111111111" +
+		"1111111111a0222222222222222222222222222222222222222222222222222222222222222201a011111111111111111111" +
+		"11111111111111111111111111111111111111111111a0222222222222222222222222222222222222222222222222222222" +
+		"2222222222"
+)
+
+func _big(s string) *big.Int {
+	ret, _ := new(big.Int).SetString(s, 10)
+	return ret
+}
+
+func TestDecode(t *testing.T) {
+	to := "0xd8da6bf26964af9d7eed9e03e53415d37aa96045"
+	tests := []struct {
+		name string
+		raw  string
+		want Tx
+	}{
+		{"legacy eip-155", tx_eip155, Tx{Type: TX_LEGACY, ChainID: big.NewInt(1), Nonce: 9, To: "0x3535353535353535353535353535353535353535", Value: _big("1000000000000000000"), Gas: 21000}},
+		{"legacy pre eip-155", tx_pre_eip155, Tx{Type: TX_LEGACY, Nonce: 0, Value: big.NewInt(0), Gas: 100000}},
+		{"access list", tx_2930, Tx{Type: TX_ACCESS_LIST, ChainID: big.NewInt(1), Nonce: 7, To: to, Value: _big("100000000000000000"), Gas: 50000}},
+		{"dynamic fee", tx_1559, Tx{Type: TX_DYNAMIC_FEE, ChainID: big.NewInt(137), Nonce: 12, To: to, Value: _big("1000000000000000000"), Gas: 21000}},
+		{"dynamic fee contract creation", tx_1559_create, Tx{Type: TX_DYNAMIC_FEE, ChainID: big.NewInt(1), Nonce: 0, Value: big.NewInt(0), Gas: 1000000}},
+		{"blob", tx_4844, Tx{Type: TX_BLOB, ChainID: big.NewInt(1), Nonce: 3, To: to, Value: big.NewInt(0), Gas: 21000}},
+		{"blob network form", tx_4844_network, Tx{Type: TX_BLOB, ChainID: big.NewInt(1), Nonce: 3, To: to, Value: big.NewInt(0), Gas: 21000, Blobs: 2}},
+		{"blob network form with cell proofs", tx_4844_network_cell_proofs, Tx{Type: TX_BLOB, ChainID: big.NewInt(1), Nonce: 3, To: to, Value: big.NewInt(0), Gas: 21000, Blobs: 2}},
+		{"set code", tx_7702, Tx{Type: TX_SET_CODE, ChainID: big.NewInt(1), Nonce: 4, To: to, Value: big.NewInt(0), Gas: 80000}},
+	}
+
+	for _, tt := range tests {
+		raw, _ := hex.DecodeString(tt.raw)
+		got, err := Decode(raw)
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", tt.name, err)
+			continue
+		}
+		if got.String() != tt.want.String() {
+			t.Errorf("%s: got %s, want %s", tt.name, got.String(), tt.want.String())
+		}
+		if (got.ChainID == nil) != (tt.want.ChainID == nil) {
+			t.Errorf("%s: got chainId %v, want %v", tt.name, got.ChainID, tt.want.ChainID)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		err  string
+	}{
+		{"empty", "", "empty transaction"},
+		{"not a list", "83646f67", "not a list"},
+		{"unknown type", "05c101", "unsupported transaction type 5"},
+		{"truncated", tx_1559[:len(tx_1559)-2], "unexpected end"},
+		{"truncated legacy", tx_eip155[:len(tx_eip155)-2], "unexpected end"},
+		{"trailing bytes", tx_1559 + "00", "trailing bytes"},
+		{"trailing bytes legacy", tx_eip155 + "c0", "trailing bytes"},
+		{"missing type byte", tx_1559[2:], "needs 9 fields"},
+		{"list size with leading zero", "f9006c" + tx_eip155[4:], "leading zeros"},
+		{"nonce as long string", "f86d8109" + tx_eip155[6:], "single byte below 0x80"},
+		{"value with leading zero", "f86d" + strings.Replace(tx_eip155[4:], "880de0b6b3a7640000", "89000de0b6b3a7640000", 1), "value: rlp: integer has leading zeros"},
+		{"missing field", "02f85381890c847735940085174876e80082520894d8da6bf26964af9d7eed9e03e53415d37aa96045880de0b6b3a7640000" +
+			"80c080a01111111111111111111111111111111111111111111111111111111111111111", "needs 12 fields, got 11"},
+		{"short address", "02f87381890c847735940085174876e80082520893d8da6bf26964af9d7eed9e03e53415d37aa960880de0b6b3a764000080" +
+			"c080a01111111111111111111111111111111111111111111111111111111111111111a02222222222222222222222222222" +
+			"222222222222222222222222222222222222", "to: invalid address"},
+		{"nonce over 64 bits", "02f87d818989010000000000000000847735940085174876e80082520894d8da6bf26964af9d7eed9e03e53415d37aa96045" +
+			"880de0b6b3a764000080c080a01111111111111111111111111111111111111111111111111111111111111111a022222222" +
+			"22222222222222222222222222222222222222222222222222222222", "nonce: rlp: integer overflows 64 bits"},
+		{"blob without recipient", "03f8a00103843b9aca008506fc23ac00825208808080c0843b9aca00f842a001aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa" +
+			"aaaaaaaaaaaaaaaaaaaaaaaaaaa001bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb80a01111" +
+			"111111111111111111111111111111111111111111111111111111111111a022222222222222222222222222222222222222" +
+			"22222222222222222222222222", "can't create contracts"},
+		{"set code without recipient", "04f8b60104843b9aca008504a817c80083013880808080c0f85cf85a019463c0c19a282a1b52b07dd5a65b58948a07dae32b" +
+			"0501a01111111111111111111111111111111111111111111111111111111111111111a02222222222222222222222222222" +
+			"22222222222222222222222222222222222201a0111111111111111111111111111111111111111111111111111111111111" +
+			"1111a02222222222222222222222222222222222222222222222222222222222222222", "can't create contracts"},
+	}
+
+	for _, tt := range tests {
+		raw, err := hex.DecodeString(tt.raw)
+		if err != nil {
+			t.Fatalf("%s: invalid test hex %s", tt.name, err)
+		}
+		_, err = Decode(raw)
+		if err == nil {
+			t.Errorf("%s: expected error", tt.name)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got error %q, want %q", tt.name, err.Error(), tt.err)
+		}
+	}
+}
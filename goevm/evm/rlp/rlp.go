@@ -0,0 +1,134 @@
+package rlp
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Item is decoded RLP string (Bytes) or list (List)
+type Item struct {
+	Bytes  []byte
+	List   []Item
+	IsList bool
+}
+
+const max_depth = 32
+
+var ErrUnexpectedEnd = errors.New("rlp: unexpected end of input")
+
+// Decode decodes single RLP item, the item needs to span the whole input.
+// Only canonical encoding is accepted
+func Decode(b []byte) (*Item, error) {
+	item, n, err := _decode(b, 0)
+	if err != nil {
+		return nil, err
+	}
+	if n != len(b) {
+		return nil, fmt.Errorf("rlp: %d trailing bytes after the item", len(b)-n)
+	}
+	return item, nil
+}
+
+// Read length of long string or list, which is stored in size_len bytes
+func _read_size(b []byte, size_len int) (int, error) {
+	if len(b) < size_len {
+		return 0, ErrUnexpectedEnd
+	}
+	if b[0] == 0 {
+		return 0, errors.New("rlp: size has leading zeros")
+	}
+	if size_len > 4 {
+		return 0, errors.New("rlp: item too large")
+	}
+
+	size := 0
+	for i := 0; i < size_len; i++ {
+		size = size<<8 | int(b[i])
+	}
+	if size < 56 {
+		return 0, errors.New("rlp: long form used for short item")
+	}
+	return size, nil
+}
+
+func _decode(b []byte, depth int) (*Item, int, error) {
+	if len(b) == 0 {
+		return nil, 0, ErrUnexpectedEnd
+	}
+	if depth > max_depth {
+		return nil, 0, errors.New("rlp: too deeply nested")
+	}
+
+	prefix := int(b[0])
+	header, size, is_list := 0, 0, false
+	switch {
+	case prefix < 0x80:
+		return &Item{Bytes: b[0:1]}, 1, nil
+
+	case prefix <= 0xb7:
+		header, size = 1, prefix-0x80
+		if size == 1 && len(b) > 1 && b[1] < 0x80 {
+			return nil, 0, errors.New("rlp: single byte below 0x80 encoded as string")
+		}
+
+	case prefix < 0xc0:
+		_s, err := _read_size(b[1:], prefix-0xb7)
+		if err != nil {
+			return nil, 0, err
+		}
+		header, size = 1+prefix-0xb7, _s
+
+	case prefix <= 0xf7:
+		header, size, is_list = 1, prefix-0xc0, true
+
+	default:
+		_s, err := _read_size(b[1:], prefix-0xf7)
+		if err != nil {
+			return nil, 0, err
+		}
+		header, size, is_list = 1+prefix-0xf7, _s, true
+	}
+
+	if len(b)-header < size {
+		return nil, 0, ErrUnexpectedEnd
+	}
+	payload := b[header : header+size]
+	if !is_list {
+		return &Item{Bytes: payload}, header + size, nil
+	}
+
+	ret := &Item{IsList: true, List: make([]Item, 0, 16)}
+	for pos := 0; pos < len(payload); {
+		item, n, err := _decode(payload[pos:], depth+1)
+		if err != nil {
+			return nil, 0, err
+		}
+		ret.List = append(ret.List, *item)
+		pos += n
+	}
+	return ret, header + size, nil
+}
+
+// BigInt decodes the item as unsigned integer
+func (this *Item) BigInt() (*big.Int, error) {
+	if this.IsList {
+		return nil, errors.New("rlp: expected integer, got list")
+	}
+	if len(this.Bytes) > 0 && this.Bytes[0] == 0 {
+		return nil, errors.New("rlp: integer has leading zeros")
+	}
+	return new(big.Int).SetBytes(this.Bytes), nil
+}
+
+// Uint64 decodes the item as unsigned integer which fits into 64 bits
+func (this *Item) Uint64() (uint64, error) {
+	v, err := this.BigInt()
+	if err != nil {
+		return 0, err
+	}
+	if !v.IsUint64() {
+		return 0, errors.New("rlp: integer overflows 64 bits")
+	}
+	return v.Uint64(), nil
+}
@@ -0,0 +1,142 @@
+package rlp
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func _hex(s string) []byte {
+	ret, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		panic(err)
+	}
+	return ret
+}
+
+func TestDecode(t *testing.T) {
+	long := bytes.Repeat([]byte{'a'}, 56)
+
+	tests := []struct {
+		name string
+		in   []byte
+		want *Item
+	}{
+		{"empty string", _hex("80"), &Item{Bytes: []byte{}}},
+		{"single byte", _hex("7f"), &Item{Bytes: []byte{0x7f}}},
+		{"zero byte", _hex("00"), &Item{Bytes: []byte{0}}},
+		{"byte over 0x7f", _hex("8180"), &Item{Bytes: []byte{0x80}}},
+		{"short string", _hex("83 646f67"), &Item{Bytes: []byte("dog")}},
+		{"long string", append(_hex("b838"), long...), &Item{Bytes: long}},
+		{"empty list", _hex("c0"), &Item{IsList: true, List: []Item{}}},
+		{"list", _hex("c8 83636174 83646f67"), &Item{IsList: true, List: []Item{{Bytes: []byte("cat")}, {Bytes: []byte("dog")}}}},
+		{"nested list", _hex("c7 c0 c1c0 c3c0c1c0"), &Item{IsList: true, List: []Item{
+			{IsList: true, List: []Item{}},
+			{IsList: true, List: []Item{{IsList: true, List: []Item{}}}},
+			{IsList: true, List: []Item{{IsList: true, List: []Item{}}, {IsList: true, List: []Item{{IsList: true, List: []Item{}}}}}},
+		}}},
+		{"long list", append(_hex("f83a b838"), long...), &Item{IsList: true, List: []Item{{Bytes: long}}}},
+	}
+
+	for _, tt := range tests {
+		got, err := Decode(tt.in)
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", tt.name, err)
+			continue
+		}
+		if !_equal(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	long := bytes.Repeat([]byte{'a'}, 56)
+	deep := []byte{0xc0}
+	for i := 0; i < 40; i++ {
+		deep = append([]byte{byte(0xc0 + len(deep))}, deep...)
+	}
+
+	tests := []struct {
+		name string
+		in   []byte
+		err  string
+	}{
+		{"empty input", []byte{}, "unexpected end"},
+		{"truncated string", _hex("83 6467"), "unexpected end"},
+		{"truncated list", _hex("c4 010203"), "unexpected end"},
+		{"truncated item in list", _hex("c2 8301"), "unexpected end"},
+		{"truncated size", _hex("b9 01"), "unexpected end"},
+		{"truncated long string", append(_hex("b839"), long...), "unexpected end"},
+		{"trailing bytes", _hex("83 646f67 00"), "trailing bytes"},
+		{"trailing bytes after list", _hex("c0 c0"), "trailing bytes"},
+		{"single byte as string", _hex("8105"), "single byte below 0x80"},
+		{"long form for short string", append(_hex("b805"), long[:5]...), "long form used for short item"},
+		{"long form for short list", _hex("f802 0102"), "long form used for short item"},
+		{"size with leading zero", append(_hex("b90038"), long...), "leading zeros"},
+		{"list size with leading zero", append(_hex("f9003a b838"), long...), "leading zeros"},
+		{"size too large", _hex("bc 0100000000"), "too large"},
+		{"too deep", deep, "too deeply nested"},
+	}
+
+	for _, tt := range tests {
+		_, err := Decode(tt.in)
+		if err == nil {
+			t.Errorf("%s: expected error", tt.name)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got error %q, want %q", tt.name, err.Error(), tt.err)
+		}
+	}
+}
+
+func TestIntegers(t *testing.T) {
+	tests := []struct {
+		in   string
+		want uint64
+		err  string
+	}{
+		{"80", 0, ""},
+		{"01", 1, ""},
+		{"7f", 127, ""},
+		{"8180", 128, ""},
+		{"820400", 1024, ""},
+		{"88 ffffffffffffffff", 18446744073709551615, ""},
+		{"820001", 0, "leading zeros"},
+		{"00", 0, "leading zeros"},
+		{"89 010000000000000000", 0, "overflows 64 bits"},
+		{"c0", 0, "got list"},
+	}
+
+	for _, tt := range tests {
+		item, err := Decode(_hex(tt.in))
+		if err != nil {
+			t.Errorf("%s: unexpected decode error %s", tt.in, err)
+			continue
+		}
+		got, err := item.Uint64()
+		if len(tt.err) > 0 {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: got error %v, want %q", tt.in, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s: got %d (%v), want %d", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func _equal(a, b *Item) bool {
+	if a.IsList != b.IsList || !bytes.Equal(a.Bytes, b.Bytes) || len(a.List) != len(b.List) {
+		return false
+	}
+	for i := range a.List {
+		if !_equal(&a.List[i], &b.List[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,23 @@
+package evm_proxy
+
+import (
+	"goevm/evm_proxy/alert"
+	"time"
+)
+
+// pool wide alerts, node is healthy if it's not paused, disabled or throttled
+func init() {
+	if !alert.IsEnabled() {
+		return
+	}
+
+	go func() {
+		for {
+			time.Sleep(10 * time.Second)
+			sh := MakeScheduler()
+			healthy := len(sh.GetAll(true, false)) + len(sh.GetAll(false, false))
+			total := len(sh.GetAll(true, true)) + len(sh.GetAll(false, true))
+			alert.Pool(healthy, total)
+		}
+	}()
+}
@@ -0,0 +1,498 @@
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/config"
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/hslog"
+)
+
+var log = hslog.Get("alert")
+
+const (
+	RULE_NODE_DISABLED  = "node_disabled"
+	RULE_NODE_PAUSED    = "node_paused"
+	RULE_NODE_THROTTLED = "node_throttled"
+	RULE_NO_CLIENT      = "no_client"
+	RULE_POOL_DEGRADED  = "pool_degraded"
+)
+
+var all_rules = []string{RULE_NODE_DISABLED, RULE_NODE_PAUSED, RULE_NODE_THROTTLED, RULE_NO_CLIENT, RULE_POOL_DEGRADED}
+
+const (
+	TARGET_JSON     = "json"
+	TARGET_SLACK    = "slack"
+	TARGET_TELEGRAM = "telegram"
+)
+
+const STATE_FIRING = "firing"
+const STATE_RESOLVED = "resolved"
+
+const queue_size = 100
+const history_size = 50
+
+// Event is a condition change, Active is false when the condition is gone.
+// Events for nodes are tracked separately for every node
+type Event struct {
+	Rule     string
+	NodeID   uint64
+	Endpoint string
+	Message  string
+	Active   bool
+}
+
+// Sent is the alert as delivered to the targets
+type Sent struct {
+	TS       int64  `json:"ts"`
+	Rule     string `json:"rule"`
+	State    string `json:"state"`
+	NodeID   uint64 `json:"node_id,omitempty"`
+	Endpoint string `json:"endpoint,omitempty"`
+	Message  string `json:"message"`
+}
+
+type target struct {
+	name        string
+	kind        string
+	url         string
+	url_display string
+	chat_id     string
+}
+
+type rule_settings struct {
+	enabled  bool
+	debounce int64
+	cooldown int64
+}
+
+type settings struct {
+	enabled bool
+	targets []target
+	rules   map[string]rule_settings
+
+	min_healthy         int
+	no_client_threshold int
+}
+
+type state_key struct {
+	rule    string
+	node_id uint64
+}
+
+// state of single rule / node, pending event is sent when it's not
+// cancelled by opposite event during the debounce time
+type state struct {
+	firing        bool
+	last_fired    int64
+	pending       *Event
+	pending_since int64
+	suppressed    bool
+}
+
+var mu sync.Mutex
+var cfg = settings{rules: map[string]rule_settings{}}
+var states = make(map[state_key]*state)
+var history = make([]Sent, 0, history_size)
+var counters = make(map[string]int)
+var queue = make(chan Sent, queue_size)
+var client = &http.Client{Timeout: 10 * time.Second}
+
+var no_client_count = 0
+
+// Reads ALERTS section, alerts are disabled if it's not present, eg.
+// "ALERTS":{"targets":[{"name":"ops", "type":"slack", "url":"${env:SLACK_WEBHOOK}"}],
+// "debounce":30, "cooldown":300, "min_healthy_nodes":2, "no_client_threshold":10,
+// "rules":{"node_throttled":{"enabled":false}, "pool_degraded":{"cooldown":60}}}
+func init() {
+	raw, ok := config.Config().GetRawData("ALERTS", "").(map[string]interface{})
+	if ok {
+		var errs config.PathErrors
+		if cfg, errs = _read_config(raw, "ALERTS"); len(errs) > 0 {
+			panic("Alerts config error. " + errs[0].Error())
+		}
+	}
+
+	registerStatus()
+	if !cfg.enabled {
+		return
+	}
+
+	go _sender()
+	go func() {
+		last_minute := time.Now().Unix() / 60
+		for {
+			time.Sleep(time.Second)
+			now := time.Now().Unix()
+			if minute := now / 60; minute != last_minute {
+				last_minute = minute
+				_check_no_client()
+			}
+			_process(now)
+		}
+	}()
+}
+
+// ConfigCheck validates ALERTS section, secret references in urls need to
+// be resolvable
+func ConfigCheck(raw interface{}, path string) []config.PathError {
+	_raw, ok := raw.(map[string]interface{})
+	if !ok {
+		return []config.PathError{{Path: path, Message: "expected object"}}
+	}
+	_, errs := _read_config(_raw, path)
+	return errs
+}
+
+func _read_config(raw map[string]interface{}, path string) (settings, config.PathErrors) {
+	ret := settings{enabled: true, rules: make(map[string]rule_settings), no_client_threshold: 1}
+	errs := config.PathErrors{}
+
+	_num := func(m map[string]interface{}, path, attr string, def int64) int64 {
+		v, ok := m[attr]
+		if !ok {
+			return def
+		}
+		if n, ok := v.(json.Number); ok {
+			if i, err := n.Int64(); err == nil && i >= 0 {
+				return i
+			}
+		}
+		errs.Add(config.PathKey(path, attr), "expected integer >= 0")
+		return def
+	}
+
+	debounce := _num(raw, path, "debounce", 30)
+	cooldown := _num(raw, path, "cooldown", 300)
+	ret.min_healthy = int(_num(raw, path, "min_healthy_nodes", 0))
+	ret.no_client_threshold = int(_num(raw, path, "no_client_threshold", 1))
+
+	rules, ok := raw["rules"].(map[string]interface{})
+	if _, exists := raw["rules"]; exists && !ok {
+		errs.Add(config.PathKey(path, "rules"), "expected object with rule settings")
+	}
+	for name, v := range rules {
+		if _rule_known(name) < 0 {
+			errs.Add(config.PathKey(config.PathKey(path, "rules"), name), "unknown rule, expected one of %s", strings.Join(all_rules, ", "))
+		} else if _, ok := v.(map[string]interface{}); !ok {
+			errs.Add(config.PathKey(config.PathKey(path, "rules"), name), "expected object")
+		}
+	}
+	for _, name := range all_rules {
+		r := rule_settings{enabled: true, debounce: debounce, cooldown: cooldown}
+		if rc, ok := rules[name].(map[string]interface{}); ok {
+			_path := config.PathKey(config.PathKey(path, "rules"), name)
+			if v, ok := rc["enabled"].(bool); ok {
+				r.enabled = v
+			} else if _, exists := rc["enabled"]; exists {
+				errs.Add(config.PathKey(_path, "enabled"), "expected bool")
+			}
+			r.debounce = _num(rc, _path, "debounce", debounce)
+			r.cooldown = _num(rc, _path, "cooldown", cooldown)
+		}
+		ret.rules[name] = r
+	}
+
+	targets, _ := raw["targets"].([]interface{})
+	if len(targets) == 0 {
+		errs.Add(config.PathKey(path, "targets"), "no targets defined")
+	}
+	for num, v := range targets {
+		_path := config.PathIndex(config.PathKey(path, "targets"), num)
+		tc, ok := v.(map[string]interface{})
+		if !ok {
+			errs.Add(_path, "expected object")
+			continue
+		}
+		t := target{kind: TARGET_JSON}
+		t.name, _ = tc["name"].(string)
+		if len(t.name) == 0 {
+			t.name = fmt.Sprintf("target_%d", num)
+		}
+		if kind, ok := tc["type"].(string); ok {
+			t.kind = kind
+		}
+		if t.kind != TARGET_JSON && t.kind != TARGET_SLACK && t.kind != TARGET_TELEGRAM {
+			errs.Add(config.PathKey(_path, "type"), "unknown type %s, expected json, slack or telegram", t.kind)
+			continue
+		}
+		url, _ := tc["url"].(string)
+		resolved, err := config.ResolveSecrets(url)
+		if err != nil {
+			errs.Add(config.PathKey(_path, "url"), "%s", err.Error())
+			continue
+		}
+		if !strings.HasPrefix(resolved, "http://") && !strings.HasPrefix(resolved, "https://") {
+			errs.Add(config.PathKey(_path, "url"), "target %s needs http(s) url", t.name)
+			continue
+		}
+		t.url = resolved
+		t.url_display = url
+		if !config.HasSecretRefs(url) {
+			t.url_display = config.Redact(url)
+		}
+		if chat_id, ok := tc["chat_id"].(json.Number); ok {
+			t.chat_id = chat_id.String()
+		} else {
+			t.chat_id, _ = tc["chat_id"].(string)
+		}
+		if t.kind == TARGET_TELEGRAM && len(t.chat_id) == 0 {
+			errs.Add(config.PathKey(_path, "chat_id"), "telegram target %s needs chat_id", t.name)
+			continue
+		}
+		ret.targets = append(ret.targets, t)
+	}
+
+	return ret, errs
+}
+
+func _rule_known(name string) int {
+	for num, v := range all_rules {
+		if v == name {
+			return num
+		}
+	}
+	return -1
+}
+
+func IsEnabled() bool {
+	return cfg.enabled
+}
+
+// Fire reports condition change, it never blocks so it's safe to call it
+// with locks held. The alert is sent after debounce time, if the condition
+// didn't change back in the meantime
+func Fire(e Event) {
+	r, ok := cfg.rules[e.Rule]
+	if !cfg.enabled || !ok || !r.enabled {
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	key := state_key{e.Rule, e.NodeID}
+	st, ok := states[key]
+	if !ok {
+		if !e.Active {
+			return
+		}
+		st = &state{}
+		states[key] = st
+	}
+
+	if st.firing == e.Active {
+		if st.pending != nil {
+			counters["cancelled"]++
+		}
+		st.pending = nil
+		return
+	}
+	if st.pending == nil {
+		st.pending_since = time.Now().Unix()
+		st.suppressed = false
+	}
+	st.pending = &e
+}
+
+// NoClient counts requests which couldn't be served because no node was
+// available, alert fires when there are at least no_client_threshold of
+// them in a minute
+func NoClient() {
+	if !cfg.enabled {
+		return
+	}
+	mu.Lock()
+	no_client_count++
+	mu.Unlock()
+}
+
+func _check_no_client() {
+	mu.Lock()
+	count := no_client_count
+	no_client_count = 0
+	mu.Unlock()
+
+	Fire(Event{Rule: RULE_NO_CLIENT, Active: count >= cfg.no_client_threshold,
+		Message: fmt.Sprintf("%d requests couldn't find available node in the last minute", count)})
+}
+
+// Pool reports number of healthy (not paused, disabled or throttled) nodes
+func Pool(healthy, total int) {
+	if !cfg.enabled || cfg.min_healthy <= 0 {
+		return
+	}
+	Fire(Event{Rule: RULE_POOL_DEGRADED, Active: healthy < cfg.min_healthy,
+		Message: fmt.Sprintf("%d of %d nodes healthy, minimum is %d", healthy, total, cfg.min_healthy)})
+}
+
+// _process queues pending events which outlived their debounce time,
+// firing alerts are kept pending until cooldown of the rule for the same
+// node expires, so they're sent if the condition is still there
+func _process(now int64) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for key, st := range states {
+		if st.pending == nil {
+			if !st.firing {
+				delete(states, key)
+			}
+			continue
+		}
+		r := cfg.rules[key.rule]
+		if now-st.pending_since < r.debounce {
+			continue
+		}
+
+		e := st.pending
+		st_name := STATE_RESOLVED
+		if e.Active {
+			st_name = STATE_FIRING
+			if st.last_fired > 0 && now-st.last_fired < r.cooldown {
+				if !st.suppressed {
+					st.suppressed = true
+					counters["suppressed"]++
+					log.Debug("Alert delayed by cooldown", "rule", e.Rule, "node", e.NodeID)
+				}
+				continue
+			}
+			st.last_fired = now
+		}
+		st.pending = nil
+		st.firing = e.Active
+
+		s := Sent{TS: now, Rule: e.Rule, State: st_name, NodeID: e.NodeID, Endpoint: e.Endpoint, Message: e.Message}
+		if len(history) >= history_size {
+			history = history[1:]
+		}
+		history = append(history, s)
+
+		select {
+		case queue <- s:
+		default:
+			counters["dropped"]++
+			log.Warn("Alert queue full, alert dropped", "rule", e.Rule, "node", e.NodeID)
+		}
+	}
+}
+
+func _sender() {
+	for s := range queue {
+		for _, t := range cfg.targets {
+			if err := _send(t, s); err != nil {
+				mu.Lock()
+				counters["failed"]++
+				mu.Unlock()
+				log.Error("Can't send alert", "target", t.name, "rule", s.Rule, "err", config.Redact(err.Error()))
+				continue
+			}
+			mu.Lock()
+			counters["sent"]++
+			mu.Unlock()
+			log.Info("Alert sent", "target", t.name, "rule", s.Rule, "state", s.State, "node", s.NodeID)
+		}
+	}
+}
+
+func _text(s Sent) string {
+	ret := "[" + strings.ToUpper(s.State) + "] " + s.Rule
+	if s.NodeID > 0 {
+		ret += fmt.Sprintf(", node #%d %s", s.NodeID, s.Endpoint)
+	}
+	return ret + ": " + s.Message
+}
+
+func _send(t target, s Sent) error {
+	var payload interface{}
+	switch t.kind {
+	case TARGET_SLACK:
+		payload = map[string]string{"text": _text(s)}
+	case TARGET_TELEGRAM:
+		payload = map[string]string{"chat_id": t.chat_id, "text": _text(s)}
+	default:
+		payload = s
+	}
+	body, _ := json.Marshal(payload)
+
+	resp, err := client.Post(t.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("HTTP status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Test sends test alert to the target or to all targets if name is empty,
+// debounce and cooldown are skipped. Returns delivery result by target name
+func Test(name, message string) (map[string]string, error) {
+	if !cfg.enabled {
+		return nil, fmt.Errorf("alerts are disabled, add ALERTS section to the config")
+	}
+
+	s := Sent{TS: time.Now().Unix(), Rule: "test", State: STATE_FIRING, Message: message}
+	ret := make(map[string]string)
+	for _, t := range cfg.targets {
+		if len(name) > 0 && t.name != name {
+			continue
+		}
+		ret[t.name] = "ok"
+		if err := _send(t, s); err != nil {
+			ret[t.name] = config.Redact(err.Error())
+		}
+	}
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("can't find target %s", name)
+	}
+	log.Info("Test alert sent", "targets", len(ret))
+	return ret, nil
+}
+
+// Firing returns alerts which are currently active
+func Firing() []Sent {
+	mu.Lock()
+	defer mu.Unlock()
+
+	ret := make([]Sent, 0)
+	for key, st := range states {
+		if st.firing {
+			ret = append(ret, Sent{TS: st.last_fired, Rule: key.rule, State: STATE_FIRING, NodeID: key.node_id})
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].TS > ret[j].TS })
+	return ret
+}
+
+// History returns recently sent alerts, newest first
+func History() []Sent {
+	mu.Lock()
+	defer mu.Unlock()
+
+	ret := make([]Sent, len(history))
+	for i := range history {
+		ret[len(history)-1-i] = history[i]
+	}
+	return ret
+}
+
+func Counters() map[string]int {
+	mu.Lock()
+	defer mu.Unlock()
+
+	ret := make(map[string]int, len(counters))
+	for k, v := range counters {
+		ret[k] = v
+	}
+	return ret
+}
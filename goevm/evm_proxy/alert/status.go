@@ -0,0 +1,69 @@
+package alert
+
+import (
+	"fmt"
+	"html"
+	"time"
+
+	"github.com/slawomir-pryczek/HSServer/handler_socket2"
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/hscommon"
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/metrics"
+)
+
+func registerStatus() {
+
+	handler_socket2.StatusPluginRegisterData(func() (string, string) {
+		if !cfg.enabled {
+			return "EVM Proxy - Alerts", "<pre>Alerts are disabled, add ALERTS section to the config to enable them</pre>"
+		}
+
+		c := Counters()
+		info := fmt.Sprintf("Sent: %d, failed: %d, delayed by cooldown: %d, cancelled by debounce: %d, dropped: %d\n",
+			c["sent"], c["failed"], c["suppressed"], c["cancelled"], c["dropped"])
+		if cfg.min_healthy > 0 {
+			info += fmt.Sprintf("Pool is degraded below %d healthy nodes\n", cfg.min_healthy)
+		}
+		info += fmt.Sprintf("No client alert fires at %d failed requests per minute\n", cfg.no_client_threshold)
+		info += "Use evm_admin_alert_test action to send test alert\n"
+
+		targets := hscommon.NewTableGen("Target", "Type", "URL")
+		targets.SetClass("tab evm")
+		for _, t := range cfg.targets {
+			targets.AddRow(html.EscapeString(t.name), t.kind, html.EscapeString(t.url_display))
+		}
+
+		rules := hscommon.NewTableGen("Rule", "Enabled", "Debounce", "Cooldown")
+		rules.SetClass("tab evm")
+		for _, name := range all_rules {
+			r := cfg.rules[name]
+			rules.AddRow(name, fmt.Sprintf("%v", r.enabled), fmt.Sprintf("%ds", r.debounce), fmt.Sprintf("%ds", r.cooldown))
+		}
+
+		sent := hscommon.NewTableGen("Time", "Rule", "State", "Node", "Message")
+		sent.SetClass("tab evm")
+		now := time.Now().Unix()
+		for _, s := range History() {
+			node := "-"
+			if s.NodeID > 0 {
+				node = fmt.Sprintf("#%d", s.NodeID)
+			}
+			sent.AddRow(hscommon.FormatTime(int(now-s.TS))+" ago", s.Rule, s.State, node, html.EscapeString(s.Message))
+		}
+
+		return "EVM Proxy - Alerts", "<pre>" + info + "</pre>" + targets.Render() + rules.Render() + sent.Render()
+	}, func() (string, interface{}) {
+		return "EVM Proxy - Alerts", map[string]interface{}{"enabled": cfg.enabled, "counters": Counters(),
+			"firing": Firing(), "history": History()}
+	})
+
+	metrics.Register(func(w *metrics.Writer) {
+		if !cfg.enabled {
+			return
+		}
+		c := Counters()
+		w.Counter("evm_alerts_sent_total", "Alerts delivered to targets", float64(c["sent"]))
+		w.Counter("evm_alerts_failed_total", "Alerts which couldn't be delivered", float64(c["failed"]))
+		w.Counter("evm_alerts_suppressed_total", "Alerts delayed by cooldown", float64(c["suppressed"]))
+		w.Gauge("evm_alerts_firing", "Number of currently firing alerts", float64(len(Firing())))
+	})
+}
@@ -0,0 +1,269 @@
+package apikey
+
+import (
+	"fmt"
+	"goevm/evm_proxy/client/throttle"
+	"goevm/evm_proxy/method_filter"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/config"
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/hslog"
+)
+
+var log = hslog.Get("apikey")
+
+type Key struct {
+	mu sync.Mutex
+
+	name    string
+	key     string
+	methods []string
+	tags    []string
+
+	throttle []*throttle.Throttle
+
+	stat_requests  int
+	stat_throttled int
+	stat_denied    int
+	stat_bytes     int
+}
+
+// Limits is the budget left for the key, limiters which are not defined
+// for the key are not present
+type Limits map[string]int
+
+var mu sync.RWMutex
+var keys = make(map[string]*Key)
+var keys_ordered = make([]*Key, 0)
+
+func init() {
+	raw := config.Config().GetRawData("API_KEYS", "")
+	if _, ok := raw.([]interface{}); !ok {
+		raw = config.Config().GetRawData("CLIENTS", "")
+	}
+
+	items, ok := raw.([]interface{})
+	if !ok {
+		return
+	}
+
+	for num, v := range items {
+		item, ok := v.(map[string]interface{})
+		if !ok {
+			log.Warn("API key is not an object, skipping", "num", num)
+			continue
+		}
+
+		k, logs, err := makeFromConfig(item)
+		if err != nil {
+			log.Warn("Invalid API key, skipping", "num", num, "err", err)
+			continue
+		}
+		log.Info("API key", "name", k.name, "methods", strings.Join(k.methods, ","), "tags", strings.Join(k.tags, ","))
+		for _, l := range logs {
+			log.Info("API key throttle", "name", k.name, "throttle", l)
+		}
+		register(k)
+	}
+
+	registerStatus()
+}
+
+var key_attrs = map[string]bool{"key": true, "name": true, "methods": true, "tags": true, "throttle": true}
+
+// ConfigCheck validates API_KEYS section, keys need to be unique
+func ConfigCheck(raw interface{}, path string) []config.PathError {
+	items, ok := raw.([]interface{})
+	if !ok {
+		return []config.PathError{{Path: path, Message: "expected array of keys"}}
+	}
+
+	errs := config.PathErrors{}
+	seen := make(map[string]int)
+	for num, v := range items {
+		_path := config.PathIndex(path, num)
+		item, ok := v.(map[string]interface{})
+		if !ok {
+			errs.Add(_path, "expected object")
+			continue
+		}
+		for attr, v := range item {
+			if !key_attrs[attr] {
+				errs.Add(config.PathKey(_path, attr), "unknown API key attribute")
+			} else if _, ok := v.(string); !ok {
+				errs.Add(config.PathKey(_path, attr), "expected string")
+			}
+		}
+		k, _, err := makeFromConfig(item)
+		if err != nil {
+			errs.Add(_path, "%s", err.Error())
+			continue
+		}
+		if prev, ok := seen[k.key]; ok {
+			errs.Add(config.PathKey(_path, "key"), "duplicate of key %s", config.PathIndex(path, prev))
+			continue
+		}
+		seen[k.key] = num
+	}
+	return errs
+}
+
+func _cfg_string(item map[string]interface{}, attr string) string {
+	if v, ok := item[attr].(string); ok {
+		return strings.TrimSpace(v)
+	}
+	return ""
+}
+
+func makeFromConfig(item map[string]interface{}) (*Key, []string, error) {
+	ret := &Key{}
+	ret.key = _cfg_string(item, "key")
+	ret.name = _cfg_string(item, "name")
+	ret.methods = method_filter.SplitList(_cfg_string(item, "methods"))
+	ret.tags = method_filter.SplitList(_cfg_string(item, "tags"))
+
+	if len(ret.key) == 0 {
+		return nil, nil, fmt.Errorf("no key defined")
+	}
+	if len(ret.name) == 0 {
+		ret.name = _mask(ret.key)
+	}
+
+	thr := ([]*throttle.Throttle)(nil)
+	logs := []string{}
+	if val := _cfg_string(item, "throttle"); len(val) > 0 {
+		thr, logs = throttle.MakeFromConfig(val)
+		if thr == nil {
+			return nil, nil, fmt.Errorf("throttle config error: %s", strings.Join(logs, ", "))
+		}
+	}
+	if thr == nil {
+		thr = append(make([]*throttle.Throttle, 0, 1), throttle.Make())
+		logs = append(logs, "Throttling disabled")
+	}
+	ret.throttle = thr
+	return ret, logs, nil
+}
+
+func register(k *Key) {
+	mu.Lock()
+	keys[k.key] = k
+	keys_ordered = append(keys_ordered, k)
+	mu.Unlock()
+}
+
+// IsEnabled returns true if any API key is defined, in that case every
+// request needs to provide a valid key
+func IsEnabled() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return len(keys) > 0
+}
+
+// FromRequest reads the key from X-Api-Key header, api_key query parameter
+// or the last segment of URL path (eg. /v1/<key>)
+func FromRequest(header http.Header, get map[string]string) string {
+	if k := strings.TrimSpace(header.Get("X-Api-Key")); len(k) > 0 {
+		return k
+	}
+	if k := strings.TrimSpace(get["api_key"]); len(k) > 0 {
+		return k
+	}
+
+	path := strings.Trim(get["__path"], "/")
+	if pos := strings.LastIndexByte(path, '/'); pos > -1 {
+		path = path[pos+1:]
+	}
+	return path
+}
+
+func Get(key string) *Key {
+	if len(key) == 0 {
+		return nil
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+	return keys[key]
+}
+
+func (this *Key) GetName() string {
+	return this.name
+}
+
+func (this *Key) GetTags() []string {
+	return this.tags
+}
+
+// IsMethodAllowed checks method against key's allowed list, entries ending
+// with * are treated as prefixes, empty list allows everything
+func (this *Key) IsMethodAllowed(method string) bool {
+	if len(this.methods) == 0 || method_filter.Match(this.methods, method) {
+		return true
+	}
+
+	this.mu.Lock()
+	this.stat_denied++
+	this.mu.Unlock()
+	return false
+}
+
+// OnRequest accounts the request (all methods of a batch) in key's throttle
+// group. If the quota is exhausted, or the batch doesn't fit in requests
+// left, returns false and the budget left
+func (this *Key) OnRequest(methods []string) (bool, Limits) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	// throttle score needs to be read first, it rotates stats windows
+	group := throttle.ThrottleGoup(this.throttle)
+	throttled := group.GetThrottleScore().Throttled
+	req, req_fn, _, _ := group.GetLimitsLeft()
+	if throttled || req < len(methods) || req_fn < len(methods) {
+		this.stat_throttled++
+		return false, this._limits()
+	}
+
+	for _, method := range methods {
+		group.OnRequest(method)
+	}
+	this.stat_requests += len(methods)
+	return true, this._limits()
+}
+
+func (this *Key) OnReceive(data_bytes int) {
+	this.mu.Lock()
+	throttle.ThrottleGoup(this.throttle).OnReceive(data_bytes)
+	this.stat_bytes += data_bytes
+	this.mu.Unlock()
+}
+
+func (this *Key) _limits() Limits {
+	ret := make(Limits)
+	req, req_fn, data, _ := throttle.ThrottleGoup(this.throttle).GetLimitsLeft()
+	_add := func(name string, v int) {
+		// MaxInt32 means there's no limiter of given type
+		if v == math.MaxInt32 {
+			return
+		}
+		if v < 0 {
+			v = 0
+		}
+		ret[name] = v
+	}
+
+	_add("requests_left", req)
+	_add("requests_fn_left", req_fn)
+	_add("data_left", data)
+	return ret
+}
+
+func _mask(key string) string {
+	if len(key) <= 8 {
+		return "****"
+	}
+	return key[0:4] + "****" + key[len(key)-2:]
+}
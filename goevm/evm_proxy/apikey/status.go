@@ -0,0 +1,65 @@
+package apikey
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/slawomir-pryczek/HSServer/handler_socket2"
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/hscommon"
+)
+
+func registerStatus() {
+
+	handler_socket2.StatusPluginRegisterData(func() (string, string) {
+		info := "Every request needs to provide an API key using X-Api-Key header, ?api_key= or /v1/&lt;key&gt; path\n"
+		info += "<b>Denied</b> - Calls to methods which are not allowed for the key\n"
+		info += "<b>Throttled</b> - Requests rejected because key's quota was exhausted\n"
+
+		table := hscommon.NewTableGen("Name", "Key", "Methods", "Tags", "Requests", "Denied", "Throttled", "Received", "Throttle")
+		table.SetClass("tab evm")
+
+		mu.RLock()
+		_keys := make([]*Key, len(keys_ordered))
+		copy(_keys, keys_ordered)
+		mu.RUnlock()
+
+		for _, k := range _keys {
+			_methods := "*"
+			if len(k.methods) > 0 {
+				_methods = strings.Join(k.methods, ", ")
+			}
+			_tags := "-"
+			if len(k.tags) > 0 {
+				_tags = strings.Join(k.tags, ", ")
+			}
+
+			k.mu.Lock()
+			_throttle := ""
+			for _, t := range k.throttle {
+				_throttle += t.GetStatus()
+			}
+			table.AddRow(html.EscapeString(k.name), _mask(k.key), html.EscapeString(_methods), html.EscapeString(_tags),
+				fmt.Sprintf("%d", k.stat_requests), fmt.Sprintf("%d", k.stat_denied), fmt.Sprintf("%d", k.stat_throttled),
+				hscommon.FormatBytes(uint64(k.stat_bytes)), _throttle)
+			k.mu.Unlock()
+		}
+
+		return "EVM Proxy - API Keys", "<pre>" + info + "</pre>" + table.Render()
+	}, func() (string, interface{}) {
+		mu.RLock()
+		_keys := make([]*Key, len(keys_ordered))
+		copy(_keys, keys_ordered)
+		mu.RUnlock()
+
+		ret := make([]map[string]interface{}, 0, len(_keys))
+		for _, k := range _keys {
+			k.mu.Lock()
+			ret = append(ret, map[string]interface{}{"name": k.name, "key": _mask(k.key), "methods": k.methods,
+				"tags": k.tags, "requests": k.stat_requests, "denied": k.stat_denied, "throttled": k.stat_throttled,
+				"bytes_received": k.stat_bytes, "limits": k._limits()})
+			k.mu.Unlock()
+		}
+		return "EVM Proxy - API Keys", ret
+	})
+}
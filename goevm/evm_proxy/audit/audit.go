@@ -0,0 +1,129 @@
+package audit
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/config"
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/hslog"
+)
+
+var log = hslog.Get("audit")
+
+// Actors for changes which were not done by an admin
+const (
+	ACTOR_HEALTH_CHECKER = "health_checker"
+	ACTOR_MAINTENANCE    = "maintenance"
+	ACTOR_CONFIG         = "config"
+)
+
+type Entry struct {
+	TS       int64  `json:"ts"`
+	Actor    string `json:"actor"`
+	Action   string `json:"action"`
+	NodeID   uint64 `json:"node_id"`
+	Endpoint string `json:"endpoint"`
+	Before   string `json:"before"`
+	After    string `json:"after"`
+	Reason   string `json:"reason"`
+}
+
+// Filter for Query, empty values match everything
+type Filter struct {
+	NodeID uint64
+	Actor  string
+	Action string
+	Since  int64
+	Limit  int
+}
+
+var mu sync.Mutex
+var entries []Entry
+var entries_pos = 0
+var entries_count = 0
+
+var log_file *os.File
+var log_file_name = ""
+
+// Reads AUDIT_LOG section, eg. "AUDIT_LOG":{"file":"/var/log/goevm/audit.jsonl", "size":1000}
+// size is the number of entries kept in memory
+func init() {
+	size := 1000
+	raw, _ := config.Config().GetRawData("AUDIT_LOG", "").(map[string]interface{})
+	if v, ok := raw["size"].(json.Number); ok {
+		if _v, err := v.Int64(); err == nil && _v > 0 {
+			size = int(_v)
+		}
+	}
+	entries = make([]Entry, size)
+
+	if v, ok := raw["file"].(string); ok && len(v) > 0 {
+		f, err := os.OpenFile(v, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+		if err != nil {
+			log.Warn("Can't open audit log file", "file", v, "err", err)
+		} else {
+			log_file = f
+			log_file_name = v
+		}
+	}
+
+	registerStatus()
+}
+
+// Log appends the entry, timestamp is set if it's empty. Entries are never
+// modified or removed, only the oldest ones are dropped from memory
+func Log(e Entry) {
+	if e.TS == 0 {
+		e.TS = time.Now().Unix()
+	}
+	e.Endpoint = config.Redact(e.Endpoint)
+	e.Reason = config.Redact(e.Reason)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	entries[entries_pos] = e
+	entries_pos = (entries_pos + 1) % len(entries)
+	if entries_count < len(entries) {
+		entries_count++
+	}
+
+	if log_file != nil {
+		line, _ := json.Marshal(e)
+		if _, err := log_file.Write(append(line, '\n')); err != nil {
+			log.Warn("Can't write audit log file", "file", log_file_name, "err", err)
+		}
+	}
+}
+
+// Query returns matching entries from memory, newest first. Actor matches
+// by prefix, so "admin" returns changes done by all admins
+func Query(f Filter) []Entry {
+	mu.Lock()
+	defer mu.Unlock()
+
+	ret := make([]Entry, 0)
+	for i := 1; i <= entries_count; i++ {
+		e := entries[(entries_pos-i+len(entries))%len(entries)]
+		if f.Limit > 0 && len(ret) >= f.Limit {
+			break
+		}
+		if f.Since > 0 && e.TS < f.Since {
+			break
+		}
+		if f.NodeID > 0 && e.NodeID != f.NodeID {
+			continue
+		}
+		if len(f.Actor) > 0 && !strings.HasPrefix(e.Actor, f.Actor) {
+			continue
+		}
+		if len(f.Action) > 0 && e.Action != f.Action {
+			continue
+		}
+		ret = append(ret, e)
+	}
+	return ret
+}
@@ -0,0 +1,40 @@
+package audit
+
+import (
+	"fmt"
+	"html"
+	"time"
+
+	"github.com/slawomir-pryczek/HSServer/handler_socket2"
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/hscommon"
+)
+
+const status_entries = 20
+
+func registerStatus() {
+
+	handler_socket2.StatusPluginRegisterData(func() (string, string) {
+		info := fmt.Sprintf("Changes of nodes' state, last %d entries. Use evm_admin_audit action to query the whole log\n", status_entries)
+		if len(log_file_name) > 0 {
+			info += "Entries are also appended to: " + html.EscapeString(log_file_name) + "\n"
+		}
+
+		table := hscommon.NewTableGen("Time", "Actor", "Action", "Node", "Before", "After", "Reason")
+		table.SetClass("tab evm")
+
+		now := time.Now().Unix()
+		for _, e := range Query(Filter{Limit: status_entries}) {
+			_time := "now"
+			if now-e.TS > 0 {
+				_time = hscommon.FormatTime(int(now-e.TS)) + " ago"
+			}
+			table.AddRow(_time, html.EscapeString(e.Actor), html.EscapeString(e.Action),
+				fmt.Sprintf("#%d %s", e.NodeID, html.EscapeString(e.Endpoint)),
+				html.EscapeString(e.Before), html.EscapeString(e.After), html.EscapeString(e.Reason))
+		}
+
+		return "EVM Proxy - Audit Log", "<pre>" + info + "</pre>" + table.Render()
+	}, func() (string, interface{}) {
+		return "EVM Proxy - Audit Log", Query(Filter{Limit: status_entries})
+	})
+}
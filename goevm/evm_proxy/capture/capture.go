@@ -0,0 +1,473 @@
+package capture
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/config"
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/hslog"
+)
+
+var log = hslog.Get("capture")
+
+// Kinds of captures, one call can be captured as more than one kind
+const (
+	KIND_ERROR  = 1 << 0
+	KIND_SAMPLE = 1 << 1
+	KIND_SLOW   = 1 << 2
+)
+
+const max_keys = 1000
+const redacted = "[redacted]"
+
+var default_redact = []string{"eth_sendRawTransaction", "eth_sendTransaction", "eth_sign", "eth_signTransaction",
+	"eth_signTypedData*", "personal_*"}
+
+type Entry struct {
+	TS        int64             `json:"ts_ms"`
+	Kind      string            `json:"kind"`
+	RequestID string            `json:"request_id,omitempty"`
+	NodeID    uint64            `json:"node_id"`
+	Endpoint  string            `json:"endpoint"`
+	Method    string            `json:"method"`
+	TookMs    float64           `json:"took_ms"`
+	Status    int               `json:"status"`
+	Error     string            `json:"error,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Request   string            `json:"request"`
+	Response  string            `json:"response"`
+	Truncated bool              `json:"truncated,omitempty"`
+}
+
+// Filter for Query, empty values match everything
+type Filter struct {
+	NodeID uint64
+	Method string
+	Kind   string
+	Since  int64
+	Limit  int
+}
+
+// errors and samples are kept separately, so errors can't evict samples
+type ring_key struct {
+	node_id uint64
+	method  string
+	kind    int
+}
+
+type ring struct {
+	entries []Entry
+	pos     int
+	count   int
+}
+
+type settings struct {
+	enabled     bool
+	errors      bool
+	rate        float64
+	slowest     int
+	slow_window int64
+	size        int
+	max_body    int
+	max_total   int
+	redact      []string
+}
+
+var mu sync.Mutex
+var cfg = settings{}
+var rings = make(map[ring_key]*ring)
+var slow = make([]Entry, 0)
+var counters = make(map[string]int)
+var kept_bytes = 0
+
+// Fastest kept slow call (float64 bits) and time until which it's valid,
+// so calls which are not slow enough are skipped without locking mu
+var slow_min_bits uint64
+var slow_valid_ms int64
+
+var safe_headers = map[string]bool{"Content-Type": true, "Accept": true, "User-Agent": true, "X-Request-Id": true}
+
+// Reads CAPTURE section, capture is disabled if it's not present, eg.
+// "CAPTURE":{"rate":0.01, "errors":true, "slowest":20, "slow_window":900, "size":20, "max_body":16384,
+// "max_total":67108864, "redact_methods":"eth_sendRawTransaction,personal_*"}
+// size is the number of entries kept for every node and method, max_total
+// caps bytes of all kept bodies
+func init() {
+	raw, ok := config.Config().GetRawData("CAPTURE", "").(map[string]interface{})
+	if ok {
+		var errs config.PathErrors
+		cfg, errs = _read_config(raw, "CAPTURE")
+		for _, err := range errs {
+			log.Warn("Invalid CAPTURE config, using default", "err", err)
+		}
+	}
+
+	registerStatus()
+}
+
+// ConfigCheck validates CAPTURE section
+func ConfigCheck(raw interface{}, path string) []config.PathError {
+	_raw, ok := raw.(map[string]interface{})
+	if !ok {
+		return []config.PathError{{Path: path, Message: "expected object"}}
+	}
+	_, errs := _read_config(_raw, path)
+	return errs
+}
+
+func _read_config(raw map[string]interface{}, path string) (settings, config.PathErrors) {
+	ret := settings{enabled: true, errors: true, slowest: 10, slow_window: 900, size: 20, max_body: 16 * 1024,
+		max_total: 64 * 1024 * 1024, redact: default_redact}
+	errs := config.PathErrors{}
+
+	// rate is a fraction, other numbers are integers, size, max_body and
+	// slow_window need to be positive
+	_num := func(attr string, min, max float64) (float64, bool) {
+		v, exists := raw[attr]
+		if !exists {
+			return 0, false
+		}
+		if n, ok := v.(json.Number); ok {
+			f, err := n.Float64()
+			if err == nil && f >= min && f <= max && (attr == "rate" || f == float64(int64(f))) {
+				return f, true
+			}
+		}
+		if attr == "rate" {
+			errs.Add(config.PathKey(path, attr), "expected number between 0 and 1")
+		} else {
+			errs.Add(config.PathKey(path, attr), "expected integer >= %v", min)
+		}
+		return 0, false
+	}
+	if v, ok := raw["errors"].(bool); ok {
+		ret.errors = v
+	} else if _, exists := raw["errors"]; exists {
+		errs.Add(config.PathKey(path, "errors"), "expected bool")
+	}
+	if v, ok := _num("rate", 0, 1); ok {
+		ret.rate = v
+	}
+	if v, ok := _num("slowest", 0, math.MaxInt32); ok {
+		ret.slowest = int(v)
+	}
+	if v, ok := _num("slow_window", 1, math.MaxInt32); ok {
+		ret.slow_window = int64(v)
+	}
+	if v, ok := _num("size", 1, math.MaxInt32); ok {
+		ret.size = int(v)
+	}
+	if v, ok := _num("max_body", 1, math.MaxInt32); ok {
+		ret.max_body = int(v)
+	}
+	if v, ok := _num("max_total", 1, math.MaxInt64); ok {
+		ret.max_total = int(v)
+	}
+	if v, ok := raw["redact_methods"].(string); ok {
+		// configured methods are added to the defaults, they never replace them
+		ret.redact = append(make([]string, 0, len(default_redact)), default_redact...)
+		_exists := make(map[string]bool)
+		for _, m := range ret.redact {
+			_exists[m] = true
+		}
+		for _, m := range strings.Split(v, ",") {
+			if m = strings.Trim(m, "\r\n\t "); len(m) > 0 && !_exists[m] {
+				_exists[m] = true
+				ret.redact = append(ret.redact, m)
+			}
+		}
+	} else if _, exists := raw["redact_methods"]; exists {
+		errs.Add(config.PathKey(path, "redact_methods"), "expected comma separated list of methods")
+	}
+	return ret, errs
+}
+
+func IsEnabled() bool {
+	return cfg.enabled
+}
+
+func _kind_name(kind int) string {
+	switch kind {
+	case KIND_ERROR:
+		return "error"
+	case KIND_SLOW:
+		return "slow"
+	}
+	return "sample"
+}
+
+// Check returns kinds of capture the call qualifies for, 0 means that the
+// call shouldn't be captured so it's not needed to build the Entry
+func Check(took_ms float64, is_error bool) int {
+	if !cfg.enabled {
+		return 0
+	}
+
+	ret := 0
+	if is_error && cfg.errors {
+		ret |= KIND_ERROR
+	}
+	if !is_error && cfg.rate > 0 && rand.Float64() < cfg.rate {
+		ret |= KIND_SAMPLE
+	}
+	if !is_error && cfg.slowest > 0 {
+		// until a kept call expires the threshold can only grow, so calls
+		// below it don't need the lock
+		now := time.Now().UnixMilli()
+		if now < atomic.LoadInt64(&slow_valid_ms) && took_ms <= math.Float64frombits(atomic.LoadUint64(&slow_min_bits)) {
+			return ret
+		}
+
+		mu.Lock()
+		_expire_slow(now)
+		if len(slow) < cfg.slowest || took_ms > slow[len(slow)-1].TookMs {
+			ret |= KIND_SLOW
+		}
+		mu.Unlock()
+	}
+	return ret
+}
+
+func _size(e *Entry) int {
+	return len(e.Request) + len(e.Response)
+}
+
+// Removes expired slow calls and updates lock-free threshold, mu needs to
+// be locked
+func _expire_slow(now_ms int64) {
+	for i := 0; i < len(slow); i++ {
+		if now_ms-slow[i].TS > cfg.slow_window*1000 {
+			kept_bytes -= _size(&slow[i])
+			slow = append(slow[:i], slow[i+1:]...)
+			i--
+		}
+	}
+
+	if len(slow) < cfg.slowest {
+		atomic.StoreInt64(&slow_valid_ms, 0)
+		return
+	}
+	oldest := slow[0].TS
+	for i := range slow {
+		if slow[i].TS < oldest {
+			oldest = slow[i].TS
+		}
+	}
+	atomic.StoreUint64(&slow_min_bits, math.Float64bits(slow[len(slow)-1].TookMs))
+	atomic.StoreInt64(&slow_valid_ms, oldest+cfg.slow_window*1000)
+}
+
+func _match(patterns []string, method string) bool {
+	for _, p := range patterns {
+		if p == method || (strings.HasSuffix(p, "*") && strings.HasPrefix(method, p[:len(p)-1])) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactRequest removes params of redacted methods from JSON-RPC request,
+// default methods are used if capture is not enabled
+func RedactRequest(body []byte) string {
+	if !cfg.enabled {
+		return _redact_request(body, default_redact)
+	}
+	return _redact_request(body, cfg.redact)
+}
+
+// Params of calls to redacted methods are removed, the body is kept as is
+// if it's not valid JSON-RPC
+func _redact_request(body []byte, patterns []string) string {
+	if len(patterns) == 0 {
+		return string(body)
+	}
+
+	_redact_call := func(call map[string]interface{}) bool {
+		m, _ := call["method"].(string)
+		if _, ok := call["params"]; ok && _match(patterns, m) {
+			call["params"] = redacted
+			return true
+		}
+		return false
+	}
+
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if dec.Decode(&v) != nil {
+		return string(body)
+	}
+	changed := false
+	switch vv := v.(type) {
+	case map[string]interface{}:
+		changed = _redact_call(vv)
+	case []interface{}:
+		for _, item := range vv {
+			if call, ok := item.(map[string]interface{}); ok {
+				changed = _redact_call(call) || changed
+			}
+		}
+	}
+	if !changed {
+		return string(body)
+	}
+	tmp, _ := json.Marshal(v)
+	return string(tmp)
+}
+
+func _truncate(s string, e *Entry) string {
+	if len(s) > cfg.max_body {
+		e.Truncated = true
+		return s[:cfg.max_body]
+	}
+	return s
+}
+
+// Record stores the call for every kind passed, request is redacted and
+// only values of safe headers are kept. Calls are dropped if kept bodies
+// would go over max_total
+func Record(e Entry, kinds int, header http.Header, request, response []byte) {
+	if kinds == 0 || !cfg.enabled {
+		return
+	}
+
+	e.TS = time.Now().UnixMilli()
+	e.Endpoint = config.Redact(e.Endpoint)
+	e.Error = config.Redact(e.Error)
+	if len(header) > 0 {
+		e.Headers = make(map[string]string, len(header))
+		for k, v := range header {
+			if safe_headers[http.CanonicalHeaderKey(k)] {
+				e.Headers[k] = strings.Join(v, ",")
+			} else {
+				e.Headers[k] = redacted
+			}
+		}
+	}
+	e.Request = _truncate(config.Redact(_redact_request(request, cfg.redact)), &e)
+	e.Response = _truncate(config.Redact(string(response)), &e)
+
+	size := _size(&e)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	for _, kind := range []int{KIND_ERROR, KIND_SAMPLE} {
+		if kinds&kind == 0 {
+			continue
+		}
+		_e := e
+		_e.Kind = _kind_name(kind)
+
+		key := ring_key{e.NodeID, e.Method, kind}
+		r, ok := rings[key]
+		if !ok && len(rings) >= max_keys {
+			key.method = "(other)"
+			r, ok = rings[key]
+		}
+		replaced := 0
+		if ok {
+			replaced = _size(&r.entries[r.pos])
+		}
+		if kept_bytes-replaced+size > cfg.max_total {
+			counters["dropped"]++
+			continue
+		}
+		if !ok {
+			r = &ring{entries: make([]Entry, cfg.size)}
+			rings[key] = r
+		}
+		counters[_e.Kind]++
+		kept_bytes += size - replaced
+		r.entries[r.pos] = _e
+		r.pos = (r.pos + 1) % len(r.entries)
+		if r.count < len(r.entries) {
+			r.count++
+		}
+	}
+
+	if kinds&KIND_SLOW != 0 {
+		_e := e
+		_e.Kind = _kind_name(KIND_SLOW)
+		_expire_slow(e.TS)
+		replaced := 0
+		if len(slow) >= cfg.slowest {
+			replaced = _size(&slow[len(slow)-1])
+		}
+		if kept_bytes-replaced+size > cfg.max_total {
+			counters["dropped"]++
+			return
+		}
+		counters[_e.Kind]++
+		kept_bytes += size
+		slow = append(slow, _e)
+		sort.SliceStable(slow, func(i, j int) bool { return slow[i].TookMs > slow[j].TookMs })
+		for len(slow) > cfg.slowest {
+			kept_bytes -= _size(&slow[len(slow)-1])
+			slow = slow[:len(slow)-1]
+		}
+		_expire_slow(e.TS)
+	}
+}
+
+// Query returns matching captures, newest first
+func Query(f Filter) []Entry {
+	mu.Lock()
+	ret := make([]Entry, 0)
+	_add := func(e *Entry) {
+		if f.NodeID > 0 && e.NodeID != f.NodeID {
+			return
+		}
+		if len(f.Method) > 0 && e.Method != f.Method {
+			return
+		}
+		if len(f.Kind) > 0 && e.Kind != f.Kind {
+			return
+		}
+		if f.Since > 0 && e.TS < f.Since*1000 {
+			return
+		}
+		ret = append(ret, *e)
+	}
+	for _, r := range rings {
+		for i := 0; i < r.count; i++ {
+			_add(&r.entries[i])
+		}
+	}
+	_expire_slow(time.Now().UnixMilli())
+	for i := range slow {
+		_add(&slow[i])
+	}
+	mu.Unlock()
+
+	sort.Slice(ret, func(i, j int) bool { return ret[i].TS > ret[j].TS })
+	if f.Limit > 0 && len(ret) > f.Limit {
+		ret = ret[:f.Limit]
+	}
+	return ret
+}
+
+// Counts returns number of captured calls by kind (and dropped because of
+// max_total), number of entries and bytes kept in memory
+func Counts() (map[string]int, int, int) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	ret := make(map[string]int, len(counters))
+	for k, v := range counters {
+		ret[k] = v
+	}
+	kept := len(slow)
+	for _, r := range rings {
+		kept += r.count
+	}
+	return ret, kept, kept_bytes
+}
@@ -0,0 +1,50 @@
+package capture
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/slawomir-pryczek/HSServer/handler_socket2"
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/hscommon"
+)
+
+const status_entries = 10
+
+func registerStatus() {
+
+	handler_socket2.StatusPluginRegisterData(func() (string, string) {
+		if !cfg.enabled {
+			return "EVM Proxy - Request Capture", "<pre>Capture is disabled, add CAPTURE section to the config to enable it</pre>"
+		}
+
+		counts, kept, kept_bytes := Counts()
+		info := fmt.Sprintf("Errors captured: %v, sample rate: %.4f, slowest %d calls of last %ds\n", cfg.errors, cfg.rate, cfg.slowest, cfg.slow_window)
+		info += fmt.Sprintf("Up to %d entries per node and method, bodies truncated to %d bytes, redacted methods: %s\n",
+			cfg.size, cfg.max_body, html.EscapeString(strings.Join(cfg.redact, ", ")))
+		info += fmt.Sprintf("Captured: %d errors, %d samples, %d slow, dropped over memory limit: %d. Kept in memory: %d (%s of %s)\n",
+			counts["error"], counts["sample"], counts["slow"], counts["dropped"], kept, hscommon.FormatBytes(uint64(kept_bytes)),
+			hscommon.FormatBytes(uint64(cfg.max_total)))
+		info += "Use evm_admin_capture action to download captures as JSON lines\n"
+
+		table := hscommon.NewTableGen("Time", "Kind", "Node", "Method", "Took", "Status", "Error", "Request ID")
+		table.SetClass("tab evm")
+		now := time.Now().UnixMilli()
+		for _, e := range Query(Filter{Limit: status_entries}) {
+			_time := "now"
+			if now-e.TS >= 1000 {
+				_time = hscommon.FormatTime(int((now-e.TS)/1000)) + " ago"
+			}
+			table.AddRow(_time, e.Kind, fmt.Sprintf("#%d", e.NodeID),
+				html.EscapeString(e.Method), fmt.Sprintf("%.2fms", e.TookMs), fmt.Sprintf("%d", e.Status),
+				html.EscapeString(e.Error), html.EscapeString(e.RequestID))
+		}
+
+		return "EVM Proxy - Request Capture", "<pre>" + info + "</pre>" + table.Render()
+	}, func() (string, interface{}) {
+		counts, kept, kept_bytes := Counts()
+		return "EVM Proxy - Request Capture", map[string]interface{}{"enabled": cfg.enabled, "captured": counts, "kept": kept,
+			"kept_bytes": kept_bytes}
+	})
+}
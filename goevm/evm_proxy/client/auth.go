@@ -0,0 +1,144 @@
+package client
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/config"
+)
+
+const (
+	AUTH_JWT   = "jwt"
+	AUTH_BASIC = "basic"
+	AUTH_QUERY = "query"
+)
+
+// Auth adds credentials to every request sent to the node, secrets are
+// never returned by any of the methods
+type Auth struct {
+	mu sync.Mutex
+
+	mode string
+
+	// jwt, HS256 signed tokens with iat claim (engine API convention),
+	// minted again when less than 1/3 of ttl is left
+	jwt_secret    []byte
+	jwt_ttl       int64
+	jwt_token     string
+	jwt_issued_at int64
+
+	username string
+	password string
+
+	param string
+	key   string
+}
+
+// MakeAuth creates auth from node's auth block, eg. {"type":"jwt", "secret":"0x..", "ttl":60},
+// {"type":"basic", "username":"..", "password":".."} or {"type":"query", "param":"apikey", "key":".."}
+func MakeAuth(cfg map[string]string) (*Auth, error) {
+	ret := &Auth{mode: strings.ToLower(cfg["type"])}
+
+	switch ret.mode {
+	case AUTH_JWT:
+		secret := strings.TrimPrefix(cfg["secret"], "0x")
+		if len(secret) == 0 {
+			return nil, fmt.Errorf("jwt auth needs secret")
+		}
+		if b, err := hex.DecodeString(secret); err == nil {
+			ret.jwt_secret = b
+		} else {
+			ret.jwt_secret = []byte(cfg["secret"])
+		}
+		ret.jwt_ttl = 60
+		if ttl, err := json.Number(cfg["ttl"]).Int64(); err == nil && ttl > 0 {
+			ret.jwt_ttl = ttl
+		}
+		config.RegisterSecret(cfg["secret"])
+
+	case AUTH_BASIC:
+		ret.username, ret.password = cfg["username"], cfg["password"]
+		if len(ret.username) == 0 {
+			return nil, fmt.Errorf("basic auth needs username")
+		}
+		config.RegisterSecret(ret.password)
+
+	case AUTH_QUERY:
+		ret.param, ret.key = cfg["param"], cfg["key"]
+		if len(ret.param) == 0 {
+			ret.param = "apikey"
+		}
+		if len(ret.key) == 0 {
+			return nil, fmt.Errorf("query auth needs key")
+		}
+		config.RegisterSecret(ret.key)
+
+	default:
+		return nil, fmt.Errorf("unknown auth type %s, supported types are jwt, basic and query", cfg["type"])
+	}
+
+	return ret, nil
+}
+
+func _b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func (this *Auth) _jwt(now int64) string {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if len(this.jwt_token) > 0 && now < this.jwt_issued_at+this.jwt_ttl-this.jwt_ttl/3 {
+		return this.jwt_token
+	}
+
+	claims, _ := json.Marshal(map[string]int64{"iat": now, "exp": now + this.jwt_ttl})
+	unsigned := _b64([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + _b64(claims)
+	mac := hmac.New(sha256.New, this.jwt_secret)
+	mac.Write([]byte(unsigned))
+
+	this.jwt_token = unsigned + "." + _b64(mac.Sum(nil))
+	this.jwt_issued_at = now
+	return this.jwt_token
+}
+
+// Apply adds the credentials to the request
+func (this *Auth) Apply(req *http.Request) {
+	switch this.mode {
+	case AUTH_JWT:
+		req.Header.Set("Authorization", "Bearer "+this._jwt(time.Now().Unix()))
+	case AUTH_BASIC:
+		req.SetBasicAuth(this.username, this.password)
+	case AUTH_QUERY:
+		q := req.URL.Query()
+		q.Set(this.param, this.key)
+		req.URL.RawQuery = q.Encode()
+	}
+}
+
+// Describe returns auth mode and its settings, without secrets
+func (this *Auth) Describe() (string, string) {
+	switch this.mode {
+	case AUTH_JWT:
+		this.mu.Lock()
+		defer this.mu.Unlock()
+		info := fmt.Sprintf("HS256 signed JWT, valid for %ds\nTokens are minted again before they expire", this.jwt_ttl)
+		if this.jwt_issued_at > 0 {
+			info += fmt.Sprintf("\nCurrent token issued %ds ago", time.Now().Unix()-this.jwt_issued_at)
+		}
+		return "JWT", info
+	case AUTH_BASIC:
+		return "Basic", "HTTP basic auth, user: " + this.username
+	case AUTH_QUERY:
+		return "Query Key", "API key sent in ?" + this.param + "= parameter"
+	}
+	return "-", ""
+}
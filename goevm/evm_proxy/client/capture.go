@@ -0,0 +1,34 @@
+package client
+
+import (
+	"fmt"
+	"goevm/evm_proxy/capture"
+	"net/http"
+	"time"
+)
+
+// Pass the call to the capture buffer if it qualifies, rpc_error is the
+// JSON-RPC error returned with HTTP 200, mu can't be locked
+func (this *EVMClient) _capture(ts_started int64, stat_method, request_id string, req *http.Request, resp *http.Response,
+	err error, rpc_error string, post, body []byte) {
+
+	took_ms := float64(time.Now().UnixNano()-ts_started) / 1e6
+	is_error := err != nil || resp == nil || resp.StatusCode != 200 || len(rpc_error) > 0
+	kinds := capture.Check(took_ms, is_error)
+	if kinds == 0 {
+		return
+	}
+
+	e := capture.Entry{RequestID: request_id, NodeID: this.id, Endpoint: this.GetEndpoint(), Method: stat_method, TookMs: took_ms}
+	if resp != nil {
+		e.Status = resp.StatusCode
+	}
+	if err != nil {
+		e.Error = err.Error()
+	} else if len(rpc_error) > 0 {
+		e.Error = "JSON-RPC error: " + rpc_error
+	} else if is_error {
+		e.Error = fmt.Sprintf("HTTP status %d", e.Status)
+	}
+	capture.Record(e, kinds, req.Header, post, body)
+}
@@ -1,13 +1,22 @@
 package client
 
 import (
+	"fmt"
+	"goevm/evm_proxy/alert"
+	"goevm/evm_proxy/audit"
 	"goevm/evm_proxy/client/throttle"
 	"net/http"
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/config"
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/hslog"
 )
 
+var log = hslog.Get("node")
+var log_health = hslog.Get("health")
+
 type EVMClientAttr int
 
 const (
@@ -18,81 +27,295 @@ func (this *EVMClient) SetAttr(attrs EVMClientAttr) {
 	this.attr = attrs
 }
 
-func (this *EVMClient) SetPaused(paused bool, comment string) {
+func (this *EVMClient) SetTags(tags []string) {
+	this.mu.Lock()
+	this.tags = tags
+	this.mu.Unlock()
+}
+
+// SetProvider sets the name of provider running the node, it's used to
+// estimate the cost of requests in usage accounting
+func (this *EVMClient) SetProvider(provider string) {
+	this.mu.Lock()
+	this.provider = provider
+	this.mu.Unlock()
+}
+
+func (this *EVMClient) GetProvider() string {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return this.provider
+}
+
+// SetPublic changes node type, connection limits are kept as they were
+// when the node was created
+func (this *EVMClient) SetPublic(public bool) {
+	this.mu.Lock()
+	this.is_public_node = public
+	this.mu.Unlock()
+}
+
+// SetScoreModifier changes node's score, lower score is picked first
+func (this *EVMClient) SetScoreModifier(m int) {
+	this.mu.Lock()
+	this.score_modifier = m
+	throttle.ThrottleGoup(this.throttle).SetScoreModifier(m)
+	this.mu.Unlock()
+}
+
+func (this *EVMClient) SetProbeTime(probe_time int) {
+	this.mu.Lock()
+	this._probe_time = probe_time
+	this.mu.Unlock()
+}
+
+// SetThrottle replaces throttle limits, current usage of the old limits is
+// discarded, other stats and the score modifier are kept
+func (this *EVMClient) SetThrottle(thr []*throttle.Throttle) {
+	this.mu.Lock()
+	throttle.ThrottleGoup(thr).SetScoreModifier(this.score_modifier)
+	this.throttle = thr
+	this.mu.Unlock()
+}
+
+// GetRunning returns number of requests in progress
+func (this *EVMClient) GetRunning() int {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return this.stat_running
+}
+
+// Close stops maintenance and probing, it should be called after the node
+// was removed and its requests finished
+func (this *EVMClient) Close() {
+	this.mu.Lock()
+	this.is_closed = true
+	this.mu.Unlock()
+	this.client.CloseIdleConnections()
+}
+
+// HasAnyTag returns true if the node is tagged with at least one of the tags
+func (this *EVMClient) HasAnyTag(tags []string) bool {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	for _, tag := range tags {
+		for _, v := range this.tags {
+			if v == tag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SetPaused pauses or resumes the node, actor is the admin or subsystem
+// doing the change, state changes are written to audit log. Nodes paused
+// manually can only be resumed manually
+func (this *EVMClient) SetPaused(actor string, paused bool, comment string) {
+	var e *audit.Entry
 	this.mu.Lock()
+	if !this.is_paused_manual {
+		e = this._set_paused(actor, paused, comment)
+	}
+	this.mu.Unlock()
+	_audit_log(e)
+}
+
+// SetPausedManual pauses or resumes the node on admin's request, automatic
+// changes (eg. by health checker) are ignored until it's resumed
+func (this *EVMClient) SetPausedManual(actor string, paused bool, comment string) {
+	this.mu.Lock()
+	e := this._set_paused(actor, paused, comment)
+	this.is_paused_manual = paused
+	this.mu.Unlock()
+	_audit_log(e)
+}
+
+// mu needs to be locked, returned audit entry (if any) should be logged
+// after it's unlocked
+func (this *EVMClient) _set_paused(actor string, paused bool, comment string) *audit.Entry {
+	var ret *audit.Entry
+	if this.is_paused != paused {
+		action := "resume"
+		if paused {
+			action = "pause"
+		}
+		ret = this._audit(actor, action, paused, this.is_disabled, comment)
+	}
 	this.is_paused = paused
 	if this.is_paused {
 		this.is_paused_comment = comment
 	}
-	this.mu.Unlock()
+	return ret
 }
 
 type EVMClient struct {
 	id                      uint64
 	client                  *http.Client
 	endpoint                string
+	endpoint_ref            string
 	header                  http.Header
+	auth                    *Auth
 	is_public_node          bool
+	tags                    []string
+	provider                string
 	available_block_last    int
 	available_block_last_ts int64
 
 	is_disabled       bool
 	is_paused         bool
 	is_paused_comment string
+	is_paused_manual  bool
 	is_throttled      bool
+	is_rate_limited   bool
+	is_closed         bool
 	pause_comment     string
 	throttle_comment  string
 	disabled_comment  string
 
-	stat_running     int
-	stat_total       stat
-	stat_last_60     [60]stat
-	stat_last_60_pos int
+	rate_limited_until int64
+	created            int64
+	timeline           timeline
+
+	stat_running      int
+	stat_total        stat
+	stat_slots        [60]stat // stat_slot_sec seconds each, 15 minutes total
+	stat_slots_pos    int
+	stat_slot         int64 // current slot, unix time / stat_slot_sec
+	stat_history_last stat
 
 	mu        sync.Mutex
 	serial_no uint64
 
-	attr     EVMClientAttr
-	throttle []*throttle.Throttle
+	attr           EVMClientAttr
+	throttle       []*throttle.Throttle
+	score_modifier int
 
 	_probe_time       int
 	_probe_time_until int64
 	_probe_log        string
 
-	_last_error LastError
+	errors error_history
+
+	latency map[string]*method_latency
 }
 
 type EVMClientinfo struct {
 	ID                      uint64
 	Endpoint                string
 	Is_public_node          bool
+	Tags                    []string
 	Available_block_last    int
 	Available_block_last_ts int64
 	Is_disabled             bool
 	Is_throttled            bool
 	Is_paused               bool
+	Is_paused_manual        bool
+
+	Attr           EVMClientAttr
+	Score          int
+	Score_modifier int
+	Probe_time     int
+}
 
-	Attr  EVMClientAttr
-	Score int
+// GetID returns node's ID, it's assigned when the client is created and
+// never changes
+func (this *EVMClient) GetID() uint64 {
+	return this.id
 }
 
+// GetEndpoint returns node's URL for display, secrets are never included
 func (this *EVMClient) GetEndpoint() string {
 	this.mu.Lock()
-	ret := this.endpoint
+	ret := this._endpoint_display()
 	this.mu.Unlock()
 
 	return ret
 }
 
+// URL with secret references as defined in config (eg. ${env:NAME}), or
+// the URL with resolved secrets redacted
+func (this *EVMClient) _endpoint_display() string {
+	if len(this.endpoint_ref) > 0 {
+		return this.endpoint_ref
+	}
+	return config.Redact(this.endpoint)
+}
+
+func (this *EVMClient) SetAuth(auth *Auth) {
+	this.mu.Lock()
+	this.auth = auth
+	this.mu.Unlock()
+}
+
+// SetEndpoint replaces node's URL and headers, used when secrets are
+// re-resolved after config reload. Endpoint ref is the URL with secret
+// references, which is displayed instead of the real URL
+func (this *EVMClient) SetEndpoint(endpoint, endpoint_ref string, header http.Header) {
+	this.mu.Lock()
+	this.endpoint = endpoint
+	this.endpoint_ref = endpoint_ref
+	this.header = header
+	this.mu.Unlock()
+}
+
+func _audit_state(is_paused, is_disabled bool) string {
+	ret := "active"
+	if is_paused {
+		ret = "paused"
+	}
+	if is_disabled {
+		ret += ",disabled"
+	}
+	return ret
+}
+
+// _audit logs change of paused / disabled state and raises alerts, needs
+// to be called with mu locked, before the new state is set. Audit log can
+// write to file, so the entry is returned to be logged with _audit_log
+// after mu is unlocked
+func (this *EVMClient) _audit(actor, action string, is_paused, is_disabled bool, reason string) *audit.Entry {
+	log_health.Warn("Node state changed", "node", this.id, "endpoint", this._endpoint_display(), "actor", actor,
+		"action", action, "state", _audit_state(is_paused, is_disabled), "reason", reason)
+	ret := &audit.Entry{TS: time.Now().Unix(), Actor: actor, Action: action, NodeID: this.id, Endpoint: this._endpoint_display(),
+		Before: _audit_state(this.is_paused, this.is_disabled), After: _audit_state(is_paused, is_disabled), Reason: reason}
+
+	msg := fmt.Sprintf("Node is now %s, changed by %s", _audit_state(is_paused, is_disabled), actor)
+	if len(reason) > 0 {
+		msg += ", " + reason
+	}
+	if is_paused != this.is_paused {
+		this._timeline_add(STATE_PAUSED, is_paused, reason)
+		alert.Fire(alert.Event{Rule: alert.RULE_NODE_PAUSED, NodeID: this.id, Endpoint: this._endpoint_display(),
+			Message: msg, Active: is_paused})
+	}
+	if is_disabled != this.is_disabled {
+		this._timeline_add(STATE_DISABLED, is_disabled, reason)
+		alert.Fire(alert.Event{Rule: alert.RULE_NODE_DISABLED, NodeID: this.id, Endpoint: this._endpoint_display(),
+			Message: msg, Active: is_disabled})
+	}
+	return ret
+}
+
+func _audit_log(e *audit.Entry) {
+	if e != nil {
+		audit.Log(*e)
+	}
+}
+
 func (this *EVMClient) GetInfo() *EVMClientinfo {
 	ret := EVMClientinfo{}
 
 	this.mu.Lock()
 	ret.ID = this.id
-	ret.Endpoint = this.endpoint
+	ret.Endpoint = this._endpoint_display()
 	ret.Is_public_node = this.is_public_node
+	ret.Tags = this.tags
 	ret.Is_disabled = this.is_disabled
 	ret.Is_paused = this.is_paused
+	ret.Is_paused_manual = this.is_paused_manual
+	ret.Score_modifier = this.score_modifier
+	ret.Probe_time = this._probe_time
 	ret.Available_block_last = this.available_block_last
 	ret.Available_block_last_ts = this.available_block_last_ts
 
@@ -108,7 +331,7 @@ func (this *EVMClient) GetInfo() *EVMClientinfo {
 
 var new_client_id = uint64(0)
 
-func MakeClient(endpoint string, header http.Header, is_public_node bool, probe_time int, max_conns int, throttle []*throttle.Throttle) *EVMClient {
+func MakeClient(endpoint string, header http.Header, auth *Auth, is_public_node bool, probe_time int, max_conns int, throttle []*throttle.Throttle) *EVMClient {
 
 	tr := &http.Transport{
 		MaxIdleConns:       max_conns,
@@ -120,20 +343,23 @@ func MakeClient(endpoint string, header http.Header, is_public_node bool, probe_
 	ret.client = &http.Client{Transport: tr, Timeout: 5 * time.Second}
 	ret.endpoint = endpoint
 	ret.header = header
+	ret.auth = auth
 	ret.is_public_node = is_public_node
 	ret._probe_time = probe_time
 	ret.stat_total.stat_request_by_fn = make(map[string]int)
 
-	// Initialize stat_last_60 array
+	// Initialize stat_slots array
 	for i := 0; i < 60; i++ {
-		ret.stat_last_60[i].stat_request_by_fn = make(map[string]int)
+		ret.stat_slots[i].stat_request_by_fn = make(map[string]int)
 	}
-	ret.stat_last_60_pos = 0
+	ret.stat_slots_pos = 0
+	ret.stat_slot = time.Now().Unix() / stat_slot_sec
 
 	ret.throttle = throttle
+	ret.id = atomic.AddUint64(&new_client_id, 1)
+	ret.created = time.Now().Unix()
 	ret._maintenance()
 
-	ret.id = atomic.AddUint64(&new_client_id, 1)
 	return &ret
 }
 
@@ -0,0 +1,217 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"goevm/evm_proxy/capture"
+
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/config"
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/hscommon"
+)
+
+// Error classes, JSON-RPC errors are returned by the node with HTTP 200 so
+// they're recorded, but not counted as node's errors in health stats
+const (
+	ERR_REQUEST     = "request"
+	ERR_RESPONSE    = "response"
+	ERR_HTTP_STATUS = "http_status"
+	ERR_READ        = "read"
+	ERR_DECODE      = "decode"
+	ERR_RPC         = "rpc_error"
+)
+
+const error_history_size = 50
+const error_payload_max = 1024
+
+type ErrorEntry struct {
+	TS      int64  `json:"ts"`
+	Class   string `json:"class"`
+	Code    int    `json:"code,omitempty"`
+	Method  string `json:"method"`
+	Message string `json:"message"`
+	Payload string `json:"payload"`
+	Details string `json:"details,omitempty"`
+}
+
+type error_history struct {
+	entries  []ErrorEntry
+	pos      int
+	count    int
+	total    int
+	by_class map[string]int
+	since    int64
+}
+
+func _error_truncate(s string) string {
+	if len(s) > error_payload_max {
+		return s[:error_payload_max] + "..."
+	}
+	return s
+}
+
+// Request as stored in error history, params of sensitive methods are
+// redacted the same way as in captures. It's parsed so call it before
+// locking mu
+func _error_payload(post []byte) string {
+	if len(post) == 0 {
+		return ""
+	}
+	return config.Redact(_error_truncate(capture.RedactRequest(post)))
+}
+
+// Add error to node's history, payload comes from _error_payload, mu needs
+// to be locked
+func (this *EVMClient) _error_add(class string, code int, method, message string, payload string, details string) {
+	h := &this.errors
+	if h.entries == nil {
+		h.entries = make([]ErrorEntry, error_history_size)
+		h.by_class = make(map[string]int)
+		h.since = time.Now().Unix()
+	}
+
+	h.entries[h.pos] = ErrorEntry{TS: time.Now().Unix(), Class: class, Code: code, Method: method,
+		Message: config.Redact(message), Payload: payload,
+		Details: config.Redact(_error_truncate(details))}
+	h.pos = (h.pos + 1) % len(h.entries)
+	if h.count < len(h.entries) {
+		h.count++
+	}
+	h.total++
+	h.by_class[class]++
+}
+
+// Class, code and message of failed HTTP request, body is the response
+func _http_error_info(resp *http.Response, err error, body []byte) (string, int, string, string) {
+	if resp == nil || err != nil {
+		msg := "No response from host"
+		if err != nil {
+			msg = err.Error()
+		}
+		return ERR_RESPONSE, 0, msg, ""
+	}
+
+	tmp := make([]string, 0, 10)
+	if len(resp.Header) > 0 {
+		tmp = append(tmp, "Response Headers:")
+		for k, v := range resp.Header {
+			tmp = append(tmp, k+": "+strings.Join(v, ", "))
+		}
+		tmp = append(tmp, "")
+	}
+	tmp = append(tmp, "Body:\n"+string(body))
+	return ERR_HTTP_STATUS, resp.StatusCode, "HTTP: " + resp.Status, strings.Join(tmp, "\n")
+}
+
+type rpc_error struct {
+	Code    int
+	Message string
+}
+
+// JSON-RPC errors in node's response, for batches every error is returned
+func _rpc_errors(body []byte) []rpc_error {
+	if !bytes.Contains(body, []byte(`"error"`)) {
+		return nil
+	}
+
+	type rpc_response struct {
+		Error *rpc_error
+	}
+	responses := make([]rpc_response, 0, 1)
+	if trimmed := bytes.TrimLeft(body, " \r\n\t"); len(trimmed) > 0 && trimmed[0] == '[' {
+		json.Unmarshal(body, &responses)
+	} else {
+		r := rpc_response{}
+		json.Unmarshal(body, &r)
+		responses = append(responses, r)
+	}
+
+	ret := make([]rpc_error, 0)
+	for _, r := range responses {
+		if r.Error != nil {
+			ret = append(ret, *r.Error)
+		}
+	}
+	return ret
+}
+
+// GetErrors returns recent errors, newest first, and number of errors by
+// class since the history was cleared
+func (this *EVMClient) GetErrors() ([]ErrorEntry, map[string]int) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return this._errors()
+}
+
+func (this *EVMClient) _errors() ([]ErrorEntry, map[string]int) {
+	h := &this.errors
+	ret := make([]ErrorEntry, 0, h.count)
+	for i := 1; i <= h.count; i++ {
+		ret = append(ret, h.entries[(h.pos-i+len(h.entries))%len(h.entries)])
+	}
+	by_class := make(map[string]int, len(h.by_class))
+	for k, v := range h.by_class {
+		by_class[k] = v
+	}
+	return ret, by_class
+}
+
+// ClearErrors removes node's error history, returns number of errors
+// which were removed
+func (this *EVMClient) ClearErrors() int {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	ret := this.errors.total
+	this.errors = error_history{}
+	return ret
+}
+
+// Badge info and expandable error log, mu needs to be locked
+func (this *EVMClient) _errors_status() (int, string, string) {
+	h := &this.errors
+	if h.total == 0 {
+		return 0, "", ""
+	}
+
+	entries, by_class := this._errors()
+	classes := make([]string, 0, len(by_class))
+	for k := range by_class {
+		classes = append(classes, k)
+	}
+	sort.Strings(classes)
+
+	badge := fmt.Sprintf("%d errors since %s\n", h.total, time.Unix(h.since, 0).Format("2006-01-02 15:04:05"))
+	for _, k := range classes {
+		badge += fmt.Sprintf("%s: %d\n", k, by_class[k])
+	}
+	e := entries[0]
+	badge += fmt.Sprintf("\nLast error @%s / %s\n%s", time.Unix(e.TS, 0).Format("2006-01-02 15:04:05"), e.Class, e.Message)
+
+	now := time.Now().Unix()
+	table := hscommon.NewTableGen("Time", "Class", "Code", "Method", "Message", "Payload")
+	table.SetClass("tab evm")
+	for _, e := range entries {
+		_time := "now"
+		if now-e.TS > 0 {
+			_time = hscommon.FormatTime(int(now-e.TS)) + " ago"
+		}
+		_code := "-"
+		if e.Code != 0 {
+			_code = fmt.Sprintf("%d", e.Code)
+		}
+		_message := html.EscapeString(e.Message)
+		if len(e.Details) > 0 {
+			_message = "<span class='tooltip'>" + _message + "<div>" + html.EscapeString(e.Details) + "</div></span>"
+		}
+		table.AddRow(_time, e.Class, _code, html.EscapeString(e.Method), _message, "<code>"+html.EscapeString(e.Payload)+"</code>")
+	}
+
+	log := fmt.Sprintf("<details><summary>Error log (%d recent, %d total)</summary>", len(entries), h.total) + table.Render() + "</details>"
+	return h.total, badge, log
+}
@@ -0,0 +1,200 @@
+package client
+
+import (
+	"fmt"
+	"html"
+	"sort"
+	"time"
+
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/hscommon"
+)
+
+// Latency is kept in 15s slots for the last 15 minutes, every slot has a
+// histogram with exponential buckets, percentiles are interpolated
+const latency_slot_sec = 15
+const latency_slots = 60
+const latency_max_methods = 100
+
+var latency_bounds_ms = []float64{1, 2, 3, 5, 7, 10, 15, 20, 30, 50, 75, 100, 150, 200, 300, 500, 750,
+	1000, 1500, 2000, 3000, 5000, 7500, 10000, 15000, 30000}
+
+var latency_windows = []struct {
+	name string
+	sec  int64
+}{{"1m", 60}, {"5m", 300}, {"15m", 900}}
+
+type latency_slot struct {
+	slot     int64
+	requests int
+	errors   int
+	buckets  []int
+}
+
+type method_latency struct {
+	total  int
+	errors int
+	slots  [latency_slots]latency_slot
+}
+
+type LatencyWindow struct {
+	Requests int     `json:"requests"`
+	Errors   int     `json:"errors"`
+	P50      float64 `json:"p50_ms"`
+	P90      float64 `json:"p90_ms"`
+	P99      float64 `json:"p99_ms"`
+}
+
+type MethodStats struct {
+	Requests int                      `json:"requests"`
+	Errors   int                      `json:"errors"`
+	Windows  map[string]LatencyWindow `json:"windows"`
+}
+
+func (this *method_latency) _slot(now int64) *latency_slot {
+	slot := now / latency_slot_sec
+	s := &this.slots[slot%latency_slots]
+	if s.slot != slot {
+		*s = latency_slot{slot: slot}
+	}
+	return s
+}
+
+func (this *method_latency) add(now int64, took_ns int64, is_error bool) {
+	s := this._slot(now)
+	s.requests++
+	this.total++
+	if is_error {
+		s.errors++
+		this.errors++
+		return
+	}
+
+	if s.buckets == nil {
+		s.buckets = make([]int, len(latency_bounds_ms)+1)
+	}
+	ms := float64(took_ns) / 1e6
+	b := sort.SearchFloat64s(latency_bounds_ms, ms)
+	s.buckets[b]++
+}
+
+func _latency_percentile(buckets []int, count int, p float64) float64 {
+	if count == 0 {
+		return 0
+	}
+
+	rank := p * float64(count)
+	seen := 0
+	for b, n := range buckets {
+		if n == 0 || float64(seen+n) < rank {
+			seen += n
+			continue
+		}
+
+		lo, hi := 0.0, latency_bounds_ms[len(latency_bounds_ms)-1]
+		if b > 0 {
+			lo = latency_bounds_ms[b-1]
+		}
+		if b < len(latency_bounds_ms) {
+			hi = latency_bounds_ms[b]
+		} else {
+			return lo
+		}
+		return lo + (hi-lo)*(rank-float64(seen))/float64(n)
+	}
+	return latency_bounds_ms[len(latency_bounds_ms)-1]
+}
+
+func (this *method_latency) window(now int64, sec int64) LatencyWindow {
+	ret := LatencyWindow{}
+	buckets := make([]int, len(latency_bounds_ms)+1)
+	count := 0
+	from := (now - sec) / latency_slot_sec
+	for i := range this.slots {
+		s := &this.slots[i]
+		if s.slot <= from || s.slot > now/latency_slot_sec {
+			continue
+		}
+		ret.Requests += s.requests
+		ret.Errors += s.errors
+		for b, n := range s.buckets {
+			buckets[b] += n
+			count += n
+		}
+	}
+
+	ret.P50 = _latency_percentile(buckets, count, 0.5)
+	ret.P90 = _latency_percentile(buckets, count, 0.9)
+	ret.P99 = _latency_percentile(buckets, count, 0.99)
+	return ret
+}
+
+// Record request's latency or error, mu needs to be locked
+func (this *EVMClient) _latency_add(method string, took_ns int64, is_error bool) {
+	if len(method) == 0 {
+		return
+	}
+	if this.latency == nil {
+		this.latency = make(map[string]*method_latency)
+	}
+
+	ml, ok := this.latency[method]
+	if !ok {
+		if len(this.latency) >= latency_max_methods {
+			method = "(other)"
+			ml = this.latency[method]
+		}
+		if ml == nil {
+			ml = &method_latency{}
+			this.latency[method] = ml
+		}
+	}
+	ml.add(time.Now().Unix(), took_ns, is_error)
+}
+
+// GetMethodStats returns request and error counts and latency percentiles
+// for every method sent to the node
+func (this *EVMClient) GetMethodStats() map[string]MethodStats {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return this._method_stats()
+}
+
+func (this *EVMClient) _method_stats() map[string]MethodStats {
+	now := time.Now().Unix()
+	ret := make(map[string]MethodStats, len(this.latency))
+	for method, ml := range this.latency {
+		ms := MethodStats{Requests: ml.total, Errors: ml.errors, Windows: make(map[string]LatencyWindow)}
+		for _, w := range latency_windows {
+			ms.Windows[w.name] = ml.window(now, w.sec)
+		}
+		ret[method] = ms
+	}
+	return ret
+}
+
+// Expandable table with per method latencies, mu needs to be locked
+func (this *EVMClient) _latency_status() string {
+	stats := this._method_stats()
+	if len(stats) == 0 {
+		return ""
+	}
+
+	_p := func(w LatencyWindow) string {
+		if w.Requests-w.Errors == 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%.1f / %.1f / %.1f ms", w.P50, w.P90, w.P99)
+	}
+
+	table := hscommon.NewTableGen("Method", "Requests", "Errors", "Req 1m / 5m / 15m", "Err 15m",
+		"1m p50 / p90 / p99", "15m p50 / p90 / p99")
+	table.SetClass("tab evm")
+	for method, ms := range stats {
+		w1, w5, w15 := ms.Windows["1m"], ms.Windows["5m"], ms.Windows["15m"]
+		table.AddRow(html.EscapeString(method), fmt.Sprintf("%d", ms.Requests), fmt.Sprintf("%d", ms.Errors),
+			fmt.Sprintf("%d / %d / %d", w1.Requests, w5.Requests, w15.Requests), fmt.Sprintf("%d", w15.Errors),
+			_p(w1), _p(w15))
+	}
+
+	return fmt.Sprintf("<details><summary>Latency by method (%d)</summary>", len(stats)) + table.RenderSorted(0) + "</details>"
+}
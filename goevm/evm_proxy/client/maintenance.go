@@ -2,39 +2,86 @@ package client
 
 import (
 	"fmt"
+	"goevm/evm_proxy/alert"
+	"goevm/evm_proxy/audit"
 	"goevm/evm_proxy/client/throttle"
 	"time"
 )
 
 func (this *EVMClient) _maintenance() {
 
-	_maint_stat := func(now int64) {
+	// health is evaluated when the stat slot changes, or when forced
+	_maint_stat := func(now int64, force bool) {
 		this.mu.Lock()
 
-		// Update stat_last_60
-		this.stat_last_60_pos = (this.stat_last_60_pos + 1) % 60
-		this.stat_last_60[this.stat_last_60_pos] = stat{
-			stat_request_by_fn: make(map[string]int),
+		// Rotate stat_slots, slots which were skipped are cleared too
+		slot := now / stat_slot_sec
+		if slot == this.stat_slot && !force {
+			this.mu.Unlock()
+			return
 		}
+		advance := slot - this.stat_slot
+		if advance > int64(len(this.stat_slots)) {
+			advance = int64(len(this.stat_slots))
+		}
+		for ; advance > 0; advance-- {
+			this.stat_slots_pos = (this.stat_slots_pos + 1) % len(this.stat_slots)
+			this.stat_slots[this.stat_slots_pos] = stat{
+				stat_request_by_fn: make(map[string]int),
+			}
+		}
+		this.stat_slot = slot
 
 		throttle.ThrottleGoup(this.throttle).OnMaintenance(int(now))
 
+		var _audit_entry *audit.Entry
 		_d, _req_ok, _req_err, _log := this._statsIsDead()
+		if _d != this.is_disabled {
+			action := "enable"
+			if _d {
+				action = "disable"
+			}
+			_audit_entry = this._audit(audit.ACTOR_MAINTENANCE, action, this.is_paused, _d, _log)
+		}
 		this.is_disabled = _d
 		this._probe_log = _log
 
-		// if we don't have at least 1 requests,
+		// if we don't have at least 1 request in health window,
 		// run a request to check if the node is alive
 		// this._probe_time related
 		if _req_ok+_req_err < 1 && this._probe_time > 0 {
 			lastUpdateAge := now - (this.available_block_last_ts / 1000) // Convert ms to s
-			if lastUpdateAge > 5 {                                       // Only check if last update was more than 5s ago
+			// health is checked every stat slot, idle nodes are probed at
+			// most once per probe time
+			if lastUpdateAge > 5 && lastUpdateAge > int64(this._probe_time) {
 				go func() {
 					this.GetLastAvailableBlock()
 				}()
 			}
 		}
 		this.mu.Unlock()
+		_audit_log(_audit_entry)
+	}
+
+	// throttle limits are checked every second, so alerts know when the
+	// node runs out of capacity. Stats of the previous second go to history
+	_maint_throttle := func(now int64) {
+		this.mu.Lock()
+		score := throttle.ThrottleGoup(this.throttle).GetThrottleScore()
+		this._history_add(now-1, float64(score.CapacityUsed)/100.0)
+		if score.Throttled != this.is_throttled {
+			this.is_throttled = score.Throttled
+			_msg := fmt.Sprintf("Throttle capacity used %.02f%%", float64(score.CapacityUsed)/100.0)
+			log_health.Info("Node throttle state changed", "node", this.id, "throttled", score.Throttled)
+			this._timeline_add(STATE_THROTTLED, score.Throttled, _msg)
+			alert.Fire(alert.Event{Rule: alert.RULE_NODE_THROTTLED, NodeID: this.id, Endpoint: this._endpoint_display(),
+				Message: _msg, Active: score.Throttled})
+		}
+		if this.is_rate_limited && now >= this.rate_limited_until {
+			this.is_rate_limited = false
+			this._timeline_add(STATE_RATE_LIMITED, false, "No HTTP 429 since retry time")
+		}
+		this.mu.Unlock()
 	}
 
 	_update_last_block := func() {
@@ -48,7 +95,7 @@ func (this *EVMClient) _maintenance() {
 		if lastUpdateAge > 3 {
 			_, _ok := this.GetLastAvailableBlock()
 			if _ok != R_OK {
-				fmt.Println("Health: Can't get last block for: ", this.endpoint)
+				log_health.Warn("Can't get last block", "node", this.id, "endpoint", this.GetEndpoint())
 				return
 			}
 		}
@@ -66,11 +113,21 @@ func (this *EVMClient) _maintenance() {
 				continue
 			}
 
+			this.mu.Lock()
+			closed, pt := this.is_closed, int64(this._probe_time)
+			this.mu.Unlock()
+			if closed {
+				return
+			}
+
 			// update last block
 			now = _t
 
+			_maint_stat(now, false)
+			_maint_throttle(now)
+
 			// if we have probing time set - use that
-			if pt := int64(this._probe_time); pt > 0 {
+			if pt > 0 {
 				pt_by2 := pt * 2
 				if now%pt_by2 == pt {
 					_update_last_block()
@@ -79,5 +136,5 @@ func (this *EVMClient) _maintenance() {
 		}
 	}()
 
-	_maint_stat(time.Now().Unix())
+	_maint_stat(time.Now().Unix(), true)
 }
@@ -0,0 +1,50 @@
+package client
+
+import (
+	"goevm/evm_proxy/client/throttle"
+	"strconv"
+
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/metrics"
+)
+
+func _bool_gauge(v bool) float64 {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+// WriteMetrics adds node's counters and state, samples are labeled with
+// node id and redacted endpoint
+func (this *EVMClient) WriteMetrics(w *metrics.Writer) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	node, endpoint := strconv.FormatUint(this.id, 10), this._endpoint_display()
+	s := this.stat_total
+
+	w.Counter("evm_node_requests_total", "Requests completed by the node", float64(s.stat_done), "node", node, "endpoint", endpoint)
+	_errors := []struct {
+		class string
+		count int
+	}{{"json_marshal", s.stat_error_json_marshal}, {"request", s.stat_error_req}, {"response", s.stat_error_resp},
+		{"response_read", s.stat_error_resp_read}, {"json_decode", s.stat_error_json_decode}}
+	for _, e := range _errors {
+		w.Counter("evm_node_errors_total", "Failed requests by error class", float64(e.count), "node", node, "endpoint", endpoint, "class", e.class)
+	}
+	w.Counter("evm_node_sent_bytes_total", "Bytes sent to the node", float64(s.stat_bytes_sent), "node", node, "endpoint", endpoint)
+	w.Counter("evm_node_received_bytes_total", "Bytes received from the node", float64(s.stat_bytes_received), "node", node, "endpoint", endpoint)
+	w.Counter("evm_node_request_seconds_total", "Time spent waiting for the node", float64(s.stat_ns_total)/1e9, "node", node, "endpoint", endpoint)
+	for method, count := range s.stat_request_by_fn {
+		w.Counter("evm_node_method_requests_total", "Requests sent to the node by method", float64(count), "node", node, "endpoint", endpoint, "method", method)
+	}
+
+	score := throttle.ThrottleGoup(this.throttle).GetThrottleScore()
+	w.Gauge("evm_node_throttle_capacity_used_percent", "Highest throttle capacity used", float64(score.CapacityUsed), "node", node, "endpoint", endpoint)
+	w.Gauge("evm_node_throttled", "1 if the node is throttled", _bool_gauge(score.Throttled), "node", node, "endpoint", endpoint)
+	w.Gauge("evm_node_paused", "1 if the node is paused", _bool_gauge(this.is_paused), "node", node, "endpoint", endpoint)
+	w.Gauge("evm_node_disabled", "1 if the node is disabled because of errors", _bool_gauge(this.is_disabled), "node", node, "endpoint", endpoint)
+	w.Gauge("evm_node_public", "1 if the node is public", _bool_gauge(this.is_public_node), "node", node, "endpoint", endpoint)
+	w.Gauge("evm_node_available_block", "Last block reported by the node", float64(this.available_block_last), "node", node, "endpoint", endpoint)
+	w.Gauge("evm_node_running_requests", "Requests in progress", float64(this.stat_running), "node", node, "endpoint", endpoint)
+}
@@ -5,7 +5,6 @@ package client
 import (
 	"bytes"
 	"encoding/json"
-	"log"
 	"strconv"
 	"strings"
 	"time"
@@ -18,6 +17,7 @@ const (
 	R_OK        ResponseType = 0
 	R_ERROR     ResponseType = 1
 	R_THROTTLED ResponseType = 2
+	R_TOO_LARGE ResponseType = 3
 )
 
 func (this *EVMClient) _intcall(method string) (int, ResponseType) {
@@ -39,7 +39,7 @@ func (this *EVMClient) _intcall(method string) (int, ResponseType) {
 		}
 		return int(_ret), r_type
 	default:
-		log.Printf("Error in response for %s: %s", method, string(ret))
+		log.Warn("Error in response", "node", this.id, "method", method, "response", string(ret))
 	}
 	return 0, R_ERROR
 }
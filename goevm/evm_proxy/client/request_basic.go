@@ -2,46 +2,63 @@ package client
 
 import (
 	"bytes"
+	"fmt"
 	"goevm/evm_proxy/client/throttle"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"time"
 
 	"encoding/json"
+
+	"github.com/slawomir-pryczek/HSServer/handler_socket2"
 )
 
-func (this *EVMClient) RequestForward(body []byte) (ResponseType, []byte) {
+// RequestForward sends client's JSON-RPC request to the node, request_id
+// is passed to the node in X-Request-Id header
+func (this *EVMClient) RequestForward(body []byte, request_id string) (ResponseType, []byte) {
 	var method string
 
 	// Attempt to unmarshal the body to an empty interface
 	var jsonData interface{}
 	if err := json.Unmarshal(body, &jsonData); err != nil {
+		payload := _error_payload(body)
 		this.mu.Lock()
 		this.stat_total.stat_error_json_decode++
-		this.stat_last_60[this.stat_last_60_pos].stat_error_json_decode++
+		this.stat_slots[this.stat_slots_pos].stat_error_json_decode++
+		this._error_add(ERR_DECODE, 0, "", err.Error(), payload, "")
 		this.mu.Unlock()
 		return R_ERROR, []byte(`{"error":"json unmarshal error"}`)
 	}
 
-	// Check the type of the decoded value
+	// Check the type of the decoded value, latency of batches is recorded
+	// under (batch) as it can't be attributed to a single method
+	methods := make([]string, 0)
+	stat_method := ""
 	switch jsonData.(type) {
 	case []interface{}:
 		// JSON array - EVM batch requests
 		jsonArray := jsonData.([]interface{})
-		if len(jsonArray) > 0 {
-			// Take the method from the first item of the array
-			if obj, ok := jsonArray[0].(map[string]interface{}); ok {
+		for _, item := range jsonArray {
+			if obj, ok := item.(map[string]interface{}); ok {
 				if m, ok := obj["method"].(string); ok {
-					method = m
+					methods = append(methods, m)
 				}
 			}
 		}
+		// Take the method from the first item of the array
+		if len(methods) > 0 {
+			method = methods[0]
+		}
+		stat_method = "(batch)"
 	case map[string]interface{}:
 		// JSON object - standard EVM request
 		jsonObject := jsonData.(map[string]interface{})
 		if m, ok := jsonObject["method"].(string); ok {
 			method = m
+			methods = append(methods, m)
 		}
+		stat_method = method
 	default:
 		// Neither object nor array, return error
 		return R_ERROR, []byte(`{"error":"invalid json format"}`)
@@ -61,16 +78,21 @@ func (this *EVMClient) RequestForward(body []byte) (ResponseType, []byte) {
 	throttle.ThrottleGoup(this.throttle).OnRequest(method)
 	this.mu.Unlock()
 
-	// Update stats
+	// Update stats, methods are client supplied so over the limit they're
+	// counted as (other), same as latency
 	this.mu.Lock()
-	this.stat_total.stat_request_by_fn[method]++
+	_fn := method
+	if _, ok := this.stat_total.stat_request_by_fn[_fn]; !ok && len(this.stat_total.stat_request_by_fn) >= latency_max_methods {
+		_fn = "(other)"
+	}
+	this.stat_total.stat_request_by_fn[_fn]++
 	this.stat_running++
 	this.stat_total.stat_bytes_sent += len(body)
-	this.stat_last_60[this.stat_last_60_pos].stat_bytes_sent += len(body)
+	this.stat_slots[this.stat_slots_pos].stat_bytes_sent += len(body)
 	this.mu.Unlock()
 
 	// Make the request
-	ret, r_type := this.RequestBasic(string(body))
+	ret, r_type := this._requestBasic(handler_socket2.GetSizeLimits().MaxResponseBytes(methods...), stat_method, request_id, string(body))
 	if r_type != R_OK {
 		// No need to decrease stat_running here as it's handled in _docall
 		return r_type, []byte(`{"error":"request failed"}`)
@@ -80,6 +102,19 @@ func (this *EVMClient) RequestForward(body []byte) (ResponseType, []byte) {
 }
 
 func (this *EVMClient) RequestBasic(method_param ...string) ([]byte, ResponseType) {
+	return this._requestBasic(-1, "", "", method_param...)
+}
+
+// RequestBasicID is RequestBasic for client's requests, request_id is
+// passed to the node in X-Request-Id header
+func (this *EVMClient) RequestBasicID(request_id string, method_param ...string) ([]byte, ResponseType) {
+	return this._requestBasic(-1, "", request_id, method_param...)
+}
+
+// Response is limited to max_response_bytes, -1 means that the limit
+// configured for the method should be used. Stats are collected for
+// stat_method, if it's empty the method is taken from the request
+func (this *EVMClient) _requestBasic(max_response_bytes int, stat_method string, request_id string, method_param ...string) ([]byte, ResponseType) {
 	ts_started := time.Now().UnixNano()
 
 	// Check if client is paused or disabled
@@ -95,12 +130,23 @@ func (this *EVMClient) RequestBasic(method_param ...string) ([]byte, ResponseTyp
 	if len(method_param) == 1 {
 		// If a full JSON-RPC request is provided
 		post = []byte(method_param[0])
+		if len(stat_method) == 0 {
+			tmp := struct{ Method string }{}
+			json.Unmarshal(post, &tmp)
+			stat_method = tmp.Method
+		}
 	} else {
 		// If we need to construct a JSON-RPC request
 		method := "eth_blockNumber" // Default method
 		if len(method_param) > 0 {
 			method = method_param[0]
 		}
+		if len(stat_method) == 0 {
+			stat_method = method
+		}
+		if max_response_bytes == -1 {
+			max_response_bytes = handler_socket2.GetSizeLimits().MaxResponseBytes(method)
+		}
 
 		params := []interface{}{}
 		if len(method_param) > 1 {
@@ -123,7 +169,8 @@ func (this *EVMClient) RequestBasic(method_param ...string) ([]byte, ResponseTyp
 		if err != nil {
 			this.mu.Lock()
 			this.stat_total.stat_error_json_marshal++
-			this.stat_last_60[this.stat_last_60_pos].stat_error_json_marshal++
+			this.stat_slots[this.stat_slots_pos].stat_error_json_marshal++
+			this._error_add(ERR_REQUEST, 0, method, err.Error(), "", "")
 			this.mu.Unlock()
 			return nil, R_ERROR
 		}
@@ -132,19 +179,14 @@ func (this *EVMClient) RequestBasic(method_param ...string) ([]byte, ResponseTyp
 	// Update bytes sent stats
 	this.mu.Lock()
 	this.stat_total.stat_bytes_sent += len(post)
-	this.stat_last_60[this.stat_last_60_pos].stat_bytes_sent += len(post)
+	this.stat_slots[this.stat_slots_pos].stat_bytes_sent += len(post)
 	this.mu.Unlock()
 
 	// Make the request
-	ret := this._docall(ts_started, post)
-	if ret == nil {
-		return nil, R_ERROR
-	}
-
-	return ret, R_OK
+	return this._docall(ts_started, post, max_response_bytes, stat_method, request_id)
 }
 
-func (this *EVMClient) _docall(ts_started int64, post []byte) []byte {
+func (this *EVMClient) _docall(ts_started int64, post []byte, max_response_bytes int, stat_method string, request_id string) ([]byte, ResponseType) {
 	decreaseRunning := true
 	defer func() {
 		if decreaseRunning {
@@ -156,59 +198,112 @@ func (this *EVMClient) _docall(ts_started int64, post []byte) []byte {
 		}
 	}()
 
-	// Create request
-	req, err := http.NewRequest("POST", this.endpoint, bytes.NewBuffer(post))
+	// Create request, endpoint and headers can be replaced when config is re-read
+	this.mu.Lock()
+	endpoint, header, auth := this.endpoint, this.header, this.auth
+	this.mu.Unlock()
+	req, err := http.NewRequest("POST", endpoint, bytes.NewBuffer(post))
 	if err != nil {
+		payload := _error_payload(post)
 		this.mu.Lock()
 		this.stat_total.stat_error_req++
-		this.stat_last_60[this.stat_last_60_pos].stat_error_req++
-		this._last_error = *isGenericError(err, post)
+		this.stat_slots[this.stat_slots_pos].stat_error_req++
+		this._latency_add(stat_method, 0, true)
+		this._error_add(ERR_REQUEST, 0, stat_method, err.Error(), payload, "")
 		this.mu.Unlock()
-		return nil
+		return nil, R_ERROR
 	}
 
 	// Set headers
 	req.Header.Set("Content-Type", "application/json")
-	if this.header != nil {
-		for k, v := range this.header {
+	if header != nil {
+		for k, v := range header {
 			for _, vv := range v {
 				req.Header.Add(k, vv)
 			}
 		}
 	}
 
+	if len(request_id) > 0 {
+		req.Header.Set(handler_socket2.REQUEST_ID_HEADER, request_id)
+	}
+
+	if auth != nil {
+		auth.Apply(req)
+	}
+
 	// Make the request
 	resp, err := this.client.Do(req)
 	if err != nil || resp == nil || resp.StatusCode != 200 {
+		body := []byte(nil)
+		if resp != nil && resp.Body != nil {
+			body, _ = ioutil.ReadAll(io.LimitReader(resp.Body, error_payload_max))
+			resp.Body.Close()
+		}
+		class, code, message, details := _http_error_info(resp, err, body)
+		payload := _error_payload(post)
+
 		this.mu.Lock()
+		if resp != nil && resp.StatusCode == http.StatusTooManyRequests {
+			this._rate_limited(resp.Header.Get("Retry-After"))
+		}
 		this.stat_total.stat_error_resp++
-		this.stat_last_60[this.stat_last_60_pos].stat_error_resp++
-		this._last_error = *isHTTPError(resp, err, post)
+		this.stat_slots[this.stat_slots_pos].stat_error_resp++
+		this._latency_add(stat_method, 0, true)
+		this._error_add(class, code, stat_method, message, payload, details)
 		this.mu.Unlock()
-		return nil
+		this._capture(ts_started, stat_method, request_id, req, resp, err, "", post, body)
+		return nil, R_ERROR
 	}
 	defer resp.Body.Close()
 
-	// Read response
-	body, err := ioutil.ReadAll(resp.Body)
+	// Read response, responses over the limit are not node's fault so they're
+	// not counted as errors
+	body_reader := io.Reader(resp.Body)
+	if max_response_bytes > 0 {
+		body_reader = io.LimitReader(resp.Body, int64(max_response_bytes)+1)
+	}
+	body, err := ioutil.ReadAll(body_reader)
 	if err != nil {
+		payload := _error_payload(post)
 		this.mu.Lock()
 		this.stat_total.stat_error_resp_read++
-		this.stat_last_60[this.stat_last_60_pos].stat_error_resp_read++
-		this._last_error = *isGenericError(err, post)
+		this.stat_slots[this.stat_slots_pos].stat_error_resp_read++
+		this._latency_add(stat_method, 0, true)
+		this._error_add(ERR_READ, 0, stat_method, err.Error(), payload, "")
 		this.mu.Unlock()
-		return nil
+		this._capture(ts_started, stat_method, request_id, req, resp, err, "", post, body)
+		return nil, R_ERROR
+	}
+	if max_response_bytes > 0 && len(body) > max_response_bytes {
+		return nil, R_TOO_LARGE
+	}
+
+	// JSON-RPC errors are parsed before locking
+	rpc_errors := _rpc_errors(body)
+	rpc_payload, rpc_message := "", ""
+	if len(rpc_errors) > 0 {
+		rpc_payload = _error_payload(post)
+		rpc_message = rpc_errors[0].Message
+		if len(rpc_errors) > 1 {
+			rpc_message += fmt.Sprintf(" (and %d more errors in batch)", len(rpc_errors)-1)
+		}
 	}
 
 	// Update stats
 	this.mu.Lock()
 	this.stat_total.stat_done++
-	this.stat_last_60[this.stat_last_60_pos].stat_done++
+	this.stat_slots[this.stat_slots_pos].stat_done++
 	this.stat_total.stat_ns_total += uint64(time.Now().UnixNano() - ts_started)
-	this.stat_last_60[this.stat_last_60_pos].stat_ns_total += uint64(time.Now().UnixNano() - ts_started)
+	this.stat_slots[this.stat_slots_pos].stat_ns_total += uint64(time.Now().UnixNano() - ts_started)
 	this.stat_total.stat_bytes_received += len(body)
-	this.stat_last_60[this.stat_last_60_pos].stat_bytes_received += len(body)
+	this.stat_slots[this.stat_slots_pos].stat_bytes_received += len(body)
+	this._latency_add(stat_method, time.Now().UnixNano()-ts_started, false)
+	if len(rpc_errors) > 0 {
+		this._error_add(ERR_RPC, rpc_errors[0].Code, stat_method, rpc_message, rpc_payload, "")
+	}
 	this.mu.Unlock()
+	this._capture(ts_started, stat_method, request_id, req, resp, nil, rpc_message, post, body)
 
-	return body
+	return body, R_OK
 }
@@ -2,6 +2,8 @@ package client
 
 import (
 	"fmt"
+
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/history"
 )
 
 type stat struct {
@@ -18,24 +20,91 @@ type stat struct {
 	stat_bytes_sent     int
 }
 
+// stat_slots keeps 60 slots of stat_slot_sec seconds, 15 minutes total
+const stat_slot_sec = 15
+
+// Health is decided on requests from this window, so old errors expire
+const stat_health_window = 300
+
+var stat_windows = []struct {
+	name string
+	sec  int
+}{{"Last 1m", 60}, {"Last 5m", 300}, {"Last 15m", 900}}
+
+func (this *stat) add(s *stat) {
+	this.stat_error_req += s.stat_error_req
+	this.stat_error_resp += s.stat_error_resp
+	this.stat_error_resp_read += s.stat_error_resp_read
+	this.stat_error_json_decode += s.stat_error_json_decode
+	this.stat_error_json_marshal += s.stat_error_json_marshal
+	this.stat_done += s.stat_done
+	this.stat_ns_total += s.stat_ns_total
+	this.stat_bytes_received += s.stat_bytes_received
+	this.stat_bytes_sent += s.stat_bytes_sent
+}
+
+func (this *stat) errors() int {
+	return this.stat_error_req + this.stat_error_resp + this.stat_error_resp_read + this.stat_error_json_decode
+}
+
+// Sum of last seconds of stat_slots, including current slot, mu needs to
+// be locked
+func (this *EVMClient) _statWindow(seconds int) stat {
+	ret := stat{}
+	slots := seconds / stat_slot_sec
+	if slots > len(this.stat_slots) {
+		slots = len(this.stat_slots)
+	}
+	for i := 0; i < slots; i++ {
+		pos := (this.stat_slots_pos - i + len(this.stat_slots)) % len(this.stat_slots)
+		ret.add(&this.stat_slots[pos])
+	}
+	return ret
+}
+
+// _history_add writes stats since the previous call to history, mu needs
+// to be locked. Series are keyed by the redacted endpoint, as IDs are only
+// valid until restart
+func (this *EVMClient) _history_add(ts int64, throttle_used float64) {
+	cur, prev := &this.stat_total, &this.stat_history_last
+	v := history.Values{}
+	v[history.FIELD_REQUESTS] = float64(cur.stat_done - prev.stat_done)
+	v[history.FIELD_ERRORS] = float64(cur.errors() - prev.errors())
+	v[history.FIELD_TIME_MS] = float64(cur.stat_ns_total-prev.stat_ns_total) / 1000000
+	v[history.FIELD_BYTES_IN] = float64(cur.stat_bytes_received - prev.stat_bytes_received)
+	v[history.FIELD_BYTES_OUT] = float64(cur.stat_bytes_sent - prev.stat_bytes_sent)
+	v[history.FIELD_THROTTLE] = throttle_used
+	this.stat_history_last = stat{}
+	this.stat_history_last.add(cur)
+
+	for _, val := range v {
+		if val != 0 {
+			history.Add("node:"+this._endpoint_display(), ts, v)
+			return
+		}
+	}
+}
+
 func (this *EVMClient) _statsIsDead() (bool, int, int, string) {
 	probe_time := this._probe_time
 	if probe_time < 30 {
 		probe_time = 30
 	}
 
-	stat_requests := this.stat_total.stat_done
-	stat_errors := this.stat_total.stat_error_resp +
-		this.stat_total.stat_error_resp_read +
-		this.stat_total.stat_error_json_decode
+	recent := this._statWindow(stat_health_window)
+	stat_requests := recent.stat_done
+	stat_errors := recent.stat_error_resp +
+		recent.stat_error_resp_read +
+		recent.stat_error_json_decode
 
-	// Node is considered dead if:
+	// Node is considered dead if there were errors in the health window and:
 	// 1. No probing and errors are more than 20% of requests
 	// 2. With probing and errors are more than or equal to 20% of requests
 	dead := this._probe_time == 0 && stat_errors*5 > stat_requests
 	dead = dead || this._probe_time > 0 && stat_errors*5 >= stat_requests
+	dead = dead && stat_errors > 0
 
-	log := fmt.Sprintf("Health probing time %ds, Total Requests: %d, Total Errors: %d",
-		probe_time, stat_requests, stat_errors)
+	log := fmt.Sprintf("Health probing time %ds, Last %ds Requests: %d, Errors: %d",
+		probe_time, stat_health_window, stat_requests, stat_errors)
 	return dead, stat_requests, stat_errors, log
 }
@@ -8,6 +8,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/config"
 	"github.com/slawomir-pryczek/HSServer/handler_socket2/hscommon"
 )
 
@@ -18,30 +19,41 @@ func init() {
 }
 
 func (this *EVMClient) GetStatus() string {
-	status_throttle := throttle.ThrottleGoup(this.throttle).GetThrottleScore()
-	out, status_description := node_status.Create(this.is_paused, status_throttle.Throttled, this.is_disabled)
+	// throttle and node settings can be replaced by admin or config reload
+	this.mu.Lock()
+	thr := this.throttle
+	header, auth, tags := this.header, this.auth, this.tags
+	score_modifier, is_public_node, probe_time := this.score_modifier, this.is_public_node, this._probe_time
+	is_paused, is_paused_comment, is_paused_manual := this.is_paused, this.is_paused_comment, this.is_paused_manual
+	is_disabled, probe_log := this.is_disabled, this._probe_log
+	stat_running := this.stat_running
+	_dead, _dead_r, _dead_e, _dead_comment := this._statsIsDead()
+	this.mu.Unlock()
+
+	status_throttle := throttle.ThrottleGoup(thr).GetThrottleScore()
+	out, status_description := node_status.Create(is_paused, status_throttle.Throttled, is_disabled)
 
 	// Node name and status description
 	{
 		header := ""
 		_t := "Private"
-		if this.is_public_node {
+		if is_public_node {
 			_t = "Public"
 		}
-		_e := this.endpoint
+		_e := html.EscapeString(this._endpoint_display())
 		_util := fmt.Sprintf("%.02f%%", float64(status_throttle.CapacityUsed)/100.0)
 		header += fmt.Sprintf("<b>%s Node #%d</b>, Score: %d, Utilization: %s, %s\n", _t, this.id, status_throttle.Score, _util, _e)
 		header += status_description
 		header += "\n"
-		header += this._probe_log
+		header += probe_log
 		out.SetHeader(header)
 	}
 
 	// Add basic badges
-	if this.header != nil && len(this.header) > 0 {
+	if len(header) > 0 {
 		h_ := ""
-		for k, v := range this.header {
-			vv := strings.Join(v, ", ")
+		for k, v := range header {
+			vv := config.Redact(strings.Join(v, ", "))
 
 			out := vv
 			if strings.Index(strings.ToLower(k), "authorization") != -1 && len(vv) > 5 {
@@ -53,44 +65,74 @@ func (this *EVMClient) GetStatus() string {
 			}
 			h_ += k + ": " + out + "<br>"
 		}
-		out.AddBadge(fmt.Sprintf("%d Header(s) defined", len(this.header)), node_status.Gray, h_)
+		out.AddBadge(fmt.Sprintf("%d Header(s) defined", len(header)), node_status.Gray, h_)
+	}
+
+	if auth != nil {
+		_mode, _info := auth.Describe()
+		out.AddBadge("Auth: "+_mode, node_status.Gray, html.EscapeString(_info))
+	}
+
+	if len(tags) > 0 {
+		out.AddBadge("Tags: "+html.EscapeString(strings.Join(tags, ", ")), node_status.Blue, "Requests made with API keys limited to\nthese tags can be routed to this node.")
 	}
 
-	out.AddBadge(fmt.Sprintf("%d Requests Running", this.stat_running), node_status.Gray, "Number of requests currently being processed.")
-	if this._probe_time >= 10 {
+	out.AddBadge(fmt.Sprintf("%d Requests Running", stat_running), node_status.Gray, "Number of requests currently being processed.")
+	if probe_time >= 10 {
 		out.AddBadge("Conserve Requests", node_status.Green, "Health checks are limited for\nthis node to conserve requests.\n\nIf you're paying per-request\nit's good to enable this mode.")
 	}
 
 	// Add throttling badges
-	throttle.ThrottleGoup(this.throttle).GetStatusBadges(out, node_status.Purple)
+	throttle.ThrottleGoup(thr).GetStatusBadges(out, node_status.Purple)
+	if score_modifier != 0 {
+		out.AddBadge(fmt.Sprintf("Score Modifier: %d", score_modifier), node_status.Blue, "Added to node's score,\nnodes with lower score are picked first.")
+	}
+
+	// show error counts if we have any, the log is added below stats
+	this.mu.Lock()
+	errors_total, errors_badge, errors_log := this._errors_status()
+	this.mu.Unlock()
+	if errors_total > 0 {
+		out.AddBadge(fmt.Sprintf("Has Errors: %d", errors_total), node_status.Orange, html.EscapeString(errors_badge))
+	}
 
-	// show last error if we have any
-	if this._last_error.counter > 0 {
-		last_error_header, last_error_details := this._last_error.Info()
-		_comment := html.EscapeString(last_error_header) + "\n" + html.EscapeString(last_error_details)
-		out.AddBadge(fmt.Sprintf("Has Errors: %d", this._last_error.counter), node_status.Orange, _comment)
+	this.mu.Lock()
+	timeline_badge, timeline_log, available_1h := this._timeline_status()
+	rate_limited := this.is_rate_limited
+	this.mu.Unlock()
+	_available := fmt.Sprintf("Available 1h: %.2f%%", available_1h)
+	_available_info := "Time without being paused, disabled,\nthrottled or rate limited\n\n" + timeline_badge
+	if available_1h < 99 {
+		out.AddBadge(_available, node_status.Orange, _available_info)
+	} else {
+		out.AddBadge(_available, node_status.Green, _available_info)
+	}
+	if rate_limited {
+		out.AddBadge("Rate Limited", node_status.Red, "Node responded with HTTP 429")
 	}
 
 	// Next health badge
 	{
-		_dead, r, e, _comment := this._statsIsDead()
-		_comment = "Node status which will be applied during the next update:\n" + _comment
+		_comment := "Node status which will be applied during the next update:\n" + _dead_comment
 		if _dead {
-			out.AddBadge(fmt.Sprintf("Predicted Not Healthy (%dR/%dE)", r, e), node_status.Red, _comment)
+			out.AddBadge(fmt.Sprintf("Predicted Not Healthy (%dR/%dE)", _dead_r, _dead_e), node_status.Red, _comment)
 		} else {
-			out.AddBadge(fmt.Sprintf("Predicted Healthy (%dR/%dE)", r, e), node_status.Green, _comment)
+			out.AddBadge(fmt.Sprintf("Predicted Healthy (%dR/%dE)", _dead_r, _dead_e), node_status.Green, _comment)
 		}
 	}
 
 	// Paused status
 	{
-		if this.is_paused {
+		if is_paused {
 			_p := "Node is paused"
-			if len(this.is_paused_comment) > 0 {
-				_p += ", reason:\n" + this.is_paused_comment
+			if len(is_paused_comment) > 0 {
+				_p += ", reason:\n" + is_paused_comment
 			} else {
 				_p += ", no additional info present"
 			}
+			if is_paused_manual {
+				_p += "\n\nPaused manually, it needs to be resumed by admin"
+			}
 			out.AddBadge("Paused", node_status.Gray, _p)
 		}
 	}
@@ -98,7 +140,7 @@ func (this *EVMClient) GetStatus() string {
 	// Generate content (throttle settings)
 	{
 		content := ""
-		for _, throttle := range this.throttle {
+		for _, throttle := range thr {
 			content += throttle.GetStatus()
 		}
 		out.AddContent(content)
@@ -109,7 +151,7 @@ func (this *EVMClient) GetStatus() string {
 		_get_row := func(label string, s stat, time_running int) []string {
 			_req := fmt.Sprintf("%d", s.stat_done)
 			_req_s := fmt.Sprintf("%.02f", float64(s.stat_done)/float64(time_running))
-			_req_avg := fmt.Sprintf("%.02f ms", (float64(s.stat_ns_total)/float64(s.stat_done))/1000.0)
+			_req_avg := fmt.Sprintf("%.02f ms", (float64(s.stat_ns_total)/float64(s.stat_done))/1000000.0)
 
 			_r := make([]string, 0, 10)
 			_r = append(_r, label, _req, _req_s, _req_avg)
@@ -128,6 +170,16 @@ func (this *EVMClient) GetStatus() string {
 		// Get current stats
 		this.mu.Lock()
 		r := this.stat_total
+		windows := make([]stat, len(stat_windows))
+		for num, w := range stat_windows {
+			windows[num] = this._statWindow(w.sec)
+		}
+		_requests, _errors := make([]int, 0, len(this.stat_slots)), make([]int, 0, len(this.stat_slots))
+		for i := 1; i <= len(this.stat_slots); i++ {
+			s := &this.stat_slots[(this.stat_slots_pos+i)%len(this.stat_slots)]
+			_requests = append(_requests, s.stat_done)
+			_errors = append(_errors, s.errors())
+		}
 		this.mu.Unlock()
 
 		// Statistics
@@ -136,9 +188,99 @@ func (this *EVMClient) GetStatus() string {
 		table.SetClass("tab evm")
 
 		time_running := time.Now().Unix() - start_time
+		for num, w := range stat_windows {
+			table.AddRow(_get_row(w.name, windows[num], w.sec)...)
+		}
 		table.AddRow(_get_row("Total", r, int(time_running))...)
 		out.AddContent(table.Render())
+
+		spark := fmt.Sprintf("Last 15 minutes, %ds per character\n", stat_slot_sec)
+		spark += "Requests " + _sparkline(_requests) + "\n"
+		spark += "Errors   " + _sparkline(_errors)
+		out.AddContent("<pre class='sparkline'>" + spark + "</pre>")
+
+		this.mu.Lock()
+		out.AddContent(this._latency_status())
+		this.mu.Unlock()
+		out.AddContent(errors_log)
+		out.AddContent(timeline_log)
 	}
 
 	return "\n" + out.GetHTML()
 }
+
+// GetStatusData returns node's state and statistics, for JSON status
+func (this *EVMClient) GetStatusData() map[string]interface{} {
+	info := this.GetInfo()
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	s := this.stat_total
+	by_method := make(map[string]int, len(s.stat_request_by_fn))
+	for k, v := range s.stat_request_by_fn {
+		by_method[k] = v
+	}
+	_dead, _, _, _ := this._statsIsDead()
+	stats := map[string]interface{}{
+		"requests":            s.stat_done,
+		"requests_running":    this.stat_running,
+		"time_ns":             s.stat_ns_total,
+		"err_json_marshal":    s.stat_error_json_marshal,
+		"err_request":         s.stat_error_req,
+		"err_response":        s.stat_error_resp,
+		"err_response_read":   s.stat_error_resp_read,
+		"err_json_decode":     s.stat_error_json_decode,
+		"bytes_sent":          s.stat_bytes_sent,
+		"bytes_received":      s.stat_bytes_received,
+		"requests_by_method":  by_method,
+		"capacity_used":       throttle.ThrottleGoup(this.throttle).GetThrottleScore().CapacityUsed,
+		"predicted_unhealthy": _dead,
+	}
+
+	ret := make(map[string]interface{})
+	ret["info"] = info
+	ret["stats"] = stats
+	ret["probe_log"] = this._probe_log
+	ret["methods"] = this._method_stats()
+	windows := make(map[string]interface{}, len(stat_windows))
+	for _, w := range stat_windows {
+		ws := this._statWindow(w.sec)
+		windows[fmt.Sprintf("%ds", w.sec)] = map[string]interface{}{"requests": ws.stat_done, "errors": ws.errors(), "time_ns": ws.stat_ns_total}
+	}
+	ret["windows"] = windows
+	if this.is_paused {
+		ret["paused_comment"] = this.is_paused_comment
+	}
+	if this.auth != nil {
+		ret["auth"], _ = this.auth.Describe()
+	}
+	ret["timeline"], ret["availability"] = this._timeline()
+	if this.errors.total > 0 {
+		recent, by_class := this._errors()
+		ret["errors"] = map[string]interface{}{"total": this.errors.total, "since": this.errors.since, "by_class": by_class, "recent": recent}
+	}
+	return ret
+}
+
+var sparkline_chars = []rune("▁▂▃▄▅▆▇█")
+
+// Values scaled to the highest one, zero is rendered as a dot
+func _sparkline(values []int) string {
+	max := 0
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+
+	ret := make([]rune, 0, len(values))
+	for _, v := range values {
+		if v == 0 {
+			ret = append(ret, '·')
+			continue
+		}
+		ret = append(ret, sparkline_chars[(v*(len(sparkline_chars)-1))/max])
+	}
+	return string(ret) + fmt.Sprintf(" (max %d)", max)
+}
@@ -39,13 +39,9 @@ func (this *Throttle) _getThrottleStatus(l *Limiter) (int, int) {
 	_in_windows := l.in_time_windows
 	_used := 0
 
+	// current window is included, then we go back in time
 	_pos := this.stats_pos
 	for i := 0; i < _in_windows; i++ {
-		_pos--
-		if _pos < 0 {
-			_pos = len(this.stats) - 1
-		}
-
 		switch l.t {
 		case L_REQUESTS:
 			_used += this.stats[_pos].stat_done
@@ -56,6 +52,11 @@ func (this *Throttle) _getThrottleStatus(l *Limiter) (int, int) {
 				_used += v
 			}
 		}
+
+		_pos--
+		if _pos < 0 {
+			_pos = len(this.stats) - 1
+		}
 	}
 
 	_score := 0
@@ -22,6 +22,7 @@ type Throttle struct {
 	limiters []Limiter
 
 	stats_pos                 int
+	stats_window              int
 	stats                     []stat
 	stats_window_size_seconds int
 
@@ -42,7 +43,8 @@ func MakeCustom(window_count, window_size_seconds int) *Throttle {
 
 	ret.stats = make([]stat, window_count)
 	ret.stats_window_size_seconds = window_size_seconds
-	ret.stats_pos = (int(time.Now().Unix()) / ret.stats_window_size_seconds) % len(ret.stats)
+	ret.stats_window = int(time.Now().Unix()) / ret.stats_window_size_seconds
+	ret.stats_pos = ret.stats_window % len(ret.stats)
 
 	for i := 0; i < len(ret.stats); i++ {
 		ret.stats[i].stat_request_by_fn = make(map[string]int)
@@ -69,61 +71,29 @@ func (this *Throttle) GetThrottleScore() ThrottleScore {
 }
 
 func (this *Throttle) OnMaintenance(now int) {
-	_pos := (now / this.stats_window_size_seconds) % len(this.stats)
-	if _pos == this.stats_pos {
+	_window := now / this.stats_window_size_seconds
+	if _window == this.stats_window {
 		return
 	}
 
-	// Clear stats for the new position
-	this.stats[_pos].stat_done = 0
-	this.stats[_pos].stat_bytes_received = 0
-	this.stats[_pos].stat_request_by_fn = make(map[string]int)
-	this.stats_pos = _pos
-
-	// Check if we're throttled
-	this.status_throttled = false
-	this.status_score = 0
-	this.status_capacity_used = 0
-
-	for _, limiter := range this.limiters {
-		_max := limiter.maximum
-		_in_windows := limiter.in_time_windows
-		_used := 0
-
-		_pos := this.stats_pos
-		for i := 0; i < _in_windows; i++ {
-			_pos--
-			if _pos < 0 {
-				_pos = len(this.stats) - 1
-			}
-
-			switch limiter.t {
-			case L_REQUESTS:
-				_used += this.stats[_pos].stat_done
-			case L_DATA_RECEIVED:
-				_used += this.stats[_pos].stat_bytes_received
-			case L_REQUESTS_PER_FN:
-				for _, v := range this.stats[_pos].stat_request_by_fn {
-					_used += v
-				}
-			}
-		}
-
-		_score := 0
-		if _max > 0 {
-			_score = (_used * 100) / _max
-		}
-		if _score > this.status_capacity_used {
-			this.status_capacity_used = _score
-		}
-		if _score > this.status_score {
-			this.status_score = _score
-		}
-
-		if _used >= _max {
-			this.status_throttled = true
-		}
+	// Clear stats for the new position and all windows skipped since last call
+	_skipped := _window - this.stats_window
+	if _skipped < 0 || _skipped > len(this.stats) {
+		_skipped = len(this.stats)
 	}
+	_pos := this.stats_pos
+	for i := 0; i < _skipped; i++ {
+		_pos = (_pos + 1) % len(this.stats)
+		this.stats[_pos].stat_done = 0
+		this.stats[_pos].stat_bytes_received = 0
+		this.stats[_pos].stat_request_by_fn = make(map[string]int)
+	}
+	this.stats_window = _window
+	this.stats_pos = _window % len(this.stats)
 
-	this.status_score += this.score_modifier
+	// Check if we're throttled
+	tmp := this._getThrottleScore()
+	this.status_throttled = tmp.Throttled
+	this.status_score = tmp.Score + this.score_modifier
+	this.status_capacity_used = tmp.CapacityUsed
 }
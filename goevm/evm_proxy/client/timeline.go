@@ -0,0 +1,204 @@
+package client
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"time"
+
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/hscommon"
+)
+
+// Node states recorded in the timeline, node is available when none of
+// them is active. Rate limited means that the node responded with HTTP 429
+const (
+	STATE_PAUSED       = "paused"
+	STATE_DISABLED     = "disabled"
+	STATE_THROTTLED    = "throttled"
+	STATE_RATE_LIMITED = "rate_limited"
+)
+
+var timeline_states = []string{STATE_PAUSED, STATE_DISABLED, STATE_THROTTLED, STATE_RATE_LIMITED}
+
+var availability_windows = []struct {
+	name string
+	sec  int64
+}{{"1h", 3600}, {"24h", 86400}, {"7d", 7 * 86400}}
+
+const timeline_max_events = 1000
+const timeline_max_age = 7 * 86400
+
+// Rate limited state is cleared after Retry-After, or after this many
+// seconds without HTTP 429 if the node didn't send it
+const rate_limit_default_sec = 60
+
+type TimelineEvent struct {
+	TS     int64  `json:"ts"`
+	State  string `json:"state"`
+	Active bool   `json:"active"`
+	Reason string `json:"reason,omitempty"`
+}
+
+type Availability struct {
+	Tracked   int64              `json:"tracked_sec"`
+	Available float64            `json:"available_pct"`
+	States    map[string]float64 `json:"states_pct"`
+}
+
+// events are kept for the longest availability window, states before the
+// first event are in base, starting at base_ts
+type timeline struct {
+	events  []TimelineEvent
+	base    map[string]bool
+	base_ts int64
+}
+
+// _timeline_add records state change, mu needs to be locked
+func (this *EVMClient) _timeline_add(state string, active bool, reason string) {
+	t := &this.timeline
+	now := time.Now().Unix()
+	if t.base == nil {
+		t.base = make(map[string]bool)
+		t.base_ts = this.created
+	}
+	t.events = append(t.events, TimelineEvent{TS: now, State: state, Active: active, Reason: reason})
+
+	drop := 0
+	for drop < len(t.events) && (len(t.events)-drop > timeline_max_events || now-t.events[drop].TS > timeline_max_age) {
+		t.base[t.events[drop].State] = t.events[drop].Active
+		t.base_ts = t.events[drop].TS
+		drop++
+	}
+	if drop > 0 {
+		t.events = append([]TimelineEvent{}, t.events[drop:]...)
+	}
+}
+
+// _rate_limited marks the node as rate limited after HTTP 429, until
+// Retry-After (in seconds) passes, mu needs to be locked
+func (this *EVMClient) _rate_limited(retry_after string) {
+	sec, err := strconv.Atoi(retry_after)
+	if err != nil || sec <= 0 {
+		sec = rate_limit_default_sec
+	}
+	this.rate_limited_until = time.Now().Unix() + int64(sec)
+	if !this.is_rate_limited {
+		this.is_rate_limited = true
+		this._timeline_add(STATE_RATE_LIMITED, true, fmt.Sprintf("HTTP 429, retry after %ds", sec))
+	}
+}
+
+// _availability computes time spent in every state during last seconds,
+// only the time since the node was created is counted, mu needs to be locked
+func (this *EVMClient) _availability(seconds int64) Availability {
+	t := &this.timeline
+	now := time.Now().Unix()
+	from := now - seconds
+	if from < this.created {
+		from = this.created
+	}
+
+	ret := Availability{Tracked: now - from, Available: 100, States: make(map[string]float64)}
+	if ret.Tracked <= 0 {
+		return ret
+	}
+
+	current := make(map[string]bool)
+	for k, v := range t.base {
+		current[k] = v
+	}
+	in_state := make(map[string]int64)
+	unavailable := int64(0)
+	_segment := func(start, end int64) {
+		if start < from {
+			start = from
+		}
+		if end <= start {
+			return
+		}
+		any := false
+		for _, state := range timeline_states {
+			if current[state] {
+				in_state[state] += end - start
+				any = true
+			}
+		}
+		if any {
+			unavailable += end - start
+		}
+	}
+
+	last := t.base_ts
+	for _, e := range t.events {
+		_segment(last, e.TS)
+		current[e.State] = e.Active
+		last = e.TS
+	}
+	_segment(last, now)
+
+	ret.Available = 100 * float64(ret.Tracked-unavailable) / float64(ret.Tracked)
+	for _, state := range timeline_states {
+		ret.States[state] = 100 * float64(in_state[state]) / float64(ret.Tracked)
+	}
+	return ret
+}
+
+// GetTimeline returns state changes, newest first, and availability for
+// 1h, 24h and 7d
+func (this *EVMClient) GetTimeline() ([]TimelineEvent, map[string]Availability) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return this._timeline()
+}
+
+func (this *EVMClient) _timeline() ([]TimelineEvent, map[string]Availability) {
+	events := make([]TimelineEvent, 0, len(this.timeline.events))
+	for i := len(this.timeline.events) - 1; i >= 0; i-- {
+		events = append(events, this.timeline.events[i])
+	}
+	availability := make(map[string]Availability, len(availability_windows))
+	for _, w := range availability_windows {
+		availability[w.name] = this._availability(w.sec)
+	}
+	return events, availability
+}
+
+// Badge text and expandable timeline, mu needs to be locked
+func (this *EVMClient) _timeline_status() (string, string, float64) {
+	events, availability := this._timeline()
+
+	badge := ""
+	table := hscommon.NewTableGen("Window", "Tracked", "Available", "Paused", "Disabled", "Throttled", "Rate Limited")
+	table.SetClass("tab evm")
+	for _, w := range availability_windows {
+		a := availability[w.name]
+		badge += fmt.Sprintf("%s: %.2f%%\n", w.name, a.Available)
+		row := []string{w.name, hscommon.FormatTime(int(a.Tracked)), fmt.Sprintf("%.2f%%", a.Available)}
+		for _, state := range timeline_states {
+			row = append(row, fmt.Sprintf("%.2f%%", a.States[state]))
+		}
+		table.AddRow(row...)
+	}
+
+	now := time.Now().Unix()
+	events_table := hscommon.NewTableGen("Time", "State", "Change", "Reason")
+	events_table.SetClass("tab evm")
+	for _, e := range events {
+		_time := "now"
+		if now-e.TS > 0 {
+			_time = hscommon.FormatTime(int(now-e.TS)) + " ago"
+		}
+		_change := "recovered"
+		if e.Active {
+			_change = "entered"
+		}
+		events_table.AddRow(_time+" ("+time.Unix(e.TS, 0).Format("2006-01-02 15:04:05")+")", e.State, _change, html.EscapeString(e.Reason))
+	}
+
+	content := fmt.Sprintf("<details><summary>Timeline (%d state changes)</summary>", len(events)) + table.Render()
+	if len(events) > 0 {
+		content += events_table.Render()
+	}
+	content += "</details>"
+	return badge, content, availability[availability_windows[0].name].Available
+}
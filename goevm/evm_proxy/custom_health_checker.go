@@ -2,13 +2,15 @@ package evm_proxy
 
 import (
 	"fmt"
+	"goevm/evm_proxy/audit"
 	"goevm/evm_proxy/client"
-	"strings"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/slawomir-pryczek/HSServer/handler_socket2"
 	"github.com/slawomir-pryczek/HSServer/handler_socket2/config"
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/metrics"
 )
 
 type custom_health_checker struct {
@@ -18,7 +20,9 @@ type custom_health_checker struct {
 	max_data_age_ms int64
 	max_block_lag   int
 
-	_log string
+	_log       string
+	_lag       map[uint64]int
+	_max_block int
 }
 
 var cc custom_health_checker
@@ -65,7 +69,19 @@ func init() {
 		}
 	}()
 
-	handler_socket2.StatusPluginRegister(func() (string, string) {
+	metrics.Register(func(w *metrics.Writer) {
+		cc.mu.Lock()
+		defer cc.mu.Unlock()
+		if cc._lag == nil {
+			return
+		}
+		w.Gauge("evm_health_max_block", "Highest block seen by the health checker", float64(cc._max_block))
+		for id, lag := range cc._lag {
+			w.Gauge("evm_health_block_lag", "Number of blocks the node is behind the highest block", float64(lag), "node", strconv.FormatUint(id, 10))
+		}
+	})
+
+	handler_socket2.StatusPluginRegisterData(func() (string, string) {
 		ret := "Custom health plugin will pause nodes when they start lagging\n"
 		ret += fmt.Sprintf("run_every: %d - run the check every X seconds\n", cc.run_every)
 		ret += fmt.Sprintf("max_block_lag: %d - maximum number of blocks which a node can lag behind, before being paused\n", cc.max_block_lag)
@@ -78,6 +94,22 @@ func init() {
 		}
 
 		return "EVM Proxy - Custom Health Plugin", "<pre>" + ret + "</pre>"
+	}, func() (string, interface{}) {
+		cc.mu.Lock()
+		defer cc.mu.Unlock()
+
+		lag := make(map[string]int, len(cc._lag))
+		for id, v := range cc._lag {
+			lag[strconv.FormatUint(id, 10)] = v
+		}
+		ret := make(map[string]interface{})
+		ret["run_every"] = cc.run_every
+		ret["max_block_lag"] = cc.max_block_lag
+		ret["max_data_age_ms"] = cc.max_data_age_ms
+		ret["max_block"] = cc._max_block
+		ret["block_lag"] = lag
+		ret["log"] = cc._log
+		return "EVM Proxy - Custom Health Plugin", ret
 	})
 }
 
@@ -142,6 +174,7 @@ func _run_custom_check() {
 	}
 
 	log := ""
+	lag := make(map[uint64]int, len(infos))
 	for num, info := range infos {
 		is_ok := max_block-info.Available_block_last <= max_block_lag
 		_is_ok := "OK     "
@@ -150,23 +183,24 @@ func _run_custom_check() {
 		}
 
 		for _, client := range clients {
-			if strings.Compare(client.GetEndpoint(), info.Endpoint) == 0 {
+			if client.GetInfo().ID == info.ID {
 				if is_ok {
-					client.SetPaused(!is_ok, "")
+					client.SetPaused(audit.ACTOR_HEALTH_CHECKER, !is_ok, "")
 					continue
 				}
 
 				if info.Available_block_last_ts == 0 {
-					client.SetPaused(!is_ok, "Paused by Custom Health Checker.\nCan't get last block")
+					client.SetPaused(audit.ACTOR_HEALTH_CHECKER, !is_ok, "Paused by Custom Health Checker.\nCan't get last block")
 					continue
 				}
-				client.SetPaused(!is_ok, fmt.Sprintf("Paused by Custom Health Checker.\nNode is lagging behind %d blocks (%d max)",
+				client.SetPaused(audit.ACTOR_HEALTH_CHECKER, !is_ok, fmt.Sprintf("Paused by Custom Health Checker.\nNode is lagging behind %d blocks (%d max)",
 					max_block-info.Available_block_last, max_block_lag))
 			}
 		}
 
 		_age_ms := float64((time.Now().UnixMilli() - info.Available_block_last_ts)) / 1000
 		_diff := max_block - info.Available_block_last
+		lag[info.ID] = _diff
 
 		log += fmt.Sprintf("Node #%d %s Score: %d, Block: %d/%d (%d diff) (%.2fs Age) %s\n",
 			num, _is_ok, info.Score,
@@ -176,5 +210,7 @@ func _run_custom_check() {
 
 	cc.mu.Lock()
 	cc._log = log
+	cc._lag = lag
+	cc._max_block = max_block
 	cc.mu.Unlock()
 }
@@ -0,0 +1,192 @@
+package iplimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"goevm/evm_proxy/client/throttle"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/slawomir-pryczek/HSServer/handler_socket2"
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/config"
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/hslog"
+)
+
+var log = hslog.Get("iplimit")
+
+type source struct {
+	ip       string
+	throttle []*throttle.Throttle
+
+	in_flight int
+	last_seen int64
+
+	stat_requests int
+	stat_rejected int
+	stat_bytes    int
+}
+
+type limits struct {
+	throttle_cfg   string
+	max_concurrent int
+	idle_cleanup   int64
+	exempt         []*net.IPNet
+}
+
+var mu sync.Mutex
+var sources = make(map[string]*source)
+var cfg = limits{}
+
+// Reads IP_LIMITS section and attaches the limiter to all listeners, does
+// nothing if the section is not present
+func init() {
+	raw, ok := config.Config().GetRawData("IP_LIMITS", "").(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	var errs config.PathErrors
+	cfg, errs = _read_config(raw, "IP_LIMITS")
+	for _, err := range errs {
+		log.Warn("Invalid IP_LIMITS config", "err", err)
+	}
+
+	thr, logs := throttle.MakeFromConfig(cfg.throttle_cfg)
+	for _, l := range logs {
+		log.Info("IP limits throttle", "throttle", l)
+	}
+	if thr == nil {
+		log.Warn("IP_LIMITS throttle config is invalid, per-IP limits disabled")
+		return
+	}
+	log.Info("IP limits configured", "max_concurrent", cfg.max_concurrent, "exempt_ranges", len(cfg.exempt))
+
+	handler_socket2.RequestLimiterRegister(onRequest)
+	registerStatus()
+
+	go func() {
+		for range time.Tick(30 * time.Second) {
+			cleanup(time.Now().Unix())
+		}
+	}()
+}
+
+// ConfigCheck validates IP_LIMITS section
+func ConfigCheck(raw interface{}, path string) []config.PathError {
+	_raw, ok := raw.(map[string]interface{})
+	if !ok {
+		return []config.PathError{{Path: path, Message: "expected object"}}
+	}
+	_, errs := _read_config(_raw, path)
+	return errs
+}
+
+func _read_config(raw map[string]interface{}, path string) (limits, config.PathErrors) {
+	ret := limits{idle_cleanup: 600}
+	errs := config.PathErrors{}
+
+	_int := func(attr string, min int64) (int64, bool) {
+		v, exists := raw[attr]
+		if !exists {
+			return 0, false
+		}
+		if n, ok := v.(json.Number); ok {
+			if i, err := n.Int64(); err == nil && i >= min {
+				return i, true
+			}
+		}
+		errs.Add(config.PathKey(path, attr), "expected integer >= %d", min)
+		return 0, false
+	}
+	_str := func(attr string) string {
+		v, ok := raw[attr].(string)
+		if _, exists := raw[attr]; exists && !ok {
+			errs.Add(config.PathKey(path, attr), "expected string")
+		}
+		return v
+	}
+
+	for attr := range raw {
+		switch attr {
+		case "throttle", "max_concurrent", "idle_cleanup", "exempt":
+		default:
+			errs.Add(config.PathKey(path, attr), "unknown IP_LIMITS attribute")
+		}
+	}
+
+	ret.throttle_cfg = _str("throttle")
+	if thr, logs := throttle.MakeFromConfig(ret.throttle_cfg); thr == nil && len(logs) > 0 {
+		errs.Add(config.PathKey(path, "throttle"), "%s", logs[len(logs)-1])
+	}
+	if v, ok := _int("max_concurrent", 0); ok {
+		ret.max_concurrent = int(v)
+	}
+	if v, ok := _int("idle_cleanup", 1); ok {
+		ret.idle_cleanup = v
+	}
+	exempt, _errs := handler_socket2.ParseIPRanges(_str("exempt"))
+	for _, err := range _errs {
+		errs.Add(config.PathKey(path, "exempt"), "%s", err.Error())
+	}
+	ret.exempt = exempt
+	return ret, errs
+}
+
+func _is_exempt(ip string) bool {
+	return handler_socket2.IPInRanges(cfg.exempt, net.ParseIP(ip))
+}
+
+func onRequest(ip string) (bool, string, func(int)) {
+	if _is_exempt(ip) {
+		return true, "", nil
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	s, ok := sources[ip]
+	if !ok {
+		// config was validated in Register, so it can't fail here
+		thr, _ := throttle.MakeFromConfig(cfg.throttle_cfg)
+		s = &source{ip: ip, throttle: thr}
+		sources[ip] = s
+	}
+	s.last_seen = time.Now().Unix()
+
+	if cfg.max_concurrent > 0 && s.in_flight >= cfg.max_concurrent {
+		s.stat_rejected++
+		return false, fmt.Sprintf("Too many concurrent requests from %s, limit is %d", ip, cfg.max_concurrent), nil
+	}
+
+	// throttle score needs to be read first, it rotates stats windows
+	group := throttle.ThrottleGoup(s.throttle)
+	throttled := group.GetThrottleScore().Throttled
+	req, _, data, _ := group.GetLimitsLeft()
+	if throttled || req < 1 || data < 1 || !group.OnRequest("") {
+		s.stat_rejected++
+		return false, fmt.Sprintf("Too many requests from %s, please wait", ip), nil
+	}
+
+	s.in_flight++
+	s.stat_requests++
+	return true, "", func(bytes_out int) {
+		mu.Lock()
+		s.in_flight--
+		s.stat_bytes += bytes_out
+		group.OnReceive(bytes_out)
+		mu.Unlock()
+	}
+}
+
+// Remove sources which were idle for long enough, so the map won't grow
+// forever
+func cleanup(now int64) {
+	mu.Lock()
+	for ip, s := range sources {
+		if s.in_flight == 0 && now-s.last_seen > cfg.idle_cleanup {
+			delete(sources, ip)
+		}
+	}
+	mu.Unlock()
+}
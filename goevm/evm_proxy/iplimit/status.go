@@ -0,0 +1,72 @@
+package iplimit
+
+import (
+	"fmt"
+	"html"
+	"sort"
+	"time"
+
+	"github.com/slawomir-pryczek/HSServer/handler_socket2"
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/hscommon"
+)
+
+const top_talkers = 25
+
+func registerStatus() {
+
+	handler_socket2.StatusPluginRegisterData(func() (string, string) {
+		info := "Incoming requests are limited per client IP, the limits apply to all HTTP, socket and UDP listeners\n"
+		info += fmt.Sprintf("Max concurrent requests: %d, idle sources are removed after %ds\n", cfg.max_concurrent, cfg.idle_cleanup)
+		info += "<b>Rejected</b> - Requests rejected because of exhausted quota or too many concurrent requests\n"
+
+		table := hscommon.NewTableGen("IP", "Requests", "Rejected", "In Flight", "Sent", "Last Seen", "Throttle")
+		table.SetClass("tab evm")
+
+		now := time.Now().Unix()
+		mu.Lock()
+		_sources := make([]*source, 0, len(sources))
+		for _, s := range sources {
+			_sources = append(_sources, s)
+		}
+		sort.Slice(_sources, func(i, j int) bool {
+			return _sources[i].stat_requests > _sources[j].stat_requests
+		})
+		if len(_sources) > top_talkers {
+			_sources = _sources[0:top_talkers]
+		}
+
+		for _, s := range _sources {
+			_throttle := ""
+			for _, t := range s.throttle {
+				_throttle += t.GetStatus()
+			}
+			_last_seen := "now"
+			if now-s.last_seen > 0 {
+				_last_seen = hscommon.FormatTime(int(now-s.last_seen)) + " ago"
+			}
+			table.AddRow(html.EscapeString(s.ip), fmt.Sprintf("%d", s.stat_requests), fmt.Sprintf("%d", s.stat_rejected),
+				fmt.Sprintf("%d", s.in_flight), hscommon.FormatBytes(uint64(s.stat_bytes)), _last_seen, _throttle)
+		}
+		info += fmt.Sprintf("Tracking %d source(s), showing top %d by requests\n", len(sources), len(_sources))
+		mu.Unlock()
+
+		return "EVM Proxy - Incoming IP Limits", "<pre>" + info + "</pre>" + table.Render()
+	}, func() (string, interface{}) {
+		mu.Lock()
+		_sources := make([]map[string]interface{}, 0, len(sources))
+		for _, s := range sources {
+			_sources = append(_sources, map[string]interface{}{"ip": s.ip, "requests": s.stat_requests,
+				"rejected": s.stat_rejected, "in_flight": s.in_flight, "bytes_sent": s.stat_bytes, "last_seen": s.last_seen})
+		}
+		mu.Unlock()
+		sort.Slice(_sources, func(i, j int) bool {
+			return _sources[i]["requests"].(int) > _sources[j]["requests"].(int)
+		})
+		if len(_sources) > top_talkers {
+			_sources = _sources[0:top_talkers]
+		}
+
+		return "EVM Proxy - Incoming IP Limits", map[string]interface{}{"max_concurrent": cfg.max_concurrent,
+			"idle_cleanup": cfg.idle_cleanup, "sources": _sources}
+	})
+}
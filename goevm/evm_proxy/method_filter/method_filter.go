@@ -0,0 +1,151 @@
+package method_filter
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/config"
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/hslog"
+)
+
+var log = hslog.Get("proxy")
+
+type Filter struct {
+	allow []string
+	deny  []string
+}
+
+type stat struct {
+	blocked           int
+	blocked_by_method map[string]int
+}
+
+var mu sync.Mutex
+var filters = make(map[string]*Filter)
+var stats = make(map[string]*stat)
+
+func init() {
+	registerStatus()
+
+	// filters are read again after the config file changes
+	config.AttachOnChange(func() {
+		mu.Lock()
+		filters = make(map[string]*Filter)
+		mu.Unlock()
+	})
+}
+
+// Match checks the method against list of names and prefixes, entries
+// ending with * are treated as prefixes (eg. admin_*)
+func Match(patterns []string, method string) bool {
+	for _, p := range patterns {
+		if p == "*" || p == method {
+			return true
+		}
+		if strings.HasSuffix(p, "*") && strings.HasPrefix(method, p[:len(p)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+func SplitList(s string) []string {
+	ret := make([]string, 0)
+	for _, v := range strings.Split(s, ",") {
+		v = strings.Trim(v, "\r\n\t ")
+		if len(v) > 0 {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+func makeFromConfig(raw interface{}, path string) (*Filter, config.PathErrors) {
+	ret := &Filter{allow: []string{}, deny: []string{}}
+	errs := config.PathErrors{}
+	if raw == nil || raw == "" {
+		return ret, errs
+	}
+	item, ok := raw.(map[string]interface{})
+	if !ok {
+		errs.Add(path, "expected object")
+		return ret, errs
+	}
+
+	for attr, v := range item {
+		_v, ok := v.(string)
+		switch {
+		case attr != "allow" && attr != "deny":
+			errs.Add(config.PathKey(path, attr), "unknown METHOD_FILTER attribute, expected allow or deny")
+		case !ok:
+			errs.Add(config.PathKey(path, attr), "expected comma separated list of methods")
+		case attr == "allow":
+			ret.allow = SplitList(_v)
+		default:
+			ret.deny = SplitList(_v)
+		}
+	}
+	return ret, errs
+}
+
+// ConfigCheck validates METHOD_FILTER section, global one or defined for
+// the listener
+func ConfigCheck(raw interface{}, path string) []config.PathError {
+	_, errs := makeFromConfig(raw, path)
+	return errs
+}
+
+// IsAllowed returns false if the method is on the deny list, or if allow
+// list is defined and the method is not present there
+func (this *Filter) IsAllowed(method string) bool {
+	if Match(this.deny, method) {
+		return false
+	}
+	if len(this.allow) > 0 && !Match(this.allow, method) {
+		return false
+	}
+	return true
+}
+
+// Get filter for given listener, listener specific METHOD_FILTER from
+// LISTENERS section takes precedence over the global one
+func Get(listener string) *Filter {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if f, ok := filters[listener]; ok {
+		return f
+	}
+
+	f, errs := makeFromConfig(config.Config().GetListenerRawData(listener, "METHOD_FILTER", ""), "METHOD_FILTER")
+	for _, err := range errs {
+		log.Warn("Invalid METHOD_FILTER config", "listener", listener, "err", err)
+	}
+	if len(f.allow) > 0 || len(f.deny) > 0 {
+		log.Info("Method filter", "listener", listener, "allow", f.allow, "deny", f.deny)
+	}
+	filters[listener] = f
+	return f
+}
+
+// IsAllowed checks the method against listener's filter, blocked calls
+// are counted
+func IsAllowed(listener, method string) bool {
+	if Get(listener).IsAllowed(method) {
+		return true
+	}
+
+	mu.Lock()
+	s, ok := stats[listener]
+	if !ok {
+		s = &stat{blocked_by_method: make(map[string]int)}
+		stats[listener] = s
+	}
+	s.blocked++
+	if _, ok := s.blocked_by_method[method]; !ok && len(s.blocked_by_method) >= 100 {
+		method = "(other)"
+	}
+	s.blocked_by_method[method]++
+	mu.Unlock()
+	return false
+}
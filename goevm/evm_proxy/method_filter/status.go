@@ -0,0 +1,68 @@
+package method_filter
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/slawomir-pryczek/HSServer/handler_socket2"
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/hscommon"
+)
+
+func registerStatus() {
+
+	handler_socket2.StatusPluginRegisterData(func() (string, string) {
+		info := "Calls to methods which are not allowed are rejected at the proxy, without touching any node\n"
+		info += "Filters can be defined globally in METHOD_FILTER, or per listener in LISTENERS section\n"
+
+		table := hscommon.NewTableGen("Listener", "Allow", "Deny", "Blocked", "Blocked Methods")
+		table.SetClass("tab evm")
+
+		mu.Lock()
+		_count := len(filters)
+		for listener, f := range filters {
+			_allow, _deny := "*", "-"
+			if len(f.allow) > 0 {
+				_allow = strings.Join(f.allow, ", ")
+			}
+			if len(f.deny) > 0 {
+				_deny = strings.Join(f.deny, ", ")
+			}
+
+			_blocked, _methods := 0, ""
+			if s, ok := stats[listener]; ok {
+				_blocked = s.blocked
+				for m, count := range s.blocked_by_method {
+					_methods += fmt.Sprintf("%s: %d<br>", html.EscapeString(m), count)
+				}
+			}
+
+			table.AddRow(html.EscapeString(listener), html.EscapeString(_allow), html.EscapeString(_deny),
+				fmt.Sprintf("%d", _blocked), _methods)
+		}
+		mu.Unlock()
+
+		if _count == 0 {
+			info += "No requests were filtered yet\n"
+		}
+
+		return "EVM Proxy - Method Filter", "<pre>" + info + "</pre>" + table.RenderSorted(0)
+	}, func() (string, interface{}) {
+		mu.Lock()
+		ret := make(map[string]interface{}, len(filters))
+		for listener, f := range filters {
+			_blocked, _by_method := 0, make(map[string]int)
+			if s, ok := stats[listener]; ok {
+				_blocked = s.blocked
+				for m, count := range s.blocked_by_method {
+					_by_method[m] = count
+				}
+			}
+			ret[listener] = map[string]interface{}{"allow": f.allow, "deny": f.deny, "blocked": _blocked,
+				"blocked_by_method": _by_method}
+		}
+		mu.Unlock()
+
+		return "EVM Proxy - Method Filter", ret
+	})
+}
@@ -10,6 +10,7 @@ type scheduler struct {
 	clients       []*client.EVMClient
 	force_public  bool
 	force_private bool
+	tags          []string
 }
 
 func MakeScheduler() *scheduler {
@@ -29,6 +30,11 @@ func (this *scheduler) SetMinBlock(min_block_no int) {
 	this.min_block_no = min_block_no
 }
 
+// SetTags limits the scheduler to nodes which have at least one of the tags
+func (this *scheduler) SetTags(tags []string) {
+	this.tags = tags
+}
+
 func (this *scheduler) ForcePublic(f bool) {
 	this.force_public = f
 	if this.force_public && this.force_private {
@@ -75,6 +81,9 @@ func (this *scheduler) GetAll(is_public bool, include_deactivated bool) []*clien
 		if is_public != info.Is_public_node {
 			continue
 		}
+		if len(this.tags) > 0 && !v.HasAnyTag(this.tags) {
+			continue
+		}
 		ret = append(ret, v)
 	}
 	return ret
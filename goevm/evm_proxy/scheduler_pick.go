@@ -23,6 +23,9 @@ func (this *scheduler) _pick_next() *client.EVMClient {
 		if !info.Is_public_node && this.force_public {
 			continue
 		}
+		if len(this.tags) > 0 && !v.HasAnyTag(this.tags) {
+			continue
+		}
 
 		_r := info.Score
 		if min == -1 || _r < min {
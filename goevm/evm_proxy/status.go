@@ -2,6 +2,7 @@ package evm_proxy
 
 import (
 	"github.com/slawomir-pryczek/HSServer/handler_socket2"
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/metrics"
 )
 
 func init() {
@@ -27,5 +28,21 @@ func init() {
 		return "EVM Proxy", "<pre>" + info + status + "</pre>"
 	}
 
-	handler_socket2.StatusPluginRegister(get_status)
+	get_status_data := func() (string, interface{}) {
+		nodes := make([]interface{}, 0)
+		sh := MakeScheduler()
+		for _, v := range append(sh.GetAll(true, true), sh.GetAll(false, true)...) {
+			nodes = append(nodes, v.GetStatusData())
+		}
+		return "EVM Proxy", nodes
+	}
+
+	handler_socket2.StatusPluginRegisterData(get_status, get_status_data)
+
+	metrics.Register(func(w *metrics.Writer) {
+		sh := MakeScheduler()
+		for _, v := range append(sh.GetAll(true, true), sh.GetAll(false, true)...) {
+			v.WriteMetrics(w)
+		}
+	})
 }
@@ -0,0 +1,64 @@
+package tx_policy
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/slawomir-pryczek/HSServer/handler_socket2"
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/hscommon"
+)
+
+func registerStatus() {
+
+	handler_socket2.StatusPluginRegisterData(func() (string, string) {
+		info := "Transactions sent with eth_sendRawTransaction are decoded and checked before they're forwarded to any node\n"
+		_chain_id := "not configured"
+		if cfg.chain_id != nil {
+			_chain_id = cfg.chain_id.String()
+		}
+		info += fmt.Sprintf("Required chainId: %s, denied recipients: %d\n", _chain_id, len(cfg.deny_to))
+
+		table := hscommon.NewTableGen("Checked", "Rejected", "Rejected By Rule", "Transaction Types")
+		table.SetClass("tab evm")
+
+		mu.Lock()
+		_rules := ""
+		for rule, count := range stats.rejected_by_rule {
+			_rules += fmt.Sprintf("%s: %d<br>", rule, count)
+		}
+		_types := make([]int, 0, len(stats.by_type))
+		for t := range stats.by_type {
+			_types = append(_types, t)
+		}
+		sort.Ints(_types)
+		_by_type := ""
+		for _, t := range _types {
+			_by_type += fmt.Sprintf("type %d: %d<br>", t, stats.by_type[t])
+		}
+		table.AddRow(fmt.Sprintf("%d", stats.checked), fmt.Sprintf("%d", stats.rejected), _rules, _by_type)
+		mu.Unlock()
+
+		return "EVM Proxy - Transaction Policy", "<pre>" + info + "</pre>" + table.Render()
+	}, func() (string, interface{}) {
+		_chain_id := ""
+		if cfg.chain_id != nil {
+			_chain_id = cfg.chain_id.String()
+		}
+
+		mu.Lock()
+		_rules := make(map[string]int, len(stats.rejected_by_rule))
+		for rule, count := range stats.rejected_by_rule {
+			_rules[rule] = count
+		}
+		_by_type := make(map[string]int, len(stats.by_type))
+		for t, count := range stats.by_type {
+			_by_type[strconv.Itoa(t)] = count
+		}
+		ret := map[string]interface{}{"chain_id": _chain_id, "deny_to": len(cfg.deny_to), "checked": stats.checked,
+			"rejected": stats.rejected, "rejected_by_rule": _rules, "by_type": _by_type}
+		mu.Unlock()
+
+		return "EVM Proxy - Transaction Policy", ret
+	})
+}
@@ -0,0 +1,145 @@
+package tx_policy
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"goevm/evm/rawtx"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/config"
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/hslog"
+)
+
+var log = hslog.Get("tx")
+
+type policy struct {
+	chain_id *big.Int
+	deny_to  map[string]bool
+}
+
+type stat struct {
+	checked          int
+	rejected         int
+	rejected_by_rule map[string]int
+	by_type          map[int]int
+}
+
+var mu sync.Mutex
+var cfg = policy{deny_to: make(map[string]bool)}
+var stats = stat{rejected_by_rule: make(map[string]int), by_type: make(map[int]int)}
+
+// Reads chainId from the config root and TX_POLICY section,
+// eg. "TX_POLICY":{"deny_to":"0xabc...,0xdef..."}
+func init() {
+	switch v := config.Config().GetRawData("chainId", "").(type) {
+	case json.Number:
+		cfg.chain_id, _ = new(big.Int).SetString(v.String(), 10)
+	case string:
+		cfg.chain_id, _ = new(big.Int).SetString(strings.TrimPrefix(v, "0x"), 16)
+	}
+
+	raw, _ := config.Config().GetRawData("TX_POLICY", "").(map[string]interface{})
+	var errs config.PathErrors
+	cfg.deny_to, errs = _read_config(raw, "TX_POLICY")
+	for _, err := range errs {
+		log.Warn("Invalid TX_POLICY config", "err", err)
+	}
+
+	registerStatus()
+}
+
+// ConfigCheck validates TX_POLICY section
+func ConfigCheck(raw interface{}, path string) []config.PathError {
+	_raw, ok := raw.(map[string]interface{})
+	if !ok {
+		return []config.PathError{{Path: path, Message: "expected object"}}
+	}
+	_, errs := _read_config(_raw, path)
+	return errs
+}
+
+func _read_config(raw map[string]interface{}, path string) (map[string]bool, config.PathErrors) {
+	deny_to := make(map[string]bool)
+	errs := config.PathErrors{}
+	for attr := range raw {
+		if attr != "deny_to" {
+			errs.Add(config.PathKey(path, attr), "unknown TX_POLICY attribute")
+		}
+	}
+
+	v, ok := raw["deny_to"].(string)
+	if _, exists := raw["deny_to"]; exists && !ok {
+		errs.Add(config.PathKey(path, "deny_to"), "expected comma separated list of addresses")
+	}
+	for _, addr := range strings.Split(v, ",") {
+		addr = strings.Trim(addr, "\r\n\t ")
+		if len(addr) == 0 {
+			continue
+		}
+		_addr, err := _normalize_address(addr)
+		if err != nil {
+			errs.Add(config.PathKey(path, "deny_to"), "%s", err.Error())
+			continue
+		}
+		deny_to[_addr] = true
+	}
+	return deny_to, errs
+}
+
+// Addresses are compared as lowercase hex with 0x prefix, same as
+// decoded transaction's recipient
+func _normalize_address(addr string) (string, error) {
+	_addr := strings.ToLower(addr)
+	if strings.HasPrefix(_addr, "0x") {
+		_addr = _addr[2:]
+	}
+	if b, err := hex.DecodeString(_addr); err != nil || len(b) != 20 {
+		return "", fmt.Errorf("invalid address %s, expected 20 bytes hex", addr)
+	}
+	return "0x" + _addr, nil
+}
+
+func _reject(rule, reason string) error {
+	mu.Lock()
+	stats.rejected++
+	stats.rejected_by_rule[rule]++
+	mu.Unlock()
+	return fmt.Errorf("%s", reason)
+}
+
+// Check decodes hex encoded signed transaction and checks it against the
+// policy. If the transaction can't be decoded returned tx is nil
+func Check(raw_hex string) (*rawtx.Tx, error) {
+	mu.Lock()
+	stats.checked++
+	mu.Unlock()
+
+	raw, err := hex.DecodeString(strings.TrimPrefix(raw_hex, "0x"))
+	if err != nil {
+		return nil, _reject("invalid", "invalid hex data")
+	}
+	tx, err := rawtx.Decode(raw)
+	if err != nil {
+		return nil, _reject("invalid", "can't decode transaction, "+err.Error())
+	}
+
+	mu.Lock()
+	stats.by_type[tx.Type]++
+	mu.Unlock()
+
+	if cfg.chain_id != nil {
+		if tx.ChainID == nil {
+			return tx, _reject("chain_id", "transaction is not replay protected, chainId "+cfg.chain_id.String()+" is required")
+		}
+		if tx.ChainID.Cmp(cfg.chain_id) != 0 {
+			return tx, _reject("chain_id", fmt.Sprintf("invalid chainId %s, expected %s", tx.ChainID.String(), cfg.chain_id.String()))
+		}
+	}
+	if cfg.deny_to[tx.To] {
+		return tx, _reject("deny_to", "recipient "+tx.To+" is not allowed")
+	}
+	return tx, nil
+}
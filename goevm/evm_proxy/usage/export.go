@@ -0,0 +1,38 @@
+package usage
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// CSV has a row with totals of every node or client, with method "*", and
+// a row for every method it called
+func CSV(rows []Row) []byte {
+	out := bytes.Buffer{}
+	w := csv.NewWriter(&out)
+	w.Write([]string{"date", "kind", "name", "provider", "method", "requests", "errors", "bytes_in", "bytes_out", "cost"})
+
+	_f := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	for _, r := range rows {
+		w.Write([]string{r.Date, r.Kind, r.Name, r.Provider, "*", fmt.Sprint(r.Requests), fmt.Sprint(r.Errors),
+			fmt.Sprint(r.BytesIn), fmt.Sprint(r.BytesOut), _f(r.Cost)})
+
+		methods := make([]string, 0, len(r.Methods))
+		for method := range r.Methods {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+		for _, method := range methods {
+			m := r.Methods[method]
+			w.Write([]string{r.Date, r.Kind, r.Name, r.Provider, method, fmt.Sprint(m.Requests), fmt.Sprint(m.Errors),
+				"", "", _f(m.Cost)})
+		}
+	}
+	w.Flush()
+	return out.Bytes()
+}
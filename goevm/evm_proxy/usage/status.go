@@ -0,0 +1,58 @@
+package usage
+
+import (
+	"fmt"
+	"html"
+	"sort"
+	"time"
+
+	"github.com/slawomir-pryczek/HSServer/handler_socket2"
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/hscommon"
+)
+
+const status_clients = 20
+
+func registerStatus() {
+
+	handler_socket2.StatusPluginRegisterData(func() (string, string) {
+		if !cfg.enabled {
+			return "EVM Proxy - Usage", "<pre>Usage accounting is disabled, add USAGE section to the config to enable it</pre>"
+		}
+
+		today := time.Now().UTC().Format(DATE_FORMAT)
+		rows, _ := Query(today, today, "", false)
+		info := fmt.Sprintf("Usage of %s (UTC), kept for %d days", today, cfg.retention_days)
+		if len(cfg.file) > 0 {
+			info += ", saved to " + html.EscapeString(cfg.file)
+		}
+		info += "\nUse evm_admin_usage action to export usage as CSV or JSON\n"
+
+		nodes := hscommon.NewTableGen("Node", "Provider", "Requests", "Errors", "Sent", "Received", "Est. Cost")
+		nodes.SetClass("tab evm")
+		clients := hscommon.NewTableGen("Client", "Requests", "Errors", "Received", "Sent")
+		clients.SetClass("tab evm")
+
+		sort.SliceStable(rows, func(i, j int) bool { return rows[i].Requests > rows[j].Requests })
+		client_count := 0
+		for _, r := range rows {
+			if r.Kind == KIND_NODE {
+				nodes.AddRow(html.EscapeString(r.Name), html.EscapeString(r.Provider), fmt.Sprint(r.Requests), fmt.Sprint(r.Errors),
+					hscommon.FormatBytes(uint64(r.BytesOut)), hscommon.FormatBytes(uint64(r.BytesIn)), fmt.Sprintf("%.2f", r.Cost))
+				continue
+			}
+			if client_count++; client_count <= status_clients {
+				clients.AddRow(html.EscapeString(r.Name), fmt.Sprint(r.Requests), fmt.Sprint(r.Errors),
+					hscommon.FormatBytes(uint64(r.BytesIn)), hscommon.FormatBytes(uint64(r.BytesOut)))
+			}
+		}
+		if client_count > status_clients {
+			info += fmt.Sprintf("Showing top %d of %d clients\n", status_clients, client_count)
+		}
+
+		return "EVM Proxy - Usage", "<pre>" + info + "</pre>" + nodes.Render() + clients.Render()
+	}, func() (string, interface{}) {
+		today := time.Now().UTC().Format(DATE_FORMAT)
+		rows, _ := Query(today, today, "", false)
+		return "EVM Proxy - Usage", map[string]interface{}{"enabled": cfg.enabled, "today": rows}
+	})
+}
@@ -0,0 +1,417 @@
+package usage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/config"
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/hslog"
+)
+
+var log = hslog.Get("usage")
+
+// Usage is accounted for upstream nodes and for calling clients (API key
+// name or IP)
+const (
+	KIND_NODE   = "node"
+	KIND_CLIENT = "client"
+)
+
+const DATE_FORMAT = "2006-01-02"
+const file_version = 1
+
+// limits per day, so clients with random IPs can't use all the memory
+const max_subjects = 10000
+const max_methods = 200
+const other_method = "(other)"
+
+type MethodCounts struct {
+	Requests int64   `json:"requests"`
+	Errors   int64   `json:"errors"`
+	Cost     float64 `json:"cost,omitempty"`
+}
+
+// Row is usage of single node or client, in a day or in the date range
+type Row struct {
+	Date     string                   `json:"date"`
+	Kind     string                   `json:"kind"`
+	Name     string                   `json:"name"`
+	Provider string                   `json:"provider,omitempty"`
+	Requests int64                    `json:"requests"`
+	Errors   int64                    `json:"errors"`
+	BytesIn  int64                    `json:"bytes_in"`
+	BytesOut int64                    `json:"bytes_out"`
+	Cost     float64                  `json:"cost,omitempty"`
+	Methods  map[string]*MethodCounts `json:"methods,omitempty"`
+}
+
+type subject struct {
+	kind string
+	name string
+}
+
+type settings struct {
+	enabled        bool
+	file           string
+	save_every     int64
+	retention_days int
+	providers      map[string]map[string]float64
+}
+
+type file_data struct {
+	Version int              `json:"version"`
+	Days    map[string][]Row `json:"days"`
+}
+
+var mu sync.Mutex
+var cfg = settings{}
+var days = make(map[string]map[subject]*Row)
+var dirty = false
+
+// Reads USAGE section, accounting is disabled if it's not present, eg.
+// "USAGE":{"file":"usage.json", "save_every":60, "retention_days":400,
+// "providers":{"alchemy":{"*":1, "eth_getLogs":75}}}
+// providers are cost weights per method, nodes are assigned to providers
+// with "provider" attribute of the node config
+func init() {
+	raw, ok := config.Config().GetRawData("USAGE", "").(map[string]interface{})
+	if ok {
+		var errs config.PathErrors
+		if cfg, errs = _read_config(raw, "USAGE"); len(errs) > 0 {
+			panic("Usage config error. " + errs[0].Error())
+		}
+	}
+
+	registerStatus()
+	if !cfg.enabled || len(cfg.file) == 0 {
+		return
+	}
+
+	if err := _load(); err != nil {
+		log.Warn("Can't load usage", "file", cfg.file, "err", err)
+	}
+	go func() {
+		for {
+			time.Sleep(time.Duration(cfg.save_every) * time.Second)
+			if err := Save(); err != nil {
+				log.Error("Can't save usage", "file", cfg.file, "err", err)
+			}
+		}
+	}()
+}
+
+// ConfigCheck validates USAGE section
+func ConfigCheck(raw interface{}, path string) []config.PathError {
+	_raw, ok := raw.(map[string]interface{})
+	if !ok {
+		return []config.PathError{{Path: path, Message: "expected object"}}
+	}
+	_, errs := _read_config(_raw, path)
+	return errs
+}
+
+func _read_config(raw map[string]interface{}, path string) (settings, config.PathErrors) {
+	ret := settings{enabled: true, save_every: 60, retention_days: 400, providers: make(map[string]map[string]float64)}
+	errs := config.PathErrors{}
+	if v, ok := raw["file"]; ok {
+		if ret.file, ok = v.(string); !ok {
+			errs.Add(config.PathKey(path, "file"), "expected string")
+		}
+	}
+
+	_num := func(v interface{}) (float64, bool) {
+		if n, ok := v.(json.Number); ok {
+			f, err := n.Float64()
+			return f, err == nil && f >= 0
+		}
+		return 0, false
+	}
+	for _, attr := range []string{"save_every", "retention_days"} {
+		v, exists := raw[attr]
+		if !exists {
+			continue
+		}
+		f, ok := _num(v)
+		if !ok || f < 1 || f != float64(int64(f)) {
+			errs.Add(config.PathKey(path, attr), "expected integer > 0")
+			continue
+		}
+		if attr == "save_every" {
+			ret.save_every = int64(f)
+		} else {
+			ret.retention_days = int(f)
+		}
+	}
+
+	providers, ok := raw["providers"].(map[string]interface{})
+	if _, exists := raw["providers"]; exists && !ok {
+		errs.Add(config.PathKey(path, "providers"), "expected object with providers")
+	}
+	for name, v := range providers {
+		_path := config.PathKey(config.PathKey(path, "providers"), name)
+		weights, ok := v.(map[string]interface{})
+		if !ok {
+			errs.Add(_path, "expected object with method weights")
+			continue
+		}
+		ret.providers[name] = make(map[string]float64)
+		for method, w := range weights {
+			f, ok := _num(w)
+			if !ok {
+				errs.Add(config.PathKey(_path, method), "expected weight >= 0")
+				continue
+			}
+			ret.providers[name][method] = f
+		}
+	}
+	return ret, errs
+}
+
+func IsEnabled() bool {
+	return cfg.enabled
+}
+
+func _record(kind, name, provider string, methods []string, bytes_in, bytes_out int, is_error bool) {
+	if !cfg.enabled || len(methods) == 0 {
+		return
+	}
+
+	date := time.Now().UTC().Format(DATE_FORMAT)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	day, ok := days[date]
+	if !ok {
+		day = make(map[subject]*Row)
+		days[date] = day
+	}
+	key := subject{kind, name}
+	r, ok := day[key]
+	if !ok {
+		if len(day) >= max_subjects {
+			key.name = other_method
+			r, ok = day[key]
+		}
+		if !ok {
+			r = &Row{Date: date, Kind: kind, Name: key.name, Methods: make(map[string]*MethodCounts)}
+			day[key] = r
+		}
+	}
+
+	r.Provider = provider
+	r.Requests += int64(len(methods))
+	r.BytesIn += int64(bytes_in)
+	r.BytesOut += int64(bytes_out)
+	for _, method := range methods {
+		m, ok := r.Methods[method]
+		if !ok {
+			if len(r.Methods) >= max_methods {
+				method = other_method
+			}
+			if m, ok = r.Methods[method]; !ok {
+				m = &MethodCounts{}
+				r.Methods[method] = m
+			}
+		}
+		m.Requests++
+		if is_error {
+			m.Errors++
+			r.Errors++
+		}
+	}
+	dirty = true
+}
+
+// Node records calls sent to the node, bytes in are received from the node
+func Node(name, provider string, methods []string, bytes_out, bytes_in int, is_error bool) {
+	_record(KIND_NODE, name, provider, methods, bytes_in, bytes_out, is_error)
+}
+
+// Client records calls made by the client, bytes in are received from the
+// client
+func Client(name string, methods []string, bytes_in, bytes_out int, is_error bool) {
+	_record(KIND_CLIENT, name, "", methods, bytes_in, bytes_out, is_error)
+}
+
+// _cost sets estimated cost of the row, from provider's weights. "*" is
+// the weight of methods which are not listed, 0 if it's not set
+func _cost(r *Row) {
+	weights, ok := cfg.providers[r.Provider]
+	if !ok {
+		return
+	}
+	r.Cost = 0
+	for method, m := range r.Methods {
+		w, ok := weights[method]
+		if !ok {
+			w = weights["*"]
+		}
+		m.Cost = float64(m.Requests) * w
+		r.Cost += m.Cost
+	}
+}
+
+func _copy(r *Row) Row {
+	ret := *r
+	ret.Methods = make(map[string]*MethodCounts, len(r.Methods))
+	for k, v := range r.Methods {
+		_v := *v
+		ret.Methods[k] = &_v
+	}
+	return ret
+}
+
+// Query returns usage between from and to dates (inclusive, YYYY-MM-DD),
+// for kind or for all kinds if empty. If total is set rows are summed
+// over the range and their date is "from..to"
+func Query(from, to, kind string, total bool) ([]Row, error) {
+	if _, err := time.Parse(DATE_FORMAT, from); err != nil {
+		return nil, fmt.Errorf("invalid from date %s, use YYYY-MM-DD", from)
+	}
+	if _, err := time.Parse(DATE_FORMAT, to); err != nil {
+		return nil, fmt.Errorf("invalid to date %s, use YYYY-MM-DD", to)
+	}
+
+	mu.Lock()
+	ret := make([]Row, 0)
+	totals := make(map[subject]*Row)
+	for date, day := range days {
+		if date < from || date > to {
+			continue
+		}
+		for key, r := range day {
+			if len(kind) > 0 && key.kind != kind {
+				continue
+			}
+			if !total {
+				ret = append(ret, _copy(r))
+				continue
+			}
+
+			t, ok := totals[key]
+			if !ok {
+				_t := _copy(r)
+				_t.Date = from + ".." + to
+				totals[key] = &_t
+				continue
+			}
+			t.Requests += r.Requests
+			t.Errors += r.Errors
+			t.BytesIn += r.BytesIn
+			t.BytesOut += r.BytesOut
+			if len(r.Provider) > 0 {
+				t.Provider = r.Provider
+			}
+			for method, m := range r.Methods {
+				if _, ok := t.Methods[method]; !ok {
+					t.Methods[method] = &MethodCounts{}
+				}
+				t.Methods[method].Requests += m.Requests
+				t.Methods[method].Errors += m.Errors
+			}
+		}
+	}
+	mu.Unlock()
+
+	for _, t := range totals {
+		ret = append(ret, *t)
+	}
+	for i := range ret {
+		_cost(&ret[i])
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Date != ret[j].Date {
+			return ret[i].Date < ret[j].Date
+		}
+		if ret[i].Kind != ret[j].Kind {
+			return ret[i].Kind < ret[j].Kind
+		}
+		return ret[i].Name < ret[j].Name
+	})
+	return ret, nil
+}
+
+func _load() error {
+	data, err := ioutil.ReadFile(cfg.file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	fd := file_data{}
+	if err := json.Unmarshal(data, &fd); err != nil {
+		return err
+	}
+	if fd.Version != file_version {
+		return fmt.Errorf("unsupported version %d", fd.Version)
+	}
+
+	mu.Lock()
+	for date, rows := range fd.Days {
+		day := make(map[subject]*Row, len(rows))
+		for i := range rows {
+			r := rows[i]
+			if r.Methods == nil {
+				r.Methods = make(map[string]*MethodCounts)
+			}
+			day[subject{r.Kind, r.Name}] = &r
+		}
+		days[date] = day
+	}
+	mu.Unlock()
+	log.Info("Usage loaded", "file", cfg.file, "days", len(fd.Days))
+	return nil
+}
+
+// Save writes usage to the file, days older than retention_days are removed
+func Save() error {
+	if !cfg.enabled || len(cfg.file) == 0 {
+		return nil
+	}
+
+	mu.Lock()
+	oldest := time.Now().UTC().AddDate(0, 0, -cfg.retention_days).Format(DATE_FORMAT)
+	for date := range days {
+		if date < oldest {
+			delete(days, date)
+			dirty = true
+		}
+	}
+	if !dirty {
+		mu.Unlock()
+		return nil
+	}
+	fd := file_data{Version: file_version, Days: make(map[string][]Row, len(days))}
+	for date, day := range days {
+		rows := make([]Row, 0, len(day))
+		for _, r := range day {
+			rows = append(rows, _copy(r))
+		}
+		fd.Days[date] = rows
+	}
+	dirty = false
+	mu.Unlock()
+
+	data, err := json.Marshal(fd)
+	tmp := cfg.file + ".tmp"
+	if err == nil {
+		err = ioutil.WriteFile(tmp, data, 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp, cfg.file)
+	}
+	if err != nil {
+		mu.Lock()
+		dirty = true
+		mu.Unlock()
+	}
+	return err
+}
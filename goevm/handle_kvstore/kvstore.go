@@ -15,7 +15,7 @@ func init() {
 }
 
 func (this *Handle_kvstore) Initialize() {
-	handler_socket2.StatusPluginRegister(func() (string, string) {
+	handler_socket2.StatusPluginRegisterData(func() (string, string) {
 		ret := "KV Storage Plugin is Enabled\n"
 		for i := 0; i < len(pools); i++ {
 			pools[i].mu.RLock()
@@ -23,6 +23,14 @@ func (this *Handle_kvstore) Initialize() {
 			pools[i].mu.RUnlock()
 		}
 		return "KV Storage", "<pre>" + ret + "</pre>"
+	}, func() (string, interface{}) {
+		keys := make([]int, len(pools))
+		for i := 0; i < len(pools); i++ {
+			pools[i].mu.RLock()
+			keys[i] = len(pools[i].data)
+			pools[i].mu.RUnlock()
+		}
+		return "KV Storage", map[string]interface{}{"pool_keys": keys}
 	})
 }
 
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"goevm/evm/handle_evm_admin"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const probe_timeout = 10 * time.Second
+
+// _check_config validates the config file, and if probe is set runs
+// eth_chainId and eth_blockNumber on every valid node. Returns exit code,
+// 0 if there are no errors, warnings are allowed
+func _check_config(path string, probe bool) int {
+	fmt.Println("Checking config", path)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Println("ERROR", err)
+		return 1
+	}
+
+	raw := map[string]interface{}(nil)
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(&raw); err != nil {
+		offset := d.InputOffset()
+		switch e := err.(type) {
+		case *json.SyntaxError:
+			offset = e.Offset
+		case *json.UnmarshalTypeError:
+			offset = e.Offset
+		}
+		line := 1 + bytes.Count(data[:offset], []byte("\n"))
+		col := int(offset) - bytes.LastIndexByte(data[:offset], '\n')
+		fmt.Printf("ERROR $: invalid JSON at line %d column %d, %s\n", line, col, err)
+		return 1
+	}
+
+	// warnings are printed, but they don't fail the check
+	errors := make([]handle_evm_admin.ConfigError, 0)
+	for _, e := range handle_evm_admin.ConfigCheck(raw) {
+		if e.Warning {
+			fmt.Println("WARNING", e.Error())
+			continue
+		}
+		fmt.Println("ERROR", e.Error())
+		errors = append(errors, e)
+	}
+
+	failed := 0
+	nodes, _ := raw["EVM_NODES"].([]interface{})
+	if probe && len(nodes) > 0 {
+		failed = _check_config_probe(nodes, errors, raw["chainId"])
+	}
+
+	if len(errors) == 0 && failed == 0 {
+		fmt.Printf("OK, %d nodes\n", len(nodes))
+		return 0
+	}
+	fmt.Printf("%d errors", len(errors))
+	if probe {
+		fmt.Printf(", %d nodes failed probe", failed)
+	}
+	fmt.Println()
+	return 1
+}
+
+func _check_config_probe(nodes []interface{}, errors []handle_evm_admin.ConfigError, chain_id interface{}) int {
+	expected := (*big.Int)(nil)
+	switch v := chain_id.(type) {
+	case json.Number:
+		expected, _ = new(big.Int).SetString(v.String(), 10)
+	case string:
+		expected, _ = new(big.Int).SetString(strings.TrimPrefix(v, "0x"), 16)
+	}
+
+	results := make([]string, len(nodes))
+	failed := make([]bool, len(nodes))
+	wg := sync.WaitGroup{}
+	for num, v := range nodes {
+		path := fmt.Sprintf("$.EVM_NODES[%d]", num)
+		node, _ := v.(map[string]interface{})
+		has_errors := node == nil
+		for _, e := range errors {
+			has_errors = has_errors || e.Path == path || strings.HasPrefix(e.Path, path+".")
+		}
+		if has_errors {
+			results[num] = "SKIP  " + path + ": config has errors"
+			continue
+		}
+
+		wg.Add(1)
+		go func(num int, path string, node map[string]interface{}) {
+			defer wg.Done()
+			url, _ := node["url"].(string)
+			chain, block, took, err := handle_evm_admin.NodeProbe(node, probe_timeout)
+			if err == nil && expected != nil {
+				if c, ok := new(big.Int).SetString(strings.TrimPrefix(chain, "0x"), 16); !ok || c.Cmp(expected) != 0 {
+					err = fmt.Errorf("chain id is %s, chainId in config is %s", chain, expected)
+				}
+			}
+			if err != nil {
+				failed[num] = true
+				results[num] = fmt.Sprintf("FAIL  %s %s: %s", path, url, err)
+				return
+			}
+			results[num] = fmt.Sprintf("OK    %s %s: chain %s, block %d, %dms", path, url, chain, block, took.Milliseconds())
+		}(num, path, node)
+	}
+	wg.Wait()
+
+	ret := 0
+	for num, r := range results {
+		fmt.Println(r)
+		if failed[num] {
+			ret++
+		}
+	}
+	return ret
+}
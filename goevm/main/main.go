@@ -1,7 +1,6 @@
 package main
 
 import (
-	"fmt"
 	"goevm/evm/handle_ethereum_raw"
 	"goevm/evm/handle_evm_admin"
 	"goevm/handle_kvstore"
@@ -12,30 +11,31 @@ import (
 	"github.com/slawomir-pryczek/HSServer/handler_socket2/config"
 	"github.com/slawomir-pryczek/HSServer/handler_socket2/handle_echo"
 	"github.com/slawomir-pryczek/HSServer/handler_socket2/handle_profiler"
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/hslog"
 
 	"os"
 	"runtime"
 	"strings"
 )
 
+var log = hslog.Get("main")
+
 func _read_node_config() {
 
-	fmt.Println("\nReading node config...")
-	nodes := (config.Config().GetRawData("EVM_NODES", "")).([]interface{})
-	if len(nodes) <= 0 {
-		fmt.Println("ERROR: No nodes defined, please define at least one evm node to connect to")
+	log.Info("Reading node config")
+	if handle_evm_admin.NodesFromConfig() <= 0 {
+		log.Error("No nodes defined, please define at least one evm node to connect to")
 		os.Exit(10)
 		return
 	}
-
-	for _, v := range nodes {
-		handle_evm_admin.NodeRegisterFromConfig(v.(map[string]interface{}))
-	}
-	fmt.Println("")
 }
 
 func main() {
 
+	if config.HasArg(config.ARG_CHECK_CONFIG) {
+		os.Exit(_check_config(config.ConfigPath(), config.HasArg("--probe")))
+	}
+
 	plugin_manager.RegisterAll()
 	_read_node_config()
 
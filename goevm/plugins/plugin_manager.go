@@ -53,7 +53,7 @@ func RegisterAll() {
 		register(tmp)
 	}*/
 
-	handler_socket2.StatusPluginRegister(func() (string, string) {
+	handler_socket2.StatusPluginRegisterData(func() (string, string) {
 		ret := ""
 		mu.Lock()
 		_plugins := make([]*common.Plugin, len(plugins))
@@ -68,5 +68,16 @@ func RegisterAll() {
 		}
 
 		return "Plugins", "<pre>" + ret + "</pre>"
+	}, func() (string, interface{}) {
+		mu.Lock()
+		_plugins := make([]*common.Plugin, len(plugins))
+		copy(_plugins, plugins)
+		mu.Unlock()
+
+		ret := make([]string, 0, len(_plugins))
+		for _, p := range _plugins {
+			ret = append(ret, p.Status())
+		}
+		return "Plugins", ret
 	})
 }
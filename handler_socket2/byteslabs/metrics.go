@@ -0,0 +1,24 @@
+package byteslabs
+
+import (
+	"strconv"
+
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/metrics"
+)
+
+func init() {
+	metrics.Register(func(w *metrics.Writer) {
+		for k, chunk := range mem_chunks {
+			page := strconv.Itoa(k)
+
+			chunk.mu.Lock()
+			w.Counter("hs_slab_alloc_full_total", "Allocations of more than one slab", float64(chunk.stat_alloc_full), "page", page)
+			w.Counter("hs_slab_alloc_full_small_total", "Allocations of single slab at page end", float64(chunk.stat_alloc_full_small), "page", page)
+			w.Counter("hs_slab_alloc_tail_total", "Allocations in already allocated slab's tail", float64(chunk.stat_alloc_tail), "page", page)
+			w.Counter("hs_slab_oom_total", "Allocations which didn't fit the page", float64(chunk.stat_oom), "page", page)
+			w.Counter("hs_slab_routed_total", "Allocations routed to the least used page", float64(chunk.stat_routed), "page", page)
+			w.Gauge("hs_slab_used", "Slabs currently in use", float64(chunk.used_slab_count), "page", page)
+			chunk.mu.Unlock()
+		}
+	})
+}
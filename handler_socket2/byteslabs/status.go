@@ -85,3 +85,22 @@ func GetStatusStr() string {
 		total_f+total_fs+total_t+total_failed, total_failed))
 	return strings.Join(ret, "\n")
 }
+
+func GetStatusData() (string, interface{}) {
+	pages := make([]map[string]int, 0, len(mem_chunks))
+	for _, chunk := range mem_chunks {
+		chunk.mu.Lock()
+		pages = append(pages, map[string]int{
+			"alloc_full": chunk.stat_alloc_full, "alloc_full_small": chunk.stat_alloc_full_small,
+			"alloc_tail": chunk.stat_alloc_tail, "oom": chunk.stat_oom,
+			"routed": chunk.stat_routed, "routed_alloc": chunk.stat_routed_alloc,
+			"slabs_used": int(chunk.used_slab_count)})
+		chunk.mu.Unlock()
+	}
+
+	ret := make(map[string]interface{})
+	ret["slab_size"] = slab_size
+	ret["slab_count"] = slab_count
+	ret["pages"] = pages
+	return "Slab Allocator \\ QCompress", ret
+}
@@ -2,7 +2,6 @@ package compress
 
 import (
 	"encoding/binary"
-	"fmt"
 )
 
 type Compressor struct {
@@ -29,6 +28,7 @@ type cpr interface {
 	block_size() int
 	uncompress_simple(in []byte, size int) []byte
 	get_status() string
+	get_status_data() map[string]interface{}
 	get_id() string
 }
 
@@ -180,8 +180,6 @@ func (this *Compressor) Uncompress(in []byte) []byte {
 		chunk_size := int(chunks[chunk])
 		chunk_content := this.c.uncompress_simple(in[pos:pos+chunk_size], chunk_size)
 
-		fmt.Println("UNC c", chunk, len(in[pos:pos+chunk_size]), in[pos:pos+10])
-
 		chunk++
 		pos += chunk_size
 		out = append(out, chunk_content...)
@@ -194,6 +192,10 @@ func (this *Compressor) GetStatus() string {
 	return this.c.get_status()
 }
 
+func (this *Compressor) GetStatusData() map[string]interface{} {
+	return this.c.get_status_data()
+}
+
 func (this *Compressor) GetID() string {
 	return this.c.get_id()
 }
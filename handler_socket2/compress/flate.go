@@ -77,6 +77,10 @@ func (c *compressionflate) get_status() string {
 	return c.stat.GetStatus()
 }
 
+func (c *compressionflate) get_status_data() map[string]interface{} {
+	return c.stat.GetStatusData()
+}
+
 func (c compressionflate) block_size() int {
 	return 60000
 }
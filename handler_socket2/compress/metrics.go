@@ -0,0 +1,29 @@
+package compress
+
+import (
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/metrics"
+)
+
+func init() {
+	metrics.Register(func(w *metrics.Writer) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Counter("hs_compress_simple_reused_total", "Compressions done with pre-allocated compressor", float64(fw_stat_compressors_reuse))
+		w.Counter("hs_compress_simple_created_total", "Compressions which needed new compressor", float64(fw_stat_compressors_created))
+		w.Counter("hs_compress_simple_underflows_total", "Compressed size was smaller than predicted", float64(fw_stat_underflows))
+		w.Counter("hs_compress_simple_overflows_total", "Compressed size was larger than predicted", float64(fw_stat_overflows))
+	})
+}
+
+func (this *stat) writeMetrics(w *metrics.Writer) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	s := this.s_totals
+	w.Counter("hs_compress_total", "Multipart compressions", float64(s.compression_count), "compressor", this.name)
+	w.Counter("hs_compress_pieces_total", "Multipart compression pieces", float64(s.compression_pieces), "compressor", this.name)
+	w.Counter("hs_compress_in_bytes_total", "Bytes before compression", float64(s.data_in_size), "compressor", this.name)
+	w.Counter("hs_compress_out_bytes_total", "Bytes after compression", float64(s.data_out_size), "compressor", this.name)
+	w.Counter("hs_compress_errors_total", "Compression errors", float64(s.compression_ratio_too_low), "compressor", this.name, "error", "ratio_too_low")
+	w.Counter("hs_compress_errors_total", "Compression errors", float64(s.buffer_too_small), "compressor", this.name, "error", "buffer_too_small")
+}
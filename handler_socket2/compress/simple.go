@@ -94,3 +94,18 @@ func CompressSimpleStatus() string {
 
 	return ret
 }
+
+func CompressSimpleStatusData() map[string]int {
+	mu.Lock()
+	defer mu.Unlock()
+
+	ret := make(map[string]int)
+	ret["compressors_reused"] = fw_stat_compressors_reuse
+	ret["compressors_created"] = fw_stat_compressors_created
+	ret["compressors_preallocated"] = max_compressors
+	ret["underflows"] = fw_stat_underflows
+	ret["underflows_bytes"] = fw_stat_underflows_b
+	ret["overflows"] = fw_stat_overflows
+	ret["overflows_bytes"] = fw_stat_overflows_b
+	return ret
+}
@@ -65,6 +65,10 @@ func (c *compressionsnappy) get_status() string {
 	return c.stat.GetStatus()
 }
 
+func (c *compressionsnappy) get_status_data() map[string]interface{} {
+	return c.stat.GetStatusData()
+}
+
 func (c compressionsnappy) block_size() int {
 	return 120000
 }
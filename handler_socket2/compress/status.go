@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/slawomir-pryczek/HSServer/handler_socket2/hscommon"
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/metrics"
 )
 
 const thread_stopped_symbol = 'x'
@@ -39,6 +40,7 @@ func MakeStat(name string) *stat {
 	ret.name = name
 	ret.thread_symbol = make([]byte, 0, 30)
 	ret.thread_running = make([]byte, 0, 30)
+	metrics.Register(ret.writeMetrics)
 	go func() {
 
 		last_slice := -1
@@ -192,3 +194,20 @@ func (this *stat) GetStatus() string {
 	ret += tab_threads.RenderHorizFlat(14)
 	return ret
 }
+
+func (this *stat) GetStatusData() map[string]interface{} {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	s := this.s_totals
+	ret := make(map[string]interface{})
+	ret["name"] = this.name
+	ret["compressions"] = s.compression_count
+	ret["pieces"] = s.compression_pieces
+	ret["data_in"] = s.data_in_size
+	ret["data_out"] = s.data_out_size
+	ret["error_ratio_too_low"] = s.compression_ratio_too_low
+	ret["error_buffer_too_small"] = s.buffer_too_small
+	ret["threads"] = len(this.thread_symbol)
+	return ret
+}
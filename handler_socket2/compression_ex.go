@@ -1,7 +1,6 @@
 package handler_socket2
 
 import (
-	"fmt"
 	"github.com/slawomir-pryczek/HSServer/handler_socket2/compress"
 	"github.com/slawomir-pryczek/HSServer/handler_socket2/config"
 	"runtime"
@@ -21,9 +20,9 @@ func compression_ex_read_config() {
 	}
 
 	if compressor_flate == nil && compressor_snappy == nil {
-		fmt.Println("Multipart compression is disabled, use compression_support=[mp-flate,mp-snappy] to enable")
+		log.Info("Multipart compression is disabled, use compression_support=[mp-flate,mp-snappy] to enable")
 	} else {
-		fmt.Println("Multipart compression is enabled")
+		log.Info("Multipart compression is enabled")
 	}
 }
 
@@ -1,7 +1,6 @@
 package config
 
 import (
-	"fmt"
 	"os"
 	"strconv"
 	"strings"
@@ -16,7 +15,10 @@ var cfg_initialized = false
 var cfg_mu sync.Mutex
 var cfg_onchange []func()
 
-func attachOnChange(callback func()) {
+// AttachOnChange registers callback which is run after the configuration
+// file was changed and re-read. If the configuration was already read, the
+// callback is also run immediately
+func AttachOnChange(callback func()) {
 	cfg_mu.Lock()
 	cfg_onchange = append(cfg_onchange, callback)
 	_i := cfg_initialized
@@ -54,7 +56,7 @@ func init() {
 				continue
 			}
 
-			fmt.Println("\n\nConfig file changed, re-reading configuration!")
+			log.Info("Config file changed, re-reading configuration")
 			tmp, err := _cfg_load_config()
 			if err != nil {
 				continue
@@ -63,12 +65,12 @@ func init() {
 			tmp._cfg_conditional_config()
 			_config.Store(tmp)
 
-			cbs := make([]func(), len(cfg_onchange))
 			cfg_mu.Lock()
+			cbs := make([]func(), len(cfg_onchange))
 			copy(cbs, cfg_onchange)
 			cfg_mu.Unlock()
 			for _, cb := range cbs {
-				go func() { cb() }()
+				go cb()
 			}
 		}
 	}()
@@ -85,9 +87,7 @@ func ReadConfig() {
 
 	tmp, err := _cfg_load_config()
 	if err != nil {
-		fmt.Println("===")
-		fmt.Println("FATAL Error opening configuration file:\n", err.Error())
-		fmt.Println("===")
+		log.Error("FATAL Error opening configuration file", "err", err)
 		os.Exit(1)
 	}
 
@@ -129,6 +129,20 @@ func (this *cfg) GetRawData(attr string, def string) interface{} {
 	return def
 }
 
+// GetListenerRawData returns attribute defined for the listener in LISTENERS
+// section (eg. "LISTENERS":{"h127.0.0.1:8545":{"CORS":{...}}}), if there's
+// no listener specific setting, global attribute is returned
+func (this *cfg) GetListenerRawData(listener, attr string, def string) interface{} {
+	if listeners, ok := this.raw_data["LISTENERS"].(map[string]interface{}); ok {
+		if l, ok := listeners[listener].(map[string]interface{}); ok {
+			if val, ok := l[attr]; ok {
+				return val
+			}
+		}
+	}
+	return this.GetRawData(attr, def)
+}
+
 func (this *cfg) Get(attr, def string) string {
 	if val, ok := this.config[attr]; ok {
 		return val
@@ -9,15 +9,22 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/history"
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/hslog"
 )
 
+var log = hslog.Get("config")
+
 var cfg_debug = false
 var cfg_verbose = false
 
+// Deprecated: use hslog, Logger.IsDebug reports the level of a subsystem
 func CfgIsDebug() bool {
 	return cfg_debug
 }
 
+// Deprecated: VERBOSE is no longer used, use hslog levels instead
 func CfgIsVerbose() bool {
 	return cfg_verbose
 }
@@ -37,27 +44,57 @@ type cfg struct {
 	raw_data map[string]interface{}
 }
 
+// ARG_CHECK_CONFIG makes main validate the config file and exit, the file
+// isn't loaded as server config then
+const ARG_CHECK_CONFIG = "--check-config"
+
+// ConfigPath returns config file name, it's the first argument which is not
+// an option (options start with --), eth.json by default
+func ConfigPath() string {
+	for _, arg := range os.Args[1:] {
+		if !strings.HasPrefix(arg, "--") {
+			return arg
+		}
+	}
+	return "eth.json"
+}
+
+// HasArg returns true if the option was passed to the program, eg. --probe
+func HasArg(name string) bool {
+	for _, arg := range os.Args[1:] {
+		if arg == name {
+			return true
+		}
+	}
+	return false
+}
+
 // Load config from json file
 func _cfg_load_config() (*cfg, error) {
 	ret := cfg{}
 	data := []byte(nil)
 
+	// config is empty when it's only checked, so nothing is started from it
+	if HasArg(ARG_CHECK_CONFIG) {
+		ret.config = make(map[string]string)
+		ret.raw_data = make(map[string]interface{})
+		ret.compression_threshold = DEFAULT_COMPRESSION_THRESHOLD
+		return &ret, nil
+	}
+
 	// Load config
 	{
-		conf_path := "eth.json"
-		if len(os.Args) >= 2 {
-			conf_path = os.Args[1]
-		}
+		conf_path := ConfigPath()
 		if strings.Index(conf_path, "/") == -1 {
 			if path, err := os.Readlink("/proc/self/exe"); err == nil {
 				path = filepath.Dir(path)
 				conf_path = path + "/" + conf_path
 			} else {
-				fmt.Println("Can't find executable directory, using current dir for config!")
+				log.Warn("Can't find executable directory, using current dir for config")
 			}
 		}
 
-		fmt.Println("Reading configuration: " + conf_path)
+		log.Info("Reading configuration", "file", conf_path)
 		data_tmp, err := os.ReadFile(conf_path)
 		if err != nil {
 			return nil, err
@@ -103,8 +140,20 @@ func _cfg_load_config() (*cfg, error) {
 
 	cfg_debug = ret.config["DEBUG"] == "1"
 	cfg_verbose = ret.config["VERBOSE"] == "1"
+	if cfg_verbose {
+		log.Warn("VERBOSE is deprecated and has no effect, set levels in LOG section instead")
+	}
+
+	// DEBUG is kept for old configs, LOG section takes precedence
+	for _, w := range hslog.Configure(cfg_tmp["LOG"], ret.config["DEBUG"] == "1") {
+		log.Warn("Invalid LOG config, " + w)
+	}
+
+	for _, w := range history.Configure(cfg_tmp["HISTORY"]) {
+		log.Warn("Invalid HISTORY config, " + w)
+	}
 
-	fmt.Println("Config: ", ret.config)
+	log.Info("Config", "values", Redact(fmt.Sprint(ret.config)))
 	ret.raw_data = cfg_tmp
 	return &ret, nil
 }
@@ -152,7 +201,7 @@ func (this *cfg) _cfg_local_interfaces() {
 		match_ifaces := make([]string, 0)
 		ifaces, err := net.Interfaces()
 		if err != nil {
-			fmt.Println("Cannot read interfaces (0x2) ", err.Error())
+			log.Error("Cannot read interfaces (0x2)", "err", err)
 			os.Exit(2)
 		}
 
@@ -160,7 +209,7 @@ func (this *cfg) _cfg_local_interfaces() {
 
 			addrs, err := iface.Addrs()
 			if err != nil {
-				fmt.Println("Cannot read interfaces (0x3) ", err.Error())
+				log.Error("Cannot read interfaces (0x3)", "err", err)
 				os.Exit(3)
 			}
 
@@ -179,27 +228,17 @@ func (this *cfg) _cfg_local_interfaces() {
 				if ip.To4() != nil {
 					// ipv4 processing
 					pieces := strings.Split(ip.String(), ".")
-					if cfg_verbose {
-						fmt.Print("Interface V4 ", iface.Name, " ... ")
-					}
-
+					_matches := make([]string, 0, len(pieces))
 					for i := 0; i < len(pieces); i++ {
 						_m := strings.Join(pieces[i:], ".")
 						match_ifaces = append(match_ifaces, _m)
-						if cfg_verbose {
-							fmt.Print(_m, " ")
-						}
+						_matches = append(_matches, _m)
 					}
+					log.Debug("Interface V4", "iface", iface.Name, "match", strings.Join(_matches, " "))
 				} else {
-					if cfg_verbose {
-						fmt.Print("Interface V6 ", iface.Name, " ... ", ip.String())
-					}
+					log.Debug("Interface V6", "iface", iface.Name, "match", ip.String())
 					match_ifaces = append(match_ifaces, ip.String())
 				}
-
-				if cfg_verbose {
-					fmt.Println()
-				}
 			}
 		}
 
@@ -217,7 +256,6 @@ func (this *cfg) _cfg_local_interfaces() {
 // the original parameter
 func (this *cfg) _cfg_conditional_config() {
 
-	fmt.Println(" --- Conditional config:")
 	_do_conditional := func(param string) string {
 		ret := make([]string, 0)
 		ret_uniq := make(map[string]bool)
@@ -239,7 +277,7 @@ func (this *cfg) _cfg_conditional_config() {
 			_key := param + "_" + iface_match
 			if v, exists := this.config[_key]; exists {
 				vv := strings.Split(v, ",")
-				fmt.Println(" ▶ Conditional config", _key, "adding -", vv)
+				log.Info("Conditional config", "key", _key, "adding", strings.Join(vv, ","))
 				for _, vvv := range vv {
 					_add(vvv)
 				}
@@ -0,0 +1,45 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// PathError is a problem with the config value, Path is JSON path of the
+// value, like $.ALERTS.targets[0].chat_id. Warnings are reported, but the
+// config is still accepted
+type PathError struct {
+	Path    string
+	Message string
+	Warning bool
+}
+
+func (this PathError) Error() string {
+	return this.Path + ": " + this.Message
+}
+
+// PathErrors are collected by section readers, so every problem is
+// reported, not only the first one
+type PathErrors []PathError
+
+func (this *PathErrors) Add(path string, format string, a ...interface{}) {
+	*this = append(*this, PathError{Path: path, Message: fmt.Sprintf(format, a...)})
+}
+
+// PathKey appends key to JSON path, keys which are not identifiers are quoted
+func PathKey(path, key string) string {
+	for i, c := range key {
+		if !(c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (i > 0 && c >= '0' && c <= '9')) {
+			return path + "[" + strconv.Quote(key) + "]"
+		}
+	}
+	if len(key) == 0 {
+		return path + `[""]`
+	}
+	return path + "." + key
+}
+
+// PathIndex appends array index to JSON path
+func PathIndex(path string, index int) string {
+	return path + "[" + strconv.Itoa(index) + "]"
+}
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+var rxSecretRef = regexp.MustCompile(`\$\{(env|file):([^}]+)\}`)
+
+var secrets_mu sync.RWMutex
+var secrets = make(map[string]bool)
+
+func _resolve_ref(kind, name string) (string, error) {
+	name = strings.TrimSpace(name)
+	switch kind {
+	case "env":
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return v, nil
+	case "file":
+		v, err := os.ReadFile(name)
+		if err != nil {
+			return "", fmt.Errorf("cannot read secret file %s: %s", name, err.Error())
+		}
+		return strings.Trim(string(v), "\r\n\t "), nil
+	}
+	return "", fmt.Errorf("unknown secret reference %s:%s", kind, name)
+}
+
+// ResolveSecrets replaces ${env:NAME} and ${file:/path} references with
+// the values. Value which is a reference as a whole (env:NAME, file:/path)
+// is resolved too. Resolved values are remembered, so they can be redacted
+func ResolveSecrets(s string) (string, error) {
+	for _, kind := range []string{"env", "file"} {
+		if strings.HasPrefix(s, kind+":") {
+			s = "${" + s + "}"
+		}
+	}
+
+	resolved := make([]string, 0)
+	var ret_err error
+	ret := rxSecretRef.ReplaceAllStringFunc(s, func(ref string) string {
+		m := rxSecretRef.FindStringSubmatch(ref)
+		v, err := _resolve_ref(m[1], m[2])
+		if err != nil {
+			ret_err = err
+			return ""
+		}
+		resolved = append(resolved, v)
+		return v
+	})
+	if ret_err != nil {
+		return "", ret_err
+	}
+
+	RegisterSecret(resolved...)
+	return ret, nil
+}
+
+// RegisterSecret adds values which should be redacted
+func RegisterSecret(values ...string) {
+	secrets_mu.Lock()
+	for _, v := range values {
+		// very short values would redact unrelated parts of the text
+		if len(v) >= 4 {
+			secrets[v] = true
+		}
+	}
+	secrets_mu.Unlock()
+}
+
+// HasSecretRefs returns true if the string contains secret references
+func HasSecretRefs(s string) bool {
+	return rxSecretRef.MatchString(s) || strings.HasPrefix(s, "env:") || strings.HasPrefix(s, "file:")
+}
+
+// Redact replaces all resolved secret values in the string with ****
+func Redact(s string) string {
+	secrets_mu.RLock()
+	defer secrets_mu.RUnlock()
+	for secret := range secrets {
+		s = strings.Replace(s, secret, "****", -1)
+	}
+	return s
+}
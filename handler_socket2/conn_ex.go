@@ -1,7 +1,6 @@
 package handler_socket2
 
 import (
-	"fmt"
 	"net"
 	"strings"
 
@@ -65,8 +64,6 @@ func handle_conn_ex(data *HSParams, conn_ex *conninfo) {
 		_algo = conn_ex.comp.GetID()
 	}
 
-	fmt.Println("\t Conn-Ex <- ", conn_ex.conn.RemoteAddr(),
-		" Network distance:", conn_ex.remote_distance,
-		" size >", conn_ex.compression_threshold,
-		" = ", _algo)
+	log.Debug("Connection compression", "remote", conn_ex.conn.RemoteAddr(), "distance", conn_ex.remote_distance,
+		"threshold", conn_ex.compression_threshold, "algo", _algo)
 }
@@ -17,14 +17,18 @@ import (
 
 	"github.com/slawomir-pryczek/HSServer/handler_socket2/byteslabs"
 	"github.com/slawomir-pryczek/HSServer/handler_socket2/compress"
-	"github.com/slawomir-pryczek/HSServer/handler_socket2/config"
 	"github.com/slawomir-pryczek/HSServer/handler_socket2/hscommon"
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/hslog"
 	"github.com/slawomir-pryczek/HSServer/handler_socket2/oslimits"
 	"github.com/slawomir-pryczek/HSServer/handler_socket2/stats"
 )
 
 const version = "HSServer v4"
 
+var log = hslog.Get("socket")
+var log_http = hslog.Get("http")
+var log_udp = hslog.Get("udp")
+
 var uptime_started int
 
 func init() {
@@ -41,7 +45,19 @@ func init() {
 		return "Compression Plugins", ret
 	}
 
-	StatusPluginRegister(_comp_status)
+	_comp_status_data := func() (string, interface{}) {
+		ret := make(map[string]interface{})
+		ret["simple"] = compress.CompressSimpleStatusData()
+		if compressor_flate != nil {
+			ret["flate"] = compressor_flate.GetStatusData()
+		}
+		if compressor_snappy != nil {
+			ret["snappy"] = compressor_snappy.GetStatusData()
+		}
+		return "Compression Plugins", ret
+	}
+
+	StatusPluginRegisterData(_comp_status, _comp_status_data)
 }
 
 func GetStatus() map[string]string {
@@ -74,6 +90,17 @@ func GetStatus() map[string]string {
 	return ret
 }
 
+// socket messages are never larger than this, even if LIMITS allow more or
+// max_request_bytes is 0, the client declares the size we need to allocate
+const socket_max_request_bytes = 1024 * 1024 * 16
+
+func socketMaxRequestBytes() int {
+	if max := GetSizeLimits().MaxRequestBytes; max > 0 && max < socket_max_request_bytes {
+		return max
+	}
+	return socket_max_request_bytes
+}
+
 func getStreamBuffer(stream, recv_buffer []byte, b1 []byte, params *HSParams) ([]byte, uint32, bool) {
 
 	size := int64(-1)
@@ -102,8 +129,9 @@ func getStreamBuffer(stream, recv_buffer []byte, b1 []byte, params *HSParams) ([
 
 	if size > -1 {
 
-		if size > 1024*1024*16 {
-			size = 1024 * 1024 * 16
+		// request over the limit, caller needs to check the size
+		if size > int64(socketMaxRequestBytes()) {
+			return []byte{}, uint32(size), false
 		}
 
 		if head == 'B' || head == 'b' {
@@ -156,7 +184,7 @@ func processHeader(headerData []byte) (bool, int, string) {
 	return is_compressed, content_length, guid
 }
 
-func serveSocket(conn *net.TCPConn, handler handlerFunc) {
+func serveSocket(conn *net.TCPConn, listener string, handler handlerFunc) {
 
 	// add new connection struct
 	newconn := stats.MakeConnection(conn.RemoteAddr().String())
@@ -191,12 +219,7 @@ func serveSocket(conn *net.TCPConn, handler handlerFunc) {
 
 			to_log += "###################"
 
-			fmt.Println(to_log)
-
-			for _, v := range strings.Split(to_log, "\n") {
-				fmt.Fprintln(os.Stderr, v)
-			}
-
+			log.Error("Panic", "err", fmt.Sprint(e), "request", fmt.Sprintf("%v", *c), "stack", string(trace[:count]))
 			var _ = ioutil.WriteFile("panic"+time.Now().Format("20060201_150405")+".txt", []byte(to_log), 0644)
 
 			os.Exit(1)
@@ -212,10 +235,11 @@ func serveSocket(conn *net.TCPConn, handler handlerFunc) {
 	buffer := make([]byte, 1024*16)
 	sharedmem := make([]byte, 1024*32)
 	t_start := int64(0)
+	conn_bytes, conn_exceeded := 0, false
 
 	// get configuration and some connection specific data, like compression we should use
 	conn_ex := make_conn_ex(conn)
-	fmt.Println("In ServeSocket <- ", conn.RemoteAddr(), "Network distance:", conn_ex.remote_distance, "Compression threshold:", conn_ex.compression_threshold)
+	log.Debug("Connection", "remote", conn.RemoteAddr(), "distance", conn_ex.remote_distance, "compression_threshold", conn_ex.compression_threshold)
 
 	params := CreateHSParams()
 	for {
@@ -254,6 +278,13 @@ func serveSocket(conn *net.TCPConn, handler handlerFunc) {
 
 			// check the header
 			if !header_ok {
+				if max := socketMaxRequestBytes(); int(tmp_size) > max {
+					_client_ip := ClientIP(conn.RemoteAddr().String(), "")
+					sendBack(conn_ex, params, LimitError(LIMIT_REQUEST_BYTES, _client_ip, RPC_ERR_INVALID_REQUEST,
+						fmt.Sprintf("Request too large, limit is %d bytes", max), max), 0, nil, sharedmem[:0])
+					newconn.Close("Request too large", true)
+					break
+				}
 				newconn.Close("Header type is incorrect", true)
 				break
 			}
@@ -324,13 +355,18 @@ func serveSocket(conn *net.TCPConn, handler handlerFunc) {
 			newconn.Close("Cannot decode header", true)
 			break
 		}
+		params.SetParam("__listener", listener)
+		params.SetParam("__remote_addr", conn.RemoteAddr().String())
+		params.SetParam("__client_ip", ClientIP(conn.RemoteAddr().String(), ""))
+		params.SetParam("__request_id", RequestID(params.GetParam("request_id", "")))
+		params.SetRespHeader(REQUEST_ID_HEADER, params.GetParam("__request_id", ""))
 
 		action := params.GetParam("action", "?")
 		_pinfo := params.getParamInfo()
 		newconn.StateServing(action, _pinfo)
 
-		if config.CfgIsDebug() {
-			fmt.Println("Rec:", bytes_rec_uncompressed, "b GUID:", string(guid))
+		if log.IsDebug() {
+			log.Debug("Request", "bytes", bytes_rec_uncompressed, "guid", string(guid))
 		}
 
 		// remove the message, clean the stream if possible!
@@ -340,7 +376,16 @@ func serveSocket(conn *net.TCPConn, handler handlerFunc) {
 		}
 
 		tmp := ""
-		if action == "conn-ex" {
+		limit_ok, limit_reason, limit_done := requestLimitBegin(params.GetParam("__client_ip", ""))
+		conn_bytes += int(message_len)
+		if max := GetSizeLimits().MaxConnectionBytes; limit_ok && max > 0 && conn_bytes > max {
+			tmp = string(LimitError(LIMIT_CONNECTION_BYTES, params.GetParam("__client_ip", ""), RPC_ERR_CONNECTION_EXCEEDED,
+				fmt.Sprintf("Connection transferred over %d bytes, please reconnect", max), max))
+			conn_exceeded = true
+		} else if !limit_ok {
+			tmp = string(limitError(limit_reason))
+			limit_done = func(int) {}
+		} else if action == "conn-ex" {
 			// special case, conn-ex handler is always available
 			handle_conn_ex(params, &conn_ex)
 		} else {
@@ -388,9 +433,16 @@ func serveSocket(conn *net.TCPConn, handler handlerFunc) {
 		// <<< Stats code
 		newconn.StateKeepalive(uint64(_sent_bytes), took, skip_response_sent)
 		// <<< Stats code ends
+		limit_done(_sent_bytes)
+		conn_bytes += _sent_bytes
 
 		t_start = 0
 		params.Cleanup()
+
+		if conn_exceeded {
+			newconn.Close("Connection bytes limit exceeded", true)
+			break
+		}
 	}
 
 	conn.Close()
@@ -529,8 +581,17 @@ func handlerServerStatus(data *HSParams) string {
 
 	// let's get plugin status!
 	status_additional := ""
+	if data.GetParam("format", "") == "json" {
+		data.SetRespHeader("Content-Type", "application/json")
+		return handlerServerStatusJSON()
+	}
+	if data.GetParam("format", "") == "history" {
+		data.SetRespHeader("Content-Type", "application/json")
+		return handlerServerStatusHistory(data)
+	}
+
 	for _, sp := range statusPlugins {
-		header, content := sp()
+		header, content := sp.html()
 		status_additional += "<div class='container'><h1>" + header + "</h1>" + content + "</div>"
 	}
 
@@ -547,7 +608,7 @@ func handlerServerStatus(data *HSParams) string {
 	if _path, err := os.Readlink("/proc/self/exe"); err == nil {
 		path = filepath.Dir(_path) + "/"
 	} else {
-		fmt.Println("Warning: Can't find exe file path")
+		log.Warn("Can't find exe file path")
 	}
 
 	_template, err := ioutil.ReadFile(path + "server-status.html")
@@ -0,0 +1,316 @@
+package history
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/hslog"
+)
+
+var log = hslog.Get("history")
+
+// Fields kept for every series, throttle usage is a gauge so the highest
+// value is kept when downsampling, other fields are summed
+const (
+	FIELD_REQUESTS = iota
+	FIELD_ERRORS
+	FIELD_TIME_MS
+	FIELD_BYTES_IN
+	FIELD_BYTES_OUT
+	FIELD_THROTTLE
+	FIELD_COUNT
+)
+
+var field_names = [FIELD_COUNT]string{"requests", "errors", "time_ms", "bytes_in", "bytes_out", "throttle_used"}
+var field_max = [FIELD_COUNT]bool{FIELD_THROTTLE: true}
+
+type Values [FIELD_COUNT]float64
+
+// per-second for an hour, per-minute for a day, per-hour for 30 days
+var resolutions = []struct {
+	name string
+	sec  int64
+	size int64
+}{{"1s", 1, 3600}, {"1m", 60, 1440}, {"1h", 3600, 720}}
+
+const max_series = 1000
+const max_age = 30 * 24 * 3600
+const file_version = 1
+
+type Ring struct {
+	Slot   int64
+	Values [FIELD_COUNT][]float64
+}
+
+type Series struct {
+	Rings   [3]Ring
+	Updated int64
+}
+
+type file_data struct {
+	Version int
+	Series  map[string]*Series
+}
+
+var mu sync.Mutex
+var series = make(map[string]*Series)
+var file = ""
+var save_every = int64(60)
+
+// Configure applies HISTORY section of the config, eg.
+// "HISTORY":{"file":"history.gob", "save_every":60}
+// history is always kept in memory, when file is set it's loaded on start
+// and saved every save_every seconds, so it survives restarts
+func Configure(raw interface{}) []string {
+	warnings := make([]string, 0)
+	cfg, _ := raw.(map[string]interface{})
+	_file, _ := cfg["file"].(string)
+	_save_every := int64(60)
+	if v, ok := cfg["save_every"].(json.Number); ok {
+		if i, err := v.Int64(); err == nil && i > 0 {
+			_save_every = i
+		}
+	}
+
+	mu.Lock()
+	is_new := len(file) == 0 && len(_file) > 0
+	file = _file
+	save_every = _save_every
+	mu.Unlock()
+	if !is_new {
+		return warnings
+	}
+
+	if err := _load(); err != nil {
+		warnings = append(warnings, "can't load history from "+_file+", "+err.Error())
+	}
+	go func() {
+		last := time.Now().Unix()
+		for {
+			time.Sleep(time.Second)
+			mu.Lock()
+			due := time.Now().Unix()-last >= save_every
+			mu.Unlock()
+			if !due {
+				continue
+			}
+			last = time.Now().Unix()
+			if err := Save(); err != nil {
+				log.Error("Can't save history", "err", err)
+			}
+		}
+	}()
+	return warnings
+}
+
+func (this *Ring) add(slot, size int64, v *Values) {
+	if slot > this.Slot {
+		n := slot - this.Slot
+		if n > size {
+			n = size
+		}
+		for i := int64(1); i <= n; i++ {
+			pos := (slot - n + i) % size
+			for f := range this.Values {
+				if this.Values[f] != nil {
+					this.Values[f][pos] = 0
+				}
+			}
+		}
+		this.Slot = slot
+	}
+	if slot <= this.Slot-size {
+		return
+	}
+
+	pos := slot % size
+	for f, val := range v {
+		if val == 0 {
+			continue
+		}
+		if int64(len(this.Values[f])) != size {
+			this.Values[f] = make([]float64, size)
+		}
+		if !field_max[f] {
+			this.Values[f][pos] += val
+		} else if val > this.Values[f][pos] {
+			this.Values[f][pos] = val
+		}
+	}
+}
+
+func (this *Ring) get(f int, slot, size int64) float64 {
+	if slot > this.Slot || slot <= this.Slot-size || int64(len(this.Values[f])) != size {
+		return 0
+	}
+	return this.Values[f][slot%size]
+}
+
+// Add records values of the second ts, into all resolutions. Series name
+// is eg. "server", "node:1", "action:ethereum_raw"
+func Add(name string, ts int64, v Values) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	s, ok := series[name]
+	if !ok {
+		if len(series) >= max_series {
+			return
+		}
+		s = &Series{}
+		series[name] = s
+	}
+	s.Updated = ts
+	for i, res := range resolutions {
+		s.Rings[i].add(ts/res.sec, res.size, &v)
+	}
+}
+
+type Result struct {
+	Res    string                          `json:"res"`
+	Step   int64                           `json:"step"`
+	From   int64                           `json:"from"`
+	To     int64                           `json:"to"`
+	Series map[string]map[string][]float64 `json:"series"`
+}
+
+func _match(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if p == name || p == "*" || (strings.HasSuffix(p, "*") && strings.HasPrefix(name, p[:len(p)-1])) {
+			return true
+		}
+	}
+	return len(patterns) == 0
+}
+
+// Query returns last points of series matching patterns ("*" at the end
+// matches a prefix), at resolution res: 1s, 1m or 1h. Fields which have no
+// data are skipped, latency_ms is computed from time_ms and requests. The
+// last point of 1m and 1h resolutions is the current, incomplete period
+func Query(res string, patterns []string, points int) (*Result, error) {
+	r := -1
+	for i, v := range resolutions {
+		if v.name == res {
+			r = i
+		}
+	}
+	if r < 0 {
+		return nil, fmt.Errorf("unknown resolution %s, use 1s, 1m or 1h", res)
+	}
+	step, size := resolutions[r].sec, resolutions[r].size
+	if points <= 0 || int64(points) > size {
+		points = int(size)
+	}
+
+	// current second is still collected
+	to := (time.Now().Unix() - 1) / step
+	from := to - int64(points) + 1
+	ret := &Result{Res: res, Step: step, From: from * step, To: to * step, Series: make(map[string]map[string][]float64)}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	for name, s := range series {
+		if !_match(patterns, name) {
+			continue
+		}
+		ring := &s.Rings[r]
+		fields := make(map[string][]float64)
+		for f := 0; f < FIELD_COUNT; f++ {
+			if ring.Values[f] == nil {
+				continue
+			}
+			vals := make([]float64, points)
+			for i := range vals {
+				vals[i] = ring.get(f, from+int64(i), size)
+			}
+			fields[field_names[f]] = vals
+		}
+
+		if reqs, ok := fields["requests"]; ok && fields["time_ms"] != nil {
+			lat := make([]float64, points)
+			for i := range lat {
+				if reqs[i] > 0 {
+					lat[i] = fields["time_ms"][i] / reqs[i]
+				}
+			}
+			fields["latency_ms"] = lat
+		}
+		ret.Series[name] = fields
+	}
+	return ret, nil
+}
+
+func _load() error {
+	mu.Lock()
+	_file := file
+	mu.Unlock()
+
+	f, err := os.Open(_file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	data := file_data{}
+	if err := gob.NewDecoder(f).Decode(&data); err != nil {
+		return err
+	}
+	if data.Version != file_version {
+		return fmt.Errorf("unsupported version %d", data.Version)
+	}
+
+	mu.Lock()
+	for name, s := range data.Series {
+		if _, ok := series[name]; !ok && s != nil {
+			series[name] = s
+		}
+	}
+	mu.Unlock()
+	log.Info("History loaded", "file", _file, "series", len(data.Series))
+	return nil
+}
+
+// Save writes history to the file, series which weren't updated for
+// longer than the longest resolution are removed
+func Save() error {
+	mu.Lock()
+	_file := file
+	mu.Unlock()
+	if len(_file) == 0 {
+		return nil
+	}
+
+	tmp := _file + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	now := time.Now().Unix()
+	for name, s := range series {
+		if now-s.Updated > max_age {
+			delete(series, name)
+		}
+	}
+	err = gob.NewEncoder(f).Encode(file_data{Version: file_version, Series: series})
+	mu.Unlock()
+
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, _file)
+}
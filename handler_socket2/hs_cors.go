@@ -0,0 +1,235 @@
+package handler_socket2
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/config"
+)
+
+// CORS policy, configured in CORS section, or per listener in LISTENERS
+// section. Without configuration any origin is allowed, same as before
+// policies were configurable
+type corsPolicy struct {
+	configured  bool
+	origins     []string
+	methods     string
+	headers     string
+	credentials bool
+	max_age     int
+}
+
+var corsMu sync.Mutex
+var corsPolicies = make(map[string]*corsPolicy)
+
+func init() {
+	// policies are read again after the config file changes
+	config.AttachOnChange(func() {
+		corsMu.Lock()
+		corsPolicies = make(map[string]*corsPolicy)
+		corsMu.Unlock()
+	})
+}
+
+func _cors_list(raw map[string]interface{}, attr, def string) []string {
+	v, ok := raw[attr].(string)
+	if !ok {
+		v = def
+	}
+
+	ret := make([]string, 0)
+	for _, item := range strings.Split(v, ",") {
+		item = strings.Trim(item, "\r\n\t ")
+		if len(item) > 0 {
+			ret = append(ret, item)
+		}
+	}
+	return ret
+}
+
+var cors_attrs = map[string]string{"origins": "string", "methods": "string", "headers": "string",
+	"credentials": "bool", "max_age": "integer >= 0"}
+
+func _cors_read(raw map[string]interface{}, path string) (*corsPolicy, config.PathErrors) {
+	errs := config.PathErrors{}
+	for attr, v := range raw {
+		kind, ok := cors_attrs[attr]
+		switch kind {
+		case "string":
+			_, ok = v.(string)
+		case "bool":
+			_, ok = v.(bool)
+		case "integer >= 0":
+			n, _ok := v.(json.Number)
+			i, err := n.Int64()
+			ok = _ok && err == nil && i >= 0
+		default:
+			errs.Add(config.PathKey(path, attr), "unknown CORS attribute")
+			continue
+		}
+		if !ok {
+			errs.Add(config.PathKey(path, attr), "expected %s", kind)
+		}
+	}
+
+	ret := &corsPolicy{configured: true}
+	ret.origins = _cors_list(raw, "origins", "")
+	for num, o := range ret.origins {
+		ret.origins[num] = strings.ToLower(strings.TrimRight(o, "/"))
+	}
+	ret.methods = strings.Join(_cors_list(raw, "methods", "GET,POST,OPTIONS"), ", ")
+	ret.headers = strings.Join(_cors_list(raw, "headers", "Content-Type,Authorization,X-Api-Key"), ", ")
+	ret.credentials, _ = raw["credentials"].(bool)
+	if v, ok := raw["max_age"].(json.Number); ok {
+		_v, _ := v.Int64()
+		ret.max_age = int(_v)
+	}
+	return ret, errs
+}
+
+// CORSConfigCheck validates CORS section, global one or defined for
+// the listener
+func CORSConfigCheck(raw interface{}, path string) []config.PathError {
+	_raw, ok := raw.(map[string]interface{})
+	if !ok {
+		return []config.PathError{{Path: path, Message: "expected object"}}
+	}
+	_, errs := _cors_read(_raw, path)
+	return errs
+}
+
+func corsGetPolicy(listener string) *corsPolicy {
+	corsMu.Lock()
+	defer corsMu.Unlock()
+
+	if p, ok := corsPolicies[listener]; ok {
+		return p
+	}
+
+	ret := &corsPolicy{}
+	raw, ok := config.Config().GetListenerRawData(listener, "CORS", "").(map[string]interface{})
+	if ok {
+		var errs config.PathErrors
+		ret, errs = _cors_read(raw, "CORS")
+		for _, err := range errs {
+			log_http.Warn("Invalid CORS config", "listener", listener, "err", err)
+		}
+		log_http.Info("CORS policy", "listener", listener, "origins", ret.origins, "credentials", ret.credentials)
+	}
+	corsPolicies[listener] = ret
+	return ret
+}
+
+// Origins can be exact (https://app.example.com), * for any origin, or
+// wildcard subdomains (https://*.example.com, *.example.com)
+func (this *corsPolicy) isOriginAllowed(origin string) bool {
+	origin = strings.ToLower(origin)
+	scheme, host := "", origin
+	if pos := strings.Index(origin, "://"); pos > -1 {
+		scheme, host = origin[0:pos], origin[pos+3:]
+	}
+
+	for _, o := range this.origins {
+		if o == "*" || o == origin {
+			return true
+		}
+
+		_host := o
+		if pos := strings.Index(o, "://"); pos > -1 {
+			if o[0:pos] != scheme {
+				continue
+			}
+			_host = o[pos+3:]
+		}
+		if !strings.HasPrefix(_host, "*.") {
+			continue
+		}
+		// port is only compared if the wildcard entry has one
+		_origin_host := host
+		if _, _, err := net.SplitHostPort(_host[2:]); err != nil {
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				_origin_host = h
+			}
+		}
+		if strings.HasSuffix(_origin_host, _host[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (this *corsPolicy) _is_method_allowed(method string) bool {
+	for _, m := range strings.Split(this.methods, ",") {
+		m = strings.TrimSpace(m)
+		if m == "*" || strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// Sets CORS headers for the request. Returns false if the request should
+// not be processed further, that's the case for preflight requests. For
+// origins which are not allowed the headers are left out, so the browser
+// won't expose the response
+func (this *corsPolicy) handle(w http.ResponseWriter, r *http.Request) bool {
+	if !this.configured {
+		w.Header().Add("Access-Control-Allow-Origin", "*")
+		w.Header().Add("Access-Control-Allow-Headers", "*")
+		w.Header().Add("Access-Control-Allow-Methods", "*")
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusNoContent)
+			return false
+		}
+		return true
+	}
+
+	origin := r.Header.Get("Origin")
+	is_preflight := r.Method == "OPTIONS"
+
+	if len(origin) == 0 {
+		if is_preflight {
+			w.Header().Set("Allow", this.methods)
+			w.WriteHeader(http.StatusNoContent)
+			return false
+		}
+		return true
+	}
+
+	w.Header().Add("Vary", "Origin")
+	if !this.isOriginAllowed(origin) {
+		if is_preflight {
+			w.WriteHeader(http.StatusNoContent)
+			return false
+		}
+		return true
+	}
+
+	if this.credentials || !in_array(this.origins, "*") {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+	} else {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	}
+	if this.credentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	if !is_preflight {
+		return true
+	}
+
+	// preflight is answered here, and never passed to plugins or handlers
+	if req_method := r.Header.Get("Access-Control-Request-Method"); len(req_method) > 0 && this._is_method_allowed(req_method) {
+		w.Header().Set("Access-Control-Allow-Methods", this.methods)
+		w.Header().Set("Access-Control-Allow-Headers", this.headers)
+		if this.max_age > 0 {
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(this.max_age))
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return false
+}
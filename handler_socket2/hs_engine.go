@@ -3,6 +3,7 @@ package handler_socket2
 import (
 	"fmt"
 	"github.com/slawomir-pryczek/HSServer/handler_socket2/config"
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/metrics"
 	"net"
 	"os"
 	"sync"
@@ -34,10 +35,35 @@ func RegisterHandler(handlers ...ActionHandler) {
 
 type StatusPlugin func() (string, string)
 
-var statusPlugins = make([]StatusPlugin, 0)
+// StatusPluginData returns plugin's title and structured data, which is
+// served by ?action=server-status&format=json
+type StatusPluginData func() (string, interface{})
+
+type statusPlugin struct {
+	html StatusPlugin
+	data StatusPluginData
+}
+
+var statusPlugins = make([]statusPlugin, 0)
 
 func StatusPluginRegister(f StatusPlugin) {
-	statusPlugins = append(statusPlugins, f)
+	statusPlugins = append(statusPlugins, statusPlugin{html: f})
+}
+
+// StatusPluginRegisterData registers plugin which provides both HTML and
+// structured status, plugins without data are served as HTML in JSON status
+func StatusPluginRegisterData(f StatusPlugin, data StatusPluginData) {
+	statusPlugins = append(statusPlugins, statusPlugin{html: f, data: data})
+}
+
+// ActionGuard is run before the action is handled, if it returns false
+// the request is rejected and the returned string is sent back
+type ActionGuard func(action string, data *HSParams) (bool, string)
+
+var actionGuards = make([]ActionGuard, 0)
+
+func ActionGuardRegister(f ActionGuard) {
+	actionGuards = append(actionGuards, f)
 }
 
 var boundTo []string = []string{}
@@ -68,7 +94,7 @@ func StartServer(bind_to []string) {
 			}
 
 			if config.Config().Get("FORCE_START", "") == "1" {
-				fmt.Println("WARNING: Can't bind to all interfaces, but FORCE_START in effect")
+				log.Warn("Can't bind to all interfaces, but FORCE_START in effect", "addr", bt)
 			} else {
 				fmt.Fprintf(os.Stderr, "Cannot bind to: %s or unexpected thread exit\n", bt)
 				os.Exit(1)
@@ -89,17 +115,17 @@ func startService(bindTo string, handler handlerFunc) {
 	tcpAddr, err := net.ResolveTCPAddr("tcp4", bindTo)
 
 	if err != nil {
-		fmt.Printf("Error resolving address: %s, %s\n", bindTo, err)
+		log.Error("Error resolving address", "addr", bindTo, "err", err)
 		return
 	}
 
 	listener, err := net.ListenTCP("tcp", tcpAddr)
 	if err != nil {
-		fmt.Printf("Error listening on TCP address: %s, %s\n", bindTo, err)
+		log.Error("Error listening on TCP address", "addr", bindTo, "err", err)
 		return
 	}
 
-	fmt.Printf("Socket Service started : %s\n", bindTo)
+	log.Info("Socket Service started", "addr", bindTo)
 	boundMutex.Lock()
 	boundTo = append(boundTo, "socket:"+bindTo)
 	boundMutex.Unlock()
@@ -110,7 +136,7 @@ func startService(bindTo string, handler handlerFunc) {
 			continue
 		}
 
-		go serveSocket(conn, handler)
+		go serveSocket(conn, bindTo, handler)
 	}
 }
 
@@ -131,14 +157,23 @@ func handleRequest(data *HSParams) string {
 
 	action := data.GetParam("action", "")
 
+	for _, guard := range actionGuards {
+		if ok, ret := guard(action, data); !ok {
+			return ret
+		}
+	}
+
 	if action == "server-status" {
 		return handlerServerStatus(data)
 	}
 
-	if config.CfgIsDebug() {
-		fmt.Printf("Action %s\n", action)
+	if action == "metrics" {
+		data.SetRespHeader("Content-Type", "text/plain; version=0.0.4")
+		return metrics.Render()
 	}
 
+	log.Debug("Action", "action", action)
+
 	if action == "" {
 		return "Please specify action (0x1), or ?action=server-status for help"
 	}
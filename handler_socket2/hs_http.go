@@ -1,15 +1,20 @@
 package handler_socket2
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/slawomir-pryczek/HSServer/handler_socket2/hscommon"
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/stats"
 )
 
 type HTTPPlugin func(http.ResponseWriter, http.Header, map[string]string, []byte) bool
@@ -20,26 +25,57 @@ func HTTPPluginRegister(f HTTPPlugin) {
 	HTTPPlugins = append(HTTPPlugins, f)
 }
 
+// headers passed to action handlers as internal parameters
+var httpInternalHeaders = map[string]string{
+	"Authorization":    "__authorization",
+	"X-Auth-Key":       "__auth_key",
+	"X-Auth-Timestamp": "__auth_ts",
+	"X-Auth-Signature": "__auth_sig",
+	"X-Api-Key":        "__api_key",
+}
+
+// counts bytes sent back, so they can be accounted by request limiters
+type httpCountingWriter struct {
+	http.ResponseWriter
+	written int
+	status  int
+}
+
+func (this *httpCountingWriter) WriteHeader(status int) {
+	this.status = status
+	this.ResponseWriter.WriteHeader(status)
+}
+
+func (this *httpCountingWriter) Write(b []byte) (int, error) {
+	n, err := this.ResponseWriter.Write(b)
+	this.written += n
+	return n, err
+}
+
+type httpContextKey int
+
+const httpConnBytesKey httpContextKey = 0
+
+func _http_limit_error(w http.ResponseWriter, status int, body []byte) {
+	w.Header().Add("Content-type", "application/json")
+	w.Header().Add("Content-length", strconv.Itoa(len(body)))
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
 func startServiceHTTP(bindTo string, handler handlerFunc) {
 
-	fmt.Printf("HTTP Service starting : %s\n", bindTo)
+	log_http.Info("HTTP Service starting", "addr", bindTo)
 	boundMutex.Lock()
 	boundTo = append(boundTo, "http://"+bindTo)
 	boundMutex.Unlock()
 
 	handle_hunc := func(w http.ResponseWriter, r *http.Request) {
 		req_len := 0
-		w.Header().Add("Access-Control-Allow-Origin", "*")
-		w.Header().Add("Access-Control-Allow-Headers", "*")
-		w.Header().Add("Access-Control-Allow-Methods", "*")
-		// w.Header().Add("Access-Control-Allow-Methods", "*")
-		// if r.Method == "OPTIONS" {
-		// 	// w.Header().Add("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		// 	w.Header().Add("Content-Type", "text/plain; charset=utf-8")
-		// 	w.Header().Add("Content-Length", "0")
-		// 	w.Header().Add("Access-Control-Allow-Credentials", "true")
-		// 	w.Header().Add("Access-Control-Max-Age", "1728000")
-		// }
+		if !corsGetPolicy("h"+bindTo).handle(w, r) {
+			return
+		}
+
 		params := make(map[string]string)
 		for k, v := range r.URL.Query() {
 			v_ := strings.Join(v, ",")
@@ -47,17 +83,55 @@ func startServiceHTTP(bindTo string, handler handlerFunc) {
 			req_len += len(k) + len(v)
 		}
 
+		// Prometheus scrapes /metrics, which is served by metrics action
+		if r.URL.Path == "/metrics" && len(params["action"]) == 0 {
+			params["action"] = "metrics"
+		}
+
+		// internal parameters are set after the query is parsed, so they
+		// can't be overwritten by the client
+		params["__path"] = r.URL.Path
+		params["__listener"] = "h" + bindTo
+		params["__remote_addr"] = r.RemoteAddr
+		params["__client_ip"] = ClientIP(r.RemoteAddr, r.Header.Get("X-Forwarded-For"))
+		for header, param := range httpInternalHeaders {
+			if v := r.Header.Get(header); len(v) > 0 {
+				params[param] = v
+			}
+		}
+		params["__request_id"] = RequestID(r.Header.Get(REQUEST_ID_HEADER))
+		w.Header().Set(REQUEST_ID_HEADER, params["__request_id"])
+
+		limit_ok, limit_reason, limit_done := requestLimitBegin(params["__client_ip"])
+		if !limit_ok {
+			_http_limit_error(w, http.StatusTooManyRequests, limitError(limit_reason))
+			return
+		}
+		cw := &httpCountingWriter{ResponseWriter: w}
+		w = cw
+		defer func() { limit_done(cw.written) }()
+
 		for k, v := range r.Header {
 			req_len += len(k) + len(v)
 		}
 
 		// build request representation from GET and POST
+		limits := GetSizeLimits()
 		str_req_id := r.URL.RawQuery
 		r_body := make([]byte, 0)
 		if r.Method == "POST" {
-			tmp, err := ioutil.ReadAll(r.Body)
+			body := io.Reader(r.Body)
+			if limits.MaxRequestBytes > 0 {
+				body = io.LimitReader(r.Body, int64(limits.MaxRequestBytes)+1)
+			}
+			tmp, err := ioutil.ReadAll(body)
+			r.Body.Close()
+			if limits.MaxRequestBytes > 0 && len(tmp) > limits.MaxRequestBytes {
+				_http_limit_error(w, http.StatusRequestEntityTooLarge, LimitError(LIMIT_REQUEST_BYTES, params["__client_ip"],
+					RPC_ERR_INVALID_REQUEST, fmt.Sprintf("Request too large, limit is %d bytes", limits.MaxRequestBytes), limits.MaxRequestBytes))
+				return
+			}
 			if err == nil {
-				r.Body.Close()
 				r_body = tmp
 
 				if len(r_body) > 40 {
@@ -68,6 +142,18 @@ func startServiceHTTP(bindTo string, handler handlerFunc) {
 			}
 		}
 
+		// bytes transferred over single keep-alive connection
+		conn_bytes, _ := r.Context().Value(httpConnBytesKey).(*int64)
+		if conn_bytes != nil && limits.MaxConnectionBytes > 0 {
+			defer func() { atomic.AddInt64(conn_bytes, int64(cw.written)) }()
+			if atomic.AddInt64(conn_bytes, int64(req_len+len(r_body))) > int64(limits.MaxConnectionBytes) {
+				w.Header().Set("Connection", "close")
+				_http_limit_error(w, http.StatusTooManyRequests, LimitError(LIMIT_CONNECTION_BYTES, params["__client_ip"],
+					RPC_ERR_CONNECTION_EXCEEDED, fmt.Sprintf("Connection transferred over %d bytes, please reconnect", limits.MaxConnectionBytes), limits.MaxConnectionBytes))
+				return
+			}
+		}
+
 		_req_status := &httpRequest{str_req_id, time.Now().UnixNano(), 0, "R"}
 		httpStatMutex.Lock()
 		httpRequestId++
@@ -80,6 +166,7 @@ func startServiceHTTP(bindTo string, handler handlerFunc) {
 			if plugin(w, r.Header, params, r_body) {
 
 				_end := time.Now().UnixNano()
+				_http_stats("http_passthrough", _req_status.start_time, req_len+len(r_body), cw)
 				go func(_my_reqid uint64, _end int64) {
 					httpStatMutex.Lock()
 					_req_status.status = "F"
@@ -116,7 +203,12 @@ func startServiceHTTP(bindTo string, handler handlerFunc) {
 			if _pos < 0 {
 				continue
 			}
-			w.Header().Add(v[0:_pos], v[_pos+1:])
+			_k, _v := v[0:_pos], strings.TrimSpace(v[_pos+1:])
+			if strings.EqualFold(_k, "Content-Type") {
+				w.Header().Set(_k, _v)
+				continue
+			}
+			w.Header().Add(_k, _v)
 		}
 
 		httpStatMutex.Lock()
@@ -131,6 +223,7 @@ func startServiceHTTP(bindTo string, handler handlerFunc) {
 		httpStatMutex.Unlock()
 
 		hsparams.Cleanup()
+		_http_stats(params["action"], _req_status.start_time, req_len+len(r_body), cw)
 
 		go func(_my_reqid uint64) {
 			time.Sleep(5000 * time.Millisecond)
@@ -141,13 +234,24 @@ func startServiceHTTP(bindTo string, handler handlerFunc) {
 
 	}
 
-	err := http.ListenAndServe(bindTo, http.HandlerFunc(handle_hunc))
+	server := &http.Server{Addr: bindTo, Handler: http.HandlerFunc(handle_hunc)}
+	server.ConnContext = func(ctx context.Context, c net.Conn) context.Context {
+		return context.WithValue(ctx, httpConnBytesKey, new(int64))
+	}
+	err := server.ListenAndServe()
 	if err != nil {
-		fmt.Println("HTTP Error listening on TCP address: ", bindTo)
+		log_http.Error("Error listening on TCP address", "addr", bindTo, "err", err)
 	}
 
 }
 
+// HTTP requests are counted in server stats together with socket requests,
+// status 400 and above is counted as an error
+func _http_stats(action string, started int64, req_bytes int, cw *httpCountingWriter) {
+	took := uint64(time.Now().UnixNano()-started) / 1000
+	stats.HTTPRequest(action, took, uint64(req_bytes), uint64(cw.written), cw.status >= 400)
+}
+
 func GetStatusHTTP() string {
 	httpStatMutex.Lock()
 	now := time.Now().UnixNano()
@@ -0,0 +1,144 @@
+package handler_socket2
+
+import (
+	"encoding/json"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/config"
+)
+
+// RequestLimiter is run for every incoming request before it's handled,
+// if it returns false the request is rejected with the returned reason.
+// Otherwise done callback is called after the response was sent, with
+// the number of bytes returned to the client
+type RequestLimiter func(client_ip string) (bool, string, func(bytes_out int))
+
+var requestLimiters = make([]RequestLimiter, 0)
+
+func RequestLimiterRegister(f RequestLimiter) {
+	requestLimiters = append(requestLimiters, f)
+}
+
+func requestLimitBegin(client_ip string) (bool, string, func(int)) {
+	if len(requestLimiters) == 0 {
+		return true, "", func(int) {}
+	}
+
+	dones := make([]func(int), 0, len(requestLimiters))
+	_finish := func(bytes_out int) {
+		for _, done := range dones {
+			if done != nil {
+				done(bytes_out)
+			}
+		}
+	}
+
+	for _, limiter := range requestLimiters {
+		ok, reason, done := limiter(client_ip)
+		if !ok {
+			_finish(0)
+			return false, reason, nil
+		}
+		dones = append(dones, done)
+	}
+	return true, "", _finish
+}
+
+func limitError(reason string) []byte {
+	ret := make(map[string]interface{})
+	ret["error"] = reason
+	ret["limited"] = true
+	tmp, _ := json.Marshal(ret)
+	return tmp
+}
+
+// ParseIPRanges reads comma separated list of IPs or CIDR ranges, single
+// IPs are treated as /32 or /128. Entries which can't be parsed are skipped
+// and returned as errors
+func ParseIPRanges(s string) ([]*net.IPNet, []error) {
+	ret := make([]*net.IPNet, 0)
+	errs := make([]error, 0)
+	for _, v := range strings.Split(s, ",") {
+		v = strings.Trim(v, "\r\n\t ")
+		if len(v) == 0 {
+			continue
+		}
+		if strings.IndexByte(v, '/') == -1 {
+			if strings.IndexByte(v, ':') > -1 {
+				v += "/128"
+			} else {
+				v += "/32"
+			}
+		}
+		_, ipnet, err := net.ParseCIDR(v)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		ret = append(ret, ipnet)
+	}
+	return ret, errs
+}
+
+// IPInRanges returns true if the ip is in one of the ranges
+func IPInRanges(ranges []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, r := range ranges {
+		if r.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+var trustedProxies []*net.IPNet
+var trustedProxiesOnce sync.Once
+
+// TRUSTED_PROXIES is comma separated list of IPs or CIDR ranges, X-Forwarded-For
+// header is honored only for requests coming from these addresses
+func _trusted_proxies() []*net.IPNet {
+	trustedProxiesOnce.Do(func() {
+		var errs []error
+		trustedProxies, errs = ParseIPRanges(config.Config().Get("TRUSTED_PROXIES", ""))
+		for _, err := range errs {
+			log.Warn("Cannot parse TRUSTED_PROXIES entry", "err", err)
+		}
+	})
+	return trustedProxies
+}
+
+func _is_trusted_proxy(ip net.IP) bool {
+	return IPInRanges(_trusted_proxies(), ip)
+}
+
+// ClientIP returns the address of the client, if the request came from
+// trusted proxy, X-Forwarded-For is walked from the right and first
+// address which is not a trusted proxy is returned
+func ClientIP(remote_addr, forwarded_for string) string {
+	host := remote_addr
+	if _host, _, err := net.SplitHostPort(remote_addr); err == nil {
+		host = _host
+	}
+
+	if len(forwarded_for) == 0 || !_is_trusted_proxy(net.ParseIP(host)) {
+		return host
+	}
+
+	hops := strings.Split(forwarded_for, ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		ip := net.ParseIP(hop)
+		if ip == nil {
+			break
+		}
+		host = hop
+		if !_is_trusted_proxy(ip) {
+			break
+		}
+	}
+	return host
+}
@@ -99,8 +99,10 @@ func ReadHSParams(message []byte, out_params *HSParams) []byte {
 	return guid
 }
 
+// SetRespHeader adds header to the response, it's sent as HTTP header or
+// in the header block of socket protocol response
 func (p *HSParams) SetRespHeader(attr, val string) {
-	p.additional_resp_headers = append(p.additional_resp_headers, attr+":"+val+"\n")
+	p.additional_resp_headers = append(p.additional_resp_headers, attr+":"+val+"\r\n")
 }
 
 func (p *HSParams) SetParam(attr string, val string) {
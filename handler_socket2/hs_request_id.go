@@ -0,0 +1,34 @@
+package handler_socket2
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const REQUEST_ID_HEADER = "X-Request-Id"
+const request_id_max_len = 128
+
+var request_id_fallback uint64
+
+// RequestID returns the ID sent by the client if it's safe to be logged and
+// forwarded, otherwise new random ID is generated
+func RequestID(id string) string {
+	ok := len(id) > 0 && len(id) <= request_id_max_len
+	for i := 0; ok && i < len(id); i++ {
+		c := id[i]
+		ok = (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == ':' || c == '/' || c == '+' || c == '='
+	}
+	if ok {
+		return id
+	}
+
+	tmp := make([]byte, 16)
+	if _, err := rand.Read(tmp); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36) + "-" + strconv.FormatUint(atomic.AddUint64(&request_id_fallback, 1), 36)
+	}
+	return hex.EncodeToString(tmp)
+}
@@ -0,0 +1,203 @@
+package handler_socket2
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/config"
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/hscommon"
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/stats"
+)
+
+const (
+	LIMIT_REQUEST_BYTES    = "max_request_bytes"
+	LIMIT_BATCH_ITEMS      = "max_batch_items"
+	LIMIT_RESPONSE_BYTES   = "max_response_bytes"
+	LIMIT_CONNECTION_BYTES = "max_connection_bytes"
+)
+
+// JSON-RPC error codes returned when limits are hit
+const (
+	RPC_ERR_INVALID_REQUEST     = -32600
+	RPC_ERR_RESPONSE_TOO_LARGE  = -32003
+	RPC_ERR_CONNECTION_EXCEEDED = -32005
+)
+
+// SizeLimits are read from LIMITS section, 0 means there's no limit
+type SizeLimits struct {
+	MaxRequestBytes    int
+	MaxBatchItems      int
+	MaxConnectionBytes int
+
+	max_response_bytes map[string]int
+}
+
+var sizeLimits *SizeLimits
+var sizeLimitsOnce sync.Once
+
+func init() {
+	StatusPluginRegisterData(func() (string, string) {
+		l := GetSizeLimits()
+		info := "Requests over the limits are rejected with JSON-RPC error, the limits are defined in LIMITS section\n"
+		_batch := "unlimited"
+		if l.MaxBatchItems > 0 {
+			_batch = fmt.Sprintf("%d", l.MaxBatchItems)
+		}
+		info += fmt.Sprintf("Max request: %s, max batch items: %s, max per connection: %s\n",
+			_format_limit(l.MaxRequestBytes), _batch, _format_limit(l.MaxConnectionBytes))
+		for method, v := range l.max_response_bytes {
+			info += fmt.Sprintf("Max response for %s: %s\n", html.EscapeString(method), _format_limit(v))
+		}
+
+		table := hscommon.NewTableGen("Limit", "Hits", "Last Hit", "Top Clients")
+		table.SetClass("tab")
+
+		now := time.Now().Unix()
+		for limit, lh := range stats.GetLimitHits() {
+			clients := make([]hscommon.ScoredItems, 0, len(lh.ByClient))
+			for client, count := range lh.ByClient {
+				clients = append(clients, hscommon.ScoredItems{Item: client, Score: int64(count)})
+			}
+			sort.Sort(sort.Reverse(hscommon.SIArr(clients)))
+
+			_top := ""
+			for num, c := range clients {
+				if num >= 10 {
+					break
+				}
+				_top += fmt.Sprintf("%s: %d<br>", html.EscapeString(c.Item), c.Score)
+			}
+			_last_hit := "now"
+			if now-lh.LastHitTS > 0 {
+				_last_hit = hscommon.FormatTime(int(now-lh.LastHitTS)) + " ago"
+			}
+			table.AddRow(limit, fmt.Sprintf("%d", lh.Total), _last_hit, _top)
+		}
+
+		return "Size Limits", "<pre>" + info + "</pre>" + table.RenderSorted(0)
+	}, func() (string, interface{}) {
+		l := GetSizeLimits()
+		return "Size Limits", map[string]interface{}{"max_request_bytes": l.MaxRequestBytes, "max_batch_items": l.MaxBatchItems,
+			"max_connection_bytes": l.MaxConnectionBytes, "max_response_bytes": l.max_response_bytes, "hits": stats.GetLimitHits()}
+	})
+}
+
+func _format_limit(v int) string {
+	if v <= 0 {
+		return "unlimited"
+	}
+	return hscommon.FormatBytes(uint64(v))
+}
+
+func _limits_int(raw map[string]interface{}, attr string, def int, path string, errs *config.PathErrors) int {
+	v, ok := raw[attr]
+	if !ok {
+		return def
+	}
+	if n, ok := v.(json.Number); ok {
+		if _v, err := n.Int64(); err == nil && _v >= 0 {
+			return int(_v)
+		}
+	}
+	errs.Add(config.PathKey(path, attr), "expected integer >= 0, 0 means no limit")
+	return def
+}
+
+func _size_limits_read(raw map[string]interface{}, path string) (*SizeLimits, config.PathErrors) {
+	errs := config.PathErrors{}
+	for attr := range raw {
+		switch attr {
+		case LIMIT_REQUEST_BYTES, LIMIT_BATCH_ITEMS, LIMIT_RESPONSE_BYTES, LIMIT_CONNECTION_BYTES:
+		default:
+			errs.Add(config.PathKey(path, attr), "unknown limit")
+		}
+	}
+
+	ret := &SizeLimits{}
+	ret.MaxRequestBytes = _limits_int(raw, LIMIT_REQUEST_BYTES, 1024*1024*16, path, &errs)
+	ret.MaxBatchItems = _limits_int(raw, LIMIT_BATCH_ITEMS, 0, path, &errs)
+	ret.MaxConnectionBytes = _limits_int(raw, LIMIT_CONNECTION_BYTES, 0, path, &errs)
+	ret.max_response_bytes = make(map[string]int)
+	switch v := raw[LIMIT_RESPONSE_BYTES].(type) {
+	case nil:
+	case json.Number:
+		ret.max_response_bytes["*"] = _limits_int(raw, LIMIT_RESPONSE_BYTES, 0, path, &errs)
+	case map[string]interface{}:
+		for method := range v {
+			ret.max_response_bytes[method] = _limits_int(v, method, 0, config.PathKey(path, LIMIT_RESPONSE_BYTES), &errs)
+		}
+	default:
+		errs.Add(config.PathKey(path, LIMIT_RESPONSE_BYTES), "expected integer or object with limits by method")
+	}
+	return ret, errs
+}
+
+// SizeLimitsConfigCheck validates LIMITS section
+func SizeLimitsConfigCheck(raw interface{}, path string) []config.PathError {
+	_raw, ok := raw.(map[string]interface{})
+	if !ok {
+		return []config.PathError{{Path: path, Message: "expected object"}}
+	}
+	_, errs := _size_limits_read(_raw, path)
+	return errs
+}
+
+// GetSizeLimits returns limits from LIMITS section, eg.
+// "LIMITS":{"max_request_bytes":1048576, "max_batch_items":100,
+// "max_response_bytes":{"*":10485760, "eth_getLogs":52428800}}
+func GetSizeLimits() *SizeLimits {
+	sizeLimitsOnce.Do(func() {
+		raw, ok := config.Config().GetRawData("LIMITS", "").(map[string]interface{})
+		if !ok {
+			raw = make(map[string]interface{})
+		}
+
+		var errs config.PathErrors
+		sizeLimits, errs = _size_limits_read(raw, "LIMITS")
+		for _, err := range errs {
+			log.Warn("Invalid LIMITS config", "err", err)
+		}
+	})
+	return sizeLimits
+}
+
+// MaxResponseBytes returns response size limit for the methods, if there
+// are more methods (batch) the highest limit is used, 0 means no limit
+func (this *SizeLimits) MaxResponseBytes(methods ...string) int {
+	ret := 0
+	for _, method := range methods {
+		v, ok := this.max_response_bytes[method]
+		if !ok {
+			v = this.max_response_bytes["*"]
+		}
+		if v <= 0 {
+			return 0
+		}
+		if v > ret {
+			ret = v
+		}
+	}
+	return ret
+}
+
+// LimitError builds JSON-RPC error for a request which was over the limit,
+// the hit is counted for the client
+func LimitError(limit, client string, code int, message string, max int) []byte {
+	stats.LimitHit(limit, client)
+
+	e := make(map[string]interface{})
+	e["code"] = code
+	e["message"] = message
+	e["data"] = map[string]interface{}{"limit": limit, "max": max}
+
+	ret := make(map[string]interface{})
+	ret["jsonrpc"] = "2.0"
+	ret["id"] = nil
+	ret["error"] = e
+	tmp, _ := json.Marshal(ret)
+	return tmp
+}
@@ -0,0 +1,85 @@
+package handler_socket2
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/byteslabs"
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/history"
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/stats"
+)
+
+// keys of GetStatus() which are rendered HTML, they're not included in JSON
+var statusHTMLKeys = map[string]bool{
+	"threadlist":      true,
+	"http_threadlist": true,
+	"udp_threadlist":  true,
+	"handlers_table":  true,
+}
+
+type statusPluginJSON struct {
+	Title string      `json:"title"`
+	Data  interface{} `json:"data,omitempty"`
+	HTML  string      `json:"html,omitempty"`
+}
+
+func handlerServerStatusJSON() string {
+
+	server := make(map[string]interface{})
+	for k, v := range GetStatus() {
+		if !statusHTMLKeys[k] {
+			server[strings.TrimPrefix(k, "_")] = v
+		}
+	}
+
+	boundMutex.Lock()
+	server["bound_to"] = append([]string{}, boundTo...)
+	boundMutex.Unlock()
+	server["uptime_sec"] = int(time.Now().UnixNano()/1000000000) - uptime_started
+	server["actions"] = stats.GetActionStats()
+
+	plugins := make([]statusPluginJSON, 0, len(statusPlugins)+1)
+	for _, sp := range statusPlugins {
+		if sp.data == nil {
+			title, html := sp.html()
+			plugins = append(plugins, statusPluginJSON{Title: title, HTML: html})
+			continue
+		}
+		title, data := sp.data()
+		plugins = append(plugins, statusPluginJSON{Title: title, Data: data})
+	}
+	title, data := byteslabs.GetStatusData()
+	plugins = append(plugins, statusPluginJSON{Title: title, Data: data})
+
+	ret := make(map[string]interface{})
+	ret["server"] = server
+	ret["plugins"] = plugins
+	tmp, err := json.Marshal(ret)
+	if err != nil {
+		return `{"error":"can't encode status"}`
+	}
+	return string(tmp)
+}
+
+// history of series matching &series= (comma separated, * at the end matches
+// a prefix), at &res= resolution (1s, 1m, 1h), last &points= points
+func handlerServerStatusHistory(data *HSParams) string {
+	patterns := make([]string, 0)
+	for _, v := range strings.Split(data.GetParam("series", "*"), ",") {
+		if v = strings.Trim(v, "\r\n\t "); len(v) > 0 {
+			patterns = append(patterns, v)
+		}
+	}
+
+	res, err := history.Query(data.GetParam("res", "1m"), patterns, data.GetParamI("points", 0))
+	if err != nil {
+		tmp, _ := json.Marshal(map[string]string{"error": err.Error()})
+		return string(tmp)
+	}
+	tmp, err := json.Marshal(res)
+	if err != nil {
+		return `{"error":"can't encode history"}`
+	}
+	return string(tmp)
+}
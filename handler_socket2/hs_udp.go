@@ -5,7 +5,7 @@ import (
 	"compress/flate"
 	"encoding/binary"
 	"fmt"
-	"github.com/slawomir-pryczek/HSServer/handler_socket2/config"
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/stats"
 	"net"
 	"sync"
 	"time"
@@ -75,7 +75,7 @@ func udpStatFinishRequest(rec_id string, is_ok bool) {
 	udpStatMutex.Lock()
 	if info, exists := udpStats[rec_id]; exists {
 		info.sub_requests_pending--
-		fmt.Println("TASK PENDING FOR CLEANUP: ", udpStats[rec_id], is_ok)
+		log_udp.Debug("Task pending for cleanup", "rec_id", rec_id, "pending", info.sub_requests_pending, "ok", is_ok)
 
 		if !is_ok || info.sub_requests_pending <= 0 {
 			info.status = status
@@ -133,17 +133,17 @@ func startServiceUDP(bindTo string, handler handlerFunc) {
 
 	udpAddr, err := net.ResolveUDPAddr("udp", bindTo)
 	if err != nil {
-		fmt.Printf("Error resolving address: %s, %s\n", bindTo, err)
+		log_udp.Error("Error resolving address", "addr", bindTo, "err", err)
 		return
 	}
 
 	listener, err := net.ListenUDP("udp", udpAddr)
 	if err != nil {
-		fmt.Printf("Error listening on UDP address: %s, %s\n", bindTo, err)
+		log_udp.Error("Error listening on UDP address", "addr", bindTo, "err", err)
 		return
 	}
 
-	fmt.Printf("UDP Service started : %s\n", bindTo)
+	log_udp.Info("UDP Service started", "addr", bindTo)
 	boundMutex.Lock()
 	boundTo = append(boundTo, "udp:"+bindTo)
 	boundMutex.Unlock()
@@ -193,7 +193,7 @@ func startServiceUDP(bindTo string, handler handlerFunc) {
 
 						udpStatBeginRequest(key, req_no)
 						go func(key string, msg_body []byte, is_compressed bool) {
-							is_ok := runRequestV2(key, msg_body, is_compressed, handler)
+							is_ok := runRequestV2(key, "u"+bindTo, msg_body, is_compressed, handler)
 							udpStatFinishRequest(key, is_ok)
 						}(key, msg_body, is_compressed)
 
@@ -234,7 +234,7 @@ func startServiceUDP(bindTo string, handler handlerFunc) {
 				if move_forward > 0 {
 
 					go func(key string, msg_body []byte, is_compressed bool) {
-						runRequest(key, msg_body, is_compressed, handler)
+						runRequest(key, "u"+bindTo, msg_body, is_compressed, handler)
 						udpStatFinishRequest(key, true)
 					}(key, msg_body, is_compressed)
 
@@ -276,6 +276,10 @@ func processRequestDataV2(key string, message []byte, handler handlerFunc) (int,
 	if size < 0 {
 		return -1, nil, false
 	}
+	if max := GetSizeLimits().MaxRequestBytes; max > 0 && size > max {
+		stats.LimitHit(LIMIT_REQUEST_BYTES, ClientIP(key, ""))
+		return -1, nil, false
+	}
 
 	if len(message) >= size {
 		return size, message[5:size], is_compressed
@@ -284,7 +288,7 @@ func processRequestDataV2(key string, message []byte, handler handlerFunc) (int,
 	return 0, nil, false
 }
 
-func runRequestV2(key string, message_body []byte, is_compressed bool, handler handlerFunc) bool {
+func runRequestV2(key, listener string, message_body []byte, is_compressed bool, handler handlerFunc) bool {
 
 	// compression support!
 	if is_compressed {
@@ -298,8 +302,8 @@ func runRequestV2(key string, message_body []byte, is_compressed bool, handler h
 	}
 	// <<
 
-	if config.CfgIsDebug() {
-		fmt.Println("FROM UDP: ", string(message_body))
+	if log_udp.IsDebug() {
+		log_udp.Debug("Request", "remote", key, "body", string(message_body))
 	}
 
 	hsparams := CreateHSParams()
@@ -308,11 +312,23 @@ func runRequestV2(key string, message_body []byte, is_compressed bool, handler h
 		hsparams.Cleanup()
 		return false
 	}
+	hsparams.SetParam("__listener", listener)
+	hsparams.SetParam("__remote_addr", key)
+	hsparams.SetParam("__client_ip", ClientIP(key, ""))
+	hsparams.SetParam("__request_id", RequestID(hsparams.GetParam("request_id", "")))
+
+	limit_ok, limit_reason, limit_done := requestLimitBegin(hsparams.GetParam("__client_ip", ""))
+	if !limit_ok {
+		log_udp.Debug("Request rejected", "guid", string(guid), "reason", limit_reason)
+		hsparams.Cleanup()
+		return false
+	}
 
 	udpStatRequest(key, hsparams.GetParam("action", "?"), hsparams.getParamInfoHTML())
 	data := handler(hsparams)
-	if config.CfgIsDebug() {
-		fmt.Println(string(guid), ">>", data)
+	limit_done(len(data))
+	if log_udp.IsDebug() {
+		log_udp.Debug("Response", "guid", string(guid), "data", data)
 	}
 	hsparams.Cleanup()
 
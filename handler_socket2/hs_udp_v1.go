@@ -3,17 +3,15 @@ package handler_socket2
 import (
 	"bytes"
 	"compress/flate"
-	"fmt"
-	"github.com/slawomir-pryczek/HSServer/handler_socket2/config"
 	"net/url"
 	"strings"
 )
 
-func runRequest(key string, message_body []byte, is_compressed bool, handler handlerFunc) {
+func runRequest(key, listener string, message_body []byte, is_compressed bool, handler handlerFunc) {
 	// compression support!
 
-	if config.CfgIsDebug() {
-		fmt.Println("FROM UDP: ", string(message_body))
+	if log_udp.IsDebug() {
+		log_udp.Debug("Request", "remote", key, "body", string(message_body))
 	}
 
 	curr_msg := ""
@@ -55,7 +53,6 @@ func runRequest(key string, message_body []byte, is_compressed bool, handler han
 
 	// process packet - parameters
 	params, _ := url.ParseQuery(curr_msg)
-	fmt.Print(params)
 
 	params2 := make(map[string]string)
 	for _k, _v := range params {
@@ -75,11 +72,22 @@ func runRequest(key string, message_body []byte, is_compressed bool, handler han
 			action = "default"
 		}
 
+		params2["__listener"] = listener
+		params2["__remote_addr"] = key
+		params2["__client_ip"] = ClientIP(key, "")
+		params2["__request_id"] = RequestID(params2["request_id"])
+		limit_ok, limit_reason, limit_done := requestLimitBegin(params2["__client_ip"])
+		if !limit_ok {
+			log_udp.Debug("Request rejected", "remote", key, "reason", limit_reason)
+			break
+		}
+
 		hsparams := CreateHSParamsFromMap(params2)
 		data = handler(hsparams)
 		if hsparams.fastreturn != nil {
 			data = string(hsparams.fastreturn)
 		}
+		limit_done(len(data))
 
 		//fmt.Println(data)
 		if !strings.HasPrefix(data, "X-Forward:") {
@@ -104,7 +112,7 @@ func runRequest(key string, message_body []byte, is_compressed bool, handler han
 		}
 
 		hsparams.Cleanup()
-		fmt.Println(params2)
+		log_udp.Debug("Forward", "params", params2)
 	}
 }
 
@@ -125,7 +133,7 @@ func processRequestData(key string, message []byte, handler handlerFunc) (int, [
 	// request is terminated - we can start to process it!
 	bytes_rec_uncompressed := 0
 	is_compressed, required_size, guid := processHeader(message[0:lenf])
-	fmt.Println("GUID: ", guid)
+	log_udp.Debug("Request header", "guid", guid)
 
 	if required_size < 0 {
 		return -1, nil, false
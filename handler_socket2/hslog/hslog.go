@@ -0,0 +1,374 @@
+package hslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	LEVEL_DEBUG = iota
+	LEVEL_INFO
+	LEVEL_WARN
+	LEVEL_ERROR
+	LEVEL_NONE
+)
+
+var level_names = []string{"debug", "info", "warn", "error", "none"}
+
+const (
+	FORMAT_LOGFMT = "logfmt"
+	FORMAT_JSON   = "json"
+)
+
+type settings struct {
+	level      int
+	subsystems map[string]int
+	format     string
+
+	sample_first      int
+	sample_thereafter int
+
+	file      string
+	max_size  int64
+	max_files int
+}
+
+type sample struct {
+	sec     int64
+	count   int
+	dropped int
+}
+
+// Logger writes messages of single subsystem, messages are constant strings
+// and variable data is passed as key, value pairs
+type Logger struct {
+	name string
+}
+
+var _settings atomic.Value
+
+var mu sync.Mutex
+var out = &writer{}
+var samples = make(map[string]*sample)
+var loggers = make(map[string]*Logger)
+var counters = make(map[string]int)
+
+func init() {
+	_settings.Store(&settings{level: LEVEL_INFO, subsystems: map[string]int{}, format: FORMAT_LOGFMT})
+	registerMetrics()
+}
+
+func _cfg() *settings {
+	return _settings.Load().(*settings)
+}
+
+// Get returns logger for given subsystem, eg. "proxy", "health", "socket"
+func Get(subsystem string) *Logger {
+	mu.Lock()
+	defer mu.Unlock()
+	if l, ok := loggers[subsystem]; ok {
+		return l
+	}
+	l := &Logger{name: subsystem}
+	loggers[subsystem] = l
+	return l
+}
+
+func ParseLevel(level string) (int, bool) {
+	level = strings.ToLower(strings.Trim(level, "\r\n\t "))
+	if level == "warning" {
+		level = "warn"
+	}
+	for num, name := range level_names {
+		if name == level {
+			return num, true
+		}
+	}
+	return LEVEL_INFO, false
+}
+
+func LevelName(level int) string {
+	if level < 0 || level >= len(level_names) {
+		return "?"
+	}
+	return level_names[level]
+}
+
+func (this *Logger) Level() int {
+	s := _cfg()
+	if l, ok := s.subsystems[this.name]; ok {
+		return l
+	}
+	return s.level
+}
+
+// Enabled can be used to skip building expensive messages
+func (this *Logger) Enabled(level int) bool {
+	return level >= this.Level()
+}
+
+func (this *Logger) IsDebug() bool {
+	return this.Enabled(LEVEL_DEBUG)
+}
+
+func (this *Logger) Debug(msg string, kv ...interface{}) {
+	this.Log(LEVEL_DEBUG, msg, kv...)
+}
+
+func (this *Logger) Info(msg string, kv ...interface{}) {
+	this.Log(LEVEL_INFO, msg, kv...)
+}
+
+func (this *Logger) Warn(msg string, kv ...interface{}) {
+	this.Log(LEVEL_WARN, msg, kv...)
+}
+
+func (this *Logger) Error(msg string, kv ...interface{}) {
+	this.Log(LEVEL_ERROR, msg, kv...)
+}
+
+// Log writes the message if level is enabled for the subsystem. Debug and
+// info messages are sampled, first sample_first messages with the same text
+// are written every second, after that only every sample_thereafter one
+func (this *Logger) Log(level int, msg string, kv ...interface{}) {
+	s := _cfg()
+	if level < this.Level() {
+		return
+	}
+
+	now := time.Now()
+	dropped := 0
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if level <= LEVEL_INFO && s.sample_first > 0 {
+		key := this.name + "\x00" + msg
+		sm, ok := samples[key]
+		if !ok {
+			sm = &sample{}
+			samples[key] = sm
+		}
+		if sec := now.Unix(); sm.sec != sec {
+			sm.sec = sec
+			sm.count = 0
+		}
+		sm.count++
+		if sm.count > s.sample_first {
+			if s.sample_thereafter <= 0 || (sm.count-s.sample_first)%s.sample_thereafter != 0 {
+				sm.dropped++
+				counters["dropped"]++
+				return
+			}
+		}
+		dropped = sm.dropped
+		sm.dropped = 0
+	}
+
+	counters[level_names[level]]++
+	line := _format(s.format, now, level, this.name, msg, dropped, kv)
+	out.write(s, line)
+}
+
+func _value(v interface{}) interface{} {
+	switch vv := v.(type) {
+	case nil:
+		return nil
+	case error:
+		return vv.Error()
+	case string, bool, int, int64, uint64, int32, uint32, float64:
+		return vv
+	case fmt.Stringer:
+		return vv.String()
+	}
+	return fmt.Sprint(v)
+}
+
+func _logfmt_quote(s string) string {
+	if len(s) == 0 || strings.ContainsAny(s, " =\"\\\t\r\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func _format(format string, now time.Time, level int, subsystem, msg string, dropped int, kv []interface{}) []byte {
+	ts := now.UTC().Format("2006-01-02T15:04:05.000Z07:00")
+	if dropped > 0 {
+		kv = append(kv, "sampled_out", dropped)
+	}
+
+	ret := strings.Builder{}
+	if format == FORMAT_JSON {
+		_json := func(v interface{}) string {
+			data, err := json.Marshal(v)
+			if err != nil {
+				data, _ = json.Marshal(fmt.Sprint(v))
+			}
+			return string(data)
+		}
+		ret.WriteString(`{"ts":` + _json(ts) + `,"level":` + _json(level_names[level]) + `,"sub":` + _json(subsystem) + `,"msg":` + _json(msg))
+		for i := 0; i+1 < len(kv); i += 2 {
+			ret.WriteString("," + _json(fmt.Sprint(kv[i])) + ":" + _json(_value(kv[i+1])))
+		}
+		ret.WriteString("}\n")
+		return []byte(ret.String())
+	}
+
+	ret.WriteString("ts=" + ts + " level=" + level_names[level] + " sub=" + _logfmt_quote(subsystem) + " msg=" + _logfmt_quote(msg))
+	for i := 0; i+1 < len(kv); i += 2 {
+		ret.WriteString(" " + _logfmt_quote(fmt.Sprint(kv[i])) + "=" + _logfmt_quote(fmt.Sprint(_value(kv[i+1]))))
+	}
+	ret.WriteString("\n")
+	return []byte(ret.String())
+}
+
+// Configure applies LOG section of the config, eg.
+// "LOG":{"level":"info", "format":"json", "subsystems":{"proxy":"debug"}, "sample":{"first":10, "thereafter":100},
+// "file":"proxy.log", "max_size_mb":100, "max_files":5}
+// legacy DEBUG flag sets the default level to debug
+func Configure(raw interface{}, debug bool) []string {
+	warnings := make([]string, 0)
+	s := &settings{level: LEVEL_INFO, subsystems: make(map[string]int), format: FORMAT_LOGFMT,
+		max_size: 100 * 1024 * 1024, max_files: 5}
+	if debug {
+		s.level = LEVEL_DEBUG
+	}
+
+	_int := func(v interface{}, def int) int {
+		switch vv := v.(type) {
+		case json.Number:
+			if i, err := vv.Int64(); err == nil {
+				return int(i)
+			}
+		case string:
+			if i, err := strconv.Atoi(vv); err == nil {
+				return i
+			}
+		case float64:
+			return int(vv)
+		}
+		return def
+	}
+
+	cfg, _ := raw.(map[string]interface{})
+	if v, ok := cfg["level"].(string); ok {
+		l, ok := ParseLevel(v)
+		if !ok {
+			warnings = append(warnings, "unknown log level "+v)
+		}
+		s.level = l
+	}
+	if v, ok := cfg["format"].(string); ok {
+		switch v {
+		case FORMAT_JSON, FORMAT_LOGFMT:
+			s.format = v
+		default:
+			warnings = append(warnings, "unknown log format "+v+", using logfmt")
+		}
+	}
+	if subs, ok := cfg["subsystems"].(map[string]interface{}); ok {
+		for name, v := range subs {
+			_v, _ := v.(string)
+			l, ok := ParseLevel(_v)
+			if !ok {
+				warnings = append(warnings, "unknown log level for "+name)
+				continue
+			}
+			s.subsystems[name] = l
+		}
+	}
+	if smp, ok := cfg["sample"].(map[string]interface{}); ok {
+		s.sample_first = _int(smp["first"], 0)
+		s.sample_thereafter = _int(smp["thereafter"], 0)
+	}
+	if v, ok := cfg["file"].(string); ok {
+		s.file = v
+	}
+	s.max_size = int64(_int(cfg["max_size_mb"], 100)) * 1024 * 1024
+	s.max_files = _int(cfg["max_files"], 5)
+
+	mu.Lock()
+	_settings.Store(s)
+	samples = make(map[string]*sample)
+	if err := out.reopen(s); err != nil {
+		warnings = append(warnings, "can't open log file "+s.file+", "+err.Error())
+	}
+	mu.Unlock()
+	return warnings
+}
+
+// writer outputs to stdout or to the file, which is rotated when it grows
+// over max_size, name.log -> name.log.1 -> ... -> name.log.<max_files>
+type writer struct {
+	f    *os.File
+	name string
+	size int64
+}
+
+func (this *writer) reopen(s *settings) error {
+	if this.f != nil && this.name == s.file {
+		return nil
+	}
+	if this.f != nil {
+		this.f.Close()
+		this.f = nil
+	}
+	this.name = s.file
+	if len(s.file) == 0 {
+		return nil
+	}
+
+	f, err := os.OpenFile(s.file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		this.name = ""
+		return err
+	}
+	this.f = f
+	this.size = 0
+	if st, err := f.Stat(); err == nil {
+		this.size = st.Size()
+	}
+	return nil
+}
+
+func (this *writer) rotate(s *settings) {
+	this.f.Close()
+	this.f = nil
+	for i := s.max_files - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", this.name, i), fmt.Sprintf("%s.%d", this.name, i+1))
+	}
+	if s.max_files > 0 {
+		os.Rename(this.name, this.name+".1")
+	} else {
+		os.Remove(this.name)
+	}
+
+	name := this.name
+	this.name = ""
+	if err := this.reopen(s); err != nil {
+		fmt.Fprintln(os.Stderr, "Can't reopen log file", name, err.Error())
+	}
+}
+
+func (this *writer) write(s *settings, line []byte) {
+	if this.f == nil {
+		os.Stdout.Write(line)
+		return
+	}
+
+	if s.max_size > 0 && this.size+int64(len(line)) > s.max_size && this.size > 0 {
+		this.rotate(s)
+		if this.f == nil {
+			os.Stdout.Write(line)
+			return
+		}
+	}
+	n, _ := this.f.Write(line)
+	this.size += int64(n)
+}
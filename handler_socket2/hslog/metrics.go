@@ -0,0 +1,14 @@
+package hslog
+
+import "github.com/slawomir-pryczek/HSServer/handler_socket2/metrics"
+
+func registerMetrics() {
+	metrics.Register(func(w *metrics.Writer) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, level := range level_names[:LEVEL_NONE] {
+			w.Counter("hs_log_messages_total", "Log messages written, by level", float64(counters[level]), "level", level)
+		}
+		w.Counter("hs_log_sampled_out_total", "Debug and info log messages dropped by sampling", float64(counters["dropped"]))
+	})
+}
@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	TYPE_COUNTER = "counter"
+	TYPE_GAUGE   = "gauge"
+)
+
+type family struct {
+	help    string
+	typ     string
+	samples []string
+}
+
+// Writer collects samples in Prometheus text exposition format, samples
+// of the same metric are grouped together under single HELP / TYPE header
+type Writer struct {
+	families map[string]*family
+	order    []string
+}
+
+// Plugin adds its samples to the writer, it's run for every scrape
+type Plugin func(w *Writer)
+
+var mu sync.Mutex
+var plugins = make([]Plugin, 0)
+
+func Register(p Plugin) {
+	mu.Lock()
+	plugins = append(plugins, p)
+	mu.Unlock()
+}
+
+func _escape(s string) string {
+	s = strings.Replace(s, "\\", "\\\\", -1)
+	s = strings.Replace(s, "\"", "\\\"", -1)
+	return strings.Replace(s, "\n", "\\n", -1)
+}
+
+func (this *Writer) _add(typ, name, help string, value float64, labels []string) {
+	f, ok := this.families[name]
+	if !ok {
+		f = &family{help: help, typ: typ}
+		this.families[name] = f
+		this.order = append(this.order, name)
+	}
+
+	sample := name
+	if len(labels) > 1 {
+		_labels := make([]string, 0, len(labels)/2)
+		for i := 0; i+1 < len(labels); i += 2 {
+			_labels = append(_labels, labels[i]+"=\""+_escape(labels[i+1])+"\"")
+		}
+		sample += "{" + strings.Join(_labels, ",") + "}"
+	}
+	f.samples = append(f.samples, sample+" "+strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+// Counter adds sample of monotonically increasing value, labels are
+// name, value pairs
+func (this *Writer) Counter(name, help string, value float64, labels ...string) {
+	this._add(TYPE_COUNTER, name, help, value, labels)
+}
+
+// Gauge adds sample of value which can go up and down, labels are
+// name, value pairs
+func (this *Writer) Gauge(name, help string, value float64, labels ...string) {
+	this._add(TYPE_GAUGE, name, help, value, labels)
+}
+
+// Render runs all plugins and returns the metrics in text format
+func Render() string {
+	w := &Writer{families: make(map[string]*family)}
+
+	mu.Lock()
+	_plugins := plugins
+	mu.Unlock()
+	for _, p := range _plugins {
+		p(w)
+	}
+
+	ret := strings.Builder{}
+	for _, name := range w.order {
+		f := w.families[name]
+		ret.WriteString("# HELP " + name + " " + f.help + "\n")
+		ret.WriteString("# TYPE " + name + " " + f.typ + "\n")
+		for _, s := range f.samples {
+			ret.WriteString(s + "\n")
+		}
+	}
+	return ret.String()
+}
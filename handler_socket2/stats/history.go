@@ -0,0 +1,68 @@
+package stats
+
+import (
+	"time"
+
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/history"
+)
+
+// server and per action stats are written to history every second, as
+// difference from the previous second
+func init() {
+	go func() {
+		last_actions := make(map[string]stats)
+		last_global := history.Values{}
+		for {
+			now := time.Now()
+			time.Sleep(time.Second - time.Duration(now.Nanosecond()))
+			ts := time.Now().Unix() - 1
+
+			stats_mutex.Lock()
+			global := history.Values{}
+			global[history.FIELD_REQUESTS] = float64(global_stats_requests)
+			global[history.FIELD_ERRORS] = float64(global_stats_errors)
+			global[history.FIELD_TIME_MS] = float64(global_stats_req_time) / 1000
+
+			actions := make(map[string]stats, len(stats_actions))
+			for action, sa := range stats_actions {
+				actions[action] = sa.getAdjStats()
+			}
+			stats_mutex.Unlock()
+
+			_add := func(name string, v history.Values) {
+				for _, val := range v {
+					if val != 0 {
+						history.Add(name, ts, v)
+						return
+					}
+				}
+			}
+
+			for _, sa := range actions {
+				global[history.FIELD_BYTES_IN] += float64(sa.b_request_size)
+				global[history.FIELD_BYTES_OUT] += float64(sa.b_resp_size)
+			}
+
+			delta := history.Values{}
+			for f := range global {
+				delta[f] = global[f] - last_global[f]
+			}
+			last_global = global
+			_add("server", delta)
+
+			for action, sa := range actions {
+				prev := last_actions[action]
+				v := history.Values{}
+				v[history.FIELD_REQUESTS] = float64(sa.requests) - float64(prev.requests)
+				v[history.FIELD_ERRORS] = float64(sa.errors) - float64(prev.errors)
+				v[history.FIELD_TIME_MS] = (float64(sa.req_time) - float64(prev.req_time)) / 1000
+				v[history.FIELD_BYTES_IN] = float64(sa.b_request_size) - float64(prev.b_request_size)
+				v[history.FIELD_BYTES_OUT] = float64(sa.b_resp_size) - float64(prev.b_resp_size)
+				last_actions[action] = sa
+				if len(action) > 0 {
+					_add("action:"+action, v)
+				}
+			}
+		}
+	}()
+}
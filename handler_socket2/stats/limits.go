@@ -0,0 +1,55 @@
+package stats
+
+import (
+	"sync"
+	"time"
+)
+
+// #############################################################################
+// size limit hits, counted per limit and per client
+
+const limit_hits_max_clients = 200
+
+type LimitHits struct {
+	Total     uint64
+	ByClient  map[string]uint64
+	LastHitTS int64
+}
+
+var limit_hits = make(map[string]*LimitHits)
+var limit_hits_mutex sync.Mutex
+
+// LimitHit records that client (usually IP address) hit the limit, number
+// of tracked clients is capped, the rest is counted as (other)
+func LimitHit(limit, client string) {
+	limit_hits_mutex.Lock()
+	defer limit_hits_mutex.Unlock()
+
+	lh, ok := limit_hits[limit]
+	if !ok {
+		lh = &LimitHits{ByClient: make(map[string]uint64)}
+		limit_hits[limit] = lh
+	}
+
+	if _, ok := lh.ByClient[client]; !ok && len(lh.ByClient) >= limit_hits_max_clients {
+		client = "(other)"
+	}
+	lh.Total++
+	lh.ByClient[client]++
+	lh.LastHitTS = time.Now().Unix()
+}
+
+func GetLimitHits() map[string]LimitHits {
+	limit_hits_mutex.Lock()
+	defer limit_hits_mutex.Unlock()
+
+	ret := make(map[string]LimitHits, len(limit_hits))
+	for limit, lh := range limit_hits {
+		tmp := LimitHits{Total: lh.Total, LastHitTS: lh.LastHitTS, ByClient: make(map[string]uint64, len(lh.ByClient))}
+		for k, v := range lh.ByClient {
+			tmp.ByClient[k] = v
+		}
+		ret[limit] = tmp
+	}
+	return ret
+}
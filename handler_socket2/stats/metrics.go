@@ -0,0 +1,34 @@
+package stats
+
+import (
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/metrics"
+)
+
+func init() {
+	metrics.Register(func(w *metrics.Writer) {
+		stats_mutex.Lock()
+		defer stats_mutex.Unlock()
+
+		w.Counter("hs_connections_total", "Socket connections accepted", float64(global_stats_connections))
+		w.Counter("hs_requests_total", "Requests served over HTTP and socket", float64(global_stats_requests))
+		w.Counter("hs_errors_total", "Socket connections closed with error and HTTP requests with error status", float64(global_stats_errors))
+
+		for action, v := range stats_actions {
+			s := v.getAdjStats()
+			w.Counter("hs_action_requests_total", "Requests served, per action", float64(s.requests), "action", action)
+			w.Counter("hs_action_request_seconds_total", "Time spent handling requests, per action", float64(s.req_time)/1e6, "action", action)
+			w.Counter("hs_action_roundtrip_seconds_total", "Time of whole requests including receiving and sending, per action", float64(s.req_time_full)/1e6, "action", action)
+			w.Counter("hs_action_received_bytes_total", "Bytes received, per action", float64(s.b_request_compressed), "action", action)
+			w.Counter("hs_action_received_uncompressed_bytes_total", "Bytes received after decompression, per action", float64(s.b_request_size), "action", action)
+			w.Counter("hs_action_sent_bytes_total", "Bytes sent, per action", float64(s.b_resp_compressed), "action", action)
+			w.Counter("hs_action_sent_uncompressed_bytes_total", "Bytes generated before compression, per action", float64(s.b_resp_size), "action", action)
+			w.Counter("hs_action_skipped_responses_total", "Responses which were not sent back, per action", float64(s.resp_skipped), "action", action)
+		}
+	})
+
+	metrics.Register(func(w *metrics.Writer) {
+		for limit, lh := range GetLimitHits() {
+			w.Counter("hs_limit_hits_total", "Requests rejected because of size limits", float64(lh.Total), "limit", limit)
+		}
+	})
+}
@@ -1,13 +1,15 @@
 package stats
 
 import (
-	"fmt"
 	"sync"
 	"time"
 
 	"github.com/slawomir-pryczek/HSServer/handler_socket2/hscommon"
+	"github.com/slawomir-pryczek/HSServer/handler_socket2/hslog"
 )
 
+var log = hslog.Get("socket")
+
 // #############################################################################
 // general stats
 
@@ -36,6 +38,7 @@ type Connection struct {
 
 type stats struct {
 	requests      uint64
+	errors        uint64
 	req_time      uint64
 	req_time_full uint64
 
@@ -53,6 +56,7 @@ func (this *stats) getAdjStats() stats {
 
 	ret := stats{}
 	ret.requests = this.requests
+	ret.errors = this.errors
 	ret.req_time = this.req_time
 	ret.req_time_full = this.req_time_full
 
@@ -196,6 +200,42 @@ func (this *Connection) StateKeepalive(resp_compressed, took uint64, skip_respon
 
 }
 
+// HTTPRequest counts request served over HTTP, there's no connection state
+// for HTTP so the request is accounted at once
+func HTTPRequest(action string, took, request_size, response_size uint64, is_error bool) {
+	now := time.Now().Unix()
+
+	stats_mutex.Lock()
+	global_stats_requests++
+	global_stats_req_time += took
+	global_stats_req_time_full += took
+	if is_error {
+		global_stats_errors++
+	}
+
+	if _, ok := stats_actions[action]; !ok {
+		stats_actions[action] = &stats{}
+	}
+	_sa := stats_actions[action]
+	_sa.requests++
+	_sa.req_time += took
+	_sa.req_time_full += took
+	if is_error {
+		_sa.errors++
+	}
+	_sa.b_request_size += request_size
+	_sa.b_request_compressed += request_size
+	_sa.b_resp_size += response_size
+	_sa.b_resp_compressed += response_size
+
+	_errors := uint64(0)
+	if is_error {
+		_errors = 1
+	}
+	uh_add_unsafe(int(now), 0, 1, _errors, took, took, request_size, request_size, response_size, response_size, false)
+	stats_mutex.Unlock()
+}
+
 func (this *Connection) Close(comment string, is_error bool) {
 
 	if is_error {
@@ -208,9 +248,9 @@ func (this *Connection) Close(comment string, is_error bool) {
 	x := func(conn_id uint64, comment string, is_error bool) {
 
 		if is_error {
-			fmt.Print("Error: " + comment)
+			log.Warn("Connection closed", "conn_id", conn_id, "reason", comment)
 		} else {
-			fmt.Print("Info: " + comment)
+			log.Debug("Connection closed", "conn_id", conn_id, "reason", comment)
 		}
 
 		time.Sleep(5000 * time.Millisecond)
@@ -218,3 +218,31 @@ func GetStatus(available_actions []string, uptime int) map[string]string {
 	return ret
 
 }
+
+type ActionStats struct {
+	Requests           uint64 `json:"requests"`
+	ReqTimeUs          uint64 `json:"req_time_us"`
+	ReqTimeFullUs      uint64 `json:"req_time_full_us"`
+	BytesReceived      uint64 `json:"bytes_received"`
+	BytesReceivedUncmp uint64 `json:"bytes_received_uncompressed"`
+	BytesSent          uint64 `json:"bytes_sent"`
+	BytesGenerated     uint64 `json:"bytes_generated"`
+	RespSkipped        uint64 `json:"resp_skipped"`
+	RespBytesSkipped   uint64 `json:"resp_bytes_skipped"`
+}
+
+// GetActionStats returns totals for every action which was called
+func GetActionStats() map[string]ActionStats {
+	stats_mutex.Lock()
+	defer stats_mutex.Unlock()
+
+	ret := make(map[string]ActionStats, len(stats_actions))
+	for action, v := range stats_actions {
+		s := v.getAdjStats()
+		ret[action] = ActionStats{Requests: s.requests, ReqTimeUs: s.req_time, ReqTimeFullUs: s.req_time_full,
+			BytesReceived: s.b_request_compressed, BytesReceivedUncmp: s.b_request_size,
+			BytesSent: s.b_resp_compressed, BytesGenerated: s.b_resp_size,
+			RespSkipped: s.resp_skipped, RespBytesSkipped: s.resp_b_skipped}
+	}
+	return ret
+}